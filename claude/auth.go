@@ -0,0 +1,61 @@
+package claude
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// keychainLogin reports whether the CLI may keep its login in the macOS
+// Keychain, where checkAuth cannot see it. A variable so tests can set it.
+var keychainLogin = runtime.GOOS == "darwin"
+
+// keychainAuthWarning is the warning emitted instead of an *AuthRequiredError
+// when only a Keychain login could authenticate the CLI.
+const keychainAuthWarning = "no credentials found in the environment or config directory; relying on a Keychain login"
+
+// authEnvVars are the environment variables that give the CLI credentials
+// without a Claude login: an API key, a bearer or OAuth token, or a switch to
+// a cloud provider that authenticates on its own.
+var authEnvVars = []string{
+	"ANTHROPIC_API_KEY",
+	"ANTHROPIC_AUTH_TOKEN",
+	"CLAUDE_CODE_OAUTH_TOKEN",
+	"CLAUDE_CODE_USE_BEDROCK",
+	"CLAUDE_CODE_USE_VERTEX",
+}
+
+// checkAuth returns an *AuthRequiredError when env, the resolved subprocess
+// environment, carries none of authEnvVars and there is no OAuth session in
+// the CLI's config directory ($CLAUDE_CONFIG_DIR, or ~/.claude).
+func checkAuth(env []string) error {
+	lookup := func(k string) string {
+		for i := len(env) - 1; i >= 0; i-- {
+			if v, ok := strings.CutPrefix(env[i], k+"="); ok {
+				return v
+			}
+		}
+		return ""
+	}
+	for _, k := range authEnvVars {
+		if lookup(k) != "" {
+			return nil
+		}
+	}
+	dir := lookup("CLAUDE_CONFIG_DIR")
+	if dir == "" {
+		if home := lookup("HOME"); home != "" {
+			dir = filepath.Join(home, ".claude")
+		}
+	}
+	if dir != "" {
+		if info, err := os.Stat(filepath.Join(dir, ".credentials.json")); err == nil && info.Size() > 0 {
+			return nil
+		}
+	}
+	return &AuthRequiredError{
+		Kind:    AuthKindAPIKey,
+		Message: "no ANTHROPIC_API_KEY or OAuth session found in the subprocess environment",
+	}
+}
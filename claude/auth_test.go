@@ -0,0 +1,104 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// clearAuthEnv removes every credential from the test environment and points
+// HOME and CLAUDE_CONFIG_DIR at empty directories.
+func clearAuthEnv(t *testing.T) string {
+	t.Helper()
+	for _, k := range authEnvVars {
+		t.Setenv(k, "")
+	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("CLAUDE_CONFIG_DIR", "")
+	return home
+}
+
+func TestWithRequireAuth_Missing(t *testing.T) {
+	defer func(v bool) { keychainLogin = v }(keychainLogin)
+	keychainLogin = false
+	clearAuthEnv(t)
+	marker := filepath.Join(t.TempDir(), "spawned")
+	exe := writeFakeCLI(t, "touch "+marker+"\nexit 1\n")
+
+	_, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithRequireAuth())
+	var authErr *AuthRequiredError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("expected *AuthRequiredError, got %T: %v", err, err)
+	}
+	if authErr.Kind != AuthKindAPIKey {
+		t.Fatalf("Kind = %q, want %q", authErr.Kind, AuthKindAPIKey)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("CLI was spawned despite missing credentials")
+	}
+}
+
+// TestWithRequireAuth_Keychain checks that a possible Keychain login is not
+// refused: the run goes ahead with a warning.
+func TestWithRequireAuth_Keychain(t *testing.T) {
+	defer func(v bool) { keychainLogin = v }(keychainLogin)
+	keychainLogin = true
+	clearAuthEnv(t)
+	exe := writeFakeCLI(t, `echo '{"type":"system","subtype":"init","session_id":"s1"}'
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"ok"}'
+      exit 0 ;;
+  esac
+done
+`)
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe), WithRequireAuth())
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var warned bool
+	for e := range stream.Events() {
+		if e.System != nil && e.System.Subtype == SubtypeWarning && e.System.Message == keychainAuthWarning {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Fatal("expected a warning about relying on the Keychain login")
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestCheckAuth(t *testing.T) {
+	home := clearAuthEnv(t)
+	if err := checkAuth(buildEnv(&Options{})); err == nil {
+		t.Fatal("expected an error with no credentials")
+	}
+	if err := checkAuth(buildEnv(&Options{Env: map[string]string{"ANTHROPIC_API_KEY": "sk-test"}})); err != nil {
+		t.Fatalf("API key from WithEnv: %v", err)
+	}
+	if err := checkAuth(buildEnv(&Options{Env: map[string]string{"CLAUDE_CODE_USE_BEDROCK": "1"}})); err != nil {
+		t.Fatalf("Bedrock: %v", err)
+	}
+
+	creds := filepath.Join(home, ".claude", ".credentials.json")
+	if err := os.MkdirAll(filepath.Dir(creds), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(creds, []byte(`{"claudeAiOauth":{}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkAuth(buildEnv(&Options{})); err != nil {
+		t.Fatalf("OAuth session in ~/.claude: %v", err)
+	}
+
+	t.Setenv("CLAUDE_CONFIG_DIR", t.TempDir())
+	if err := checkAuth(buildEnv(&Options{})); err == nil {
+		t.Fatal("expected CLAUDE_CONFIG_DIR to take precedence over ~/.claude")
+	}
+}
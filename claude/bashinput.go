@@ -0,0 +1,60 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BashToolInput is the decoded input of a call to the built-in Bash tool.
+type BashToolInput struct {
+	// Command is the shell command to run.
+	Command string `json:"command"`
+	// Description is the model's short explanation of the command, if given.
+	Description string `json:"description,omitempty"`
+	// Timeout is the timeout the model asked for; zero means the CLI's
+	// default (BASH_DEFAULT_TIMEOUT_MS, or WithToolTimeout).
+	Timeout time.Duration `json:"-"`
+	// RunInBackground is true when the command runs as a background shell.
+	RunInBackground bool `json:"run_in_background,omitempty"`
+	// DangerouslyDisableSandbox is true when the model asked to run the
+	// command outside the sandbox.
+	DangerouslyDisableSandbox bool `json:"dangerouslyDisableSandbox,omitempty"`
+	// CWD is the working directory the command starts in. The tool input does
+	// not carry it, so it is only set when ParseBashInput is given a whole
+	// hook payload; a permission handler can use its session's directory.
+	CWD string `json:"-"`
+}
+
+// ParseBashInput decodes the input of a Bash tool call. input is either the
+// tool input itself, as passed to a PermissionHandler, or a PreToolUse or
+// PostToolUse hook payload, from which the tool_input and cwd are taken. It
+// returns an error when input is not JSON or has no command.
+func ParseBashInput(input json.RawMessage) (*BashToolInput, error) {
+	var payload struct {
+		CWD       string          `json:"cwd"`
+		ToolInput json.RawMessage `json:"tool_input"`
+	}
+	if err := json.Unmarshal(input, &payload); err != nil {
+		return nil, fmt.Errorf("claude: decode Bash input: %w", err)
+	}
+	if payload.ToolInput != nil {
+		input = payload.ToolInput
+	}
+	var in struct {
+		BashToolInput
+		// The CLI reports the timeout in milliseconds.
+		TimeoutMS float64 `json:"timeout"`
+	}
+	if err := json.Unmarshal(input, &in); err != nil {
+		return nil, fmt.Errorf("claude: decode Bash input: %w", err)
+	}
+	if in.Command == "" {
+		return nil, errors.New("claude: decode Bash input: no command")
+	}
+	out := in.BashToolInput
+	out.Timeout = time.Duration(in.TimeoutMS * float64(time.Millisecond))
+	out.CWD = payload.CWD
+	return &out, nil
+}
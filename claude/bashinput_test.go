@@ -0,0 +1,33 @@
+package claude
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestParseBashInput(t *testing.T) {
+	in, err := ParseBashInput(json.RawMessage(`{"command":"go test ./...","description":"Run tests","timeout":120000,"run_in_background":true}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := BashToolInput{Command: "go test ./...", Description: "Run tests", Timeout: 2 * time.Minute, RunInBackground: true}
+	if *in != want {
+		t.Fatalf("got %+v, want %+v", *in, want)
+	}
+
+	in, err = ParseBashInput(json.RawMessage(`{"hook_event_name":"PreToolUse","cwd":"/work","tool_name":"Bash","tool_input":{"command":"ls","dangerouslyDisableSandbox":true}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want = BashToolInput{Command: "ls", DangerouslyDisableSandbox: true, CWD: "/work"}
+	if *in != want {
+		t.Fatalf("hook payload: got %+v, want %+v", *in, want)
+	}
+
+	for _, bad := range []string{`not json`, `{"file_path":"/etc/passwd"}`, `{"command":42}`} {
+		if _, err := ParseBashInput(json.RawMessage(bad)); err == nil {
+			t.Fatalf("expected an error for %s", bad)
+		}
+	}
+}
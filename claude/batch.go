@@ -0,0 +1,80 @@
+package claude
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultBatchConcurrency is how many prompts RunBatch runs at once unless
+// WithBatchConcurrency says otherwise.
+const DefaultBatchConcurrency = 4
+
+// RunBatch runs each prompt to completion and returns their Results in prompt
+// order.
+//
+// Each prompt runs as its own Run, in a fresh subprocess and conversation, so
+// prompts cannot see each other and the cost of one does not depend on the
+// others. At most WithBatchConcurrency prompts (DefaultBatchConcurrency by
+// default) run at once.
+//
+// The CLI has no batch mode, and sending many prompts into one subprocess
+// would make them one conversation whose context grows with every prompt.
+// RunBatch therefore does not reduce process-spawn overhead: it still spawns
+// one CLI per prompt, and only bounds how many run in parallel.
+//
+// Failures are isolated per prompt. When a prompt fails its Result slot is nil
+// and the returned error is a *BatchError mapping the prompt index to its
+// error; the other Results are still returned. Prompts not yet started when
+// ctx is done fail with ctx.Err().
+func RunBatch(ctx context.Context, prompts []string, opts ...Option) ([]*Result, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	limit := o.BatchConcurrency
+	if limit <= 0 {
+		limit = DefaultBatchConcurrency
+	}
+
+	results := make([]*Result, len(prompts))
+	failed := make(map[int]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, limit)
+	for i, prompt := range prompts {
+		fail := func(err error) {
+			mu.Lock()
+			failed[i] = err
+			mu.Unlock()
+		}
+		if err := ctx.Err(); err != nil {
+			fail(err)
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			fail(ctx.Err())
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			r, err := Run(ctx, prompt, opts...)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed[i] = err
+				return
+			}
+			results[i] = r
+		}()
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return results, &BatchError{Errors: failed, Total: len(prompts)}
+	}
+	return results, nil
+}
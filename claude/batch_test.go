@@ -0,0 +1,71 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunBatch_IsolatesFailures(t *testing.T) {
+	// The fake CLI counts its spawns and answers its user message; prompts
+	// containing "fail" produce an error result, and a second user message
+	// would mean prompts share a conversation.
+	exe := writeFakeCLI(t, `echo spawn >> "$SPAWNS_FILE"
+turns=0
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      turns=$((turns+1))
+      case "$line" in
+        *fail*) echo '{"type":"result","subtype":"error_during_execution","is_error":true,"errors":["boom"],"session_id":"s1"}' ;;
+        *) echo '{"type":"result","subtype":"success","result":"turn '$turns'","session_id":"s1"}' ;;
+      esac ;;
+  esac
+done
+`)
+	spawnsFile := filepath.Join(t.TempDir(), "spawns")
+
+	results, err := RunBatch(context.Background(), []string{"one", "please fail", "three"},
+		WithClaudeExecutable(exe),
+		WithEnv(map[string]string{"SPAWNS_FILE": spawnsFile}),
+		WithBatchConcurrency(2),
+	)
+
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("expected *BatchError, got %T: %v", err, err)
+	}
+	if len(batchErr.Errors) != 1 || batchErr.Errors[1] == nil {
+		t.Fatalf("expected only prompt 1 to fail, got %v", batchErr.Errors)
+	}
+	if len(results) != 3 || results[0] == nil || results[1] != nil || results[2] == nil {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if results[0].Result != "turn 1" || results[2].Result != "turn 1" {
+		t.Fatalf("expected each prompt in its own conversation, got %q and %q", results[0].Result, results[2].Result)
+	}
+
+	b, err := os.ReadFile(spawnsFile)
+	if err != nil {
+		t.Fatalf("read spawns: %v", err)
+	}
+	if n := strings.Count(string(b), "spawn"); n != 3 {
+		t.Fatalf("expected a subprocess per prompt, got %d", n)
+	}
+}
+
+func TestRunBatch_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := RunBatch(ctx, []string{"one", "two"}, WithClaudeExecutable("/does/not/exist"))
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Errors) != 2 || !errors.Is(batchErr.Errors[0], context.Canceled) {
+		t.Fatalf("expected both prompts to fail with context.Canceled, got %v", err)
+	}
+	if results[0] != nil || results[1] != nil {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+}
@@ -0,0 +1,101 @@
+package claude
+
+import "encoding/json"
+
+// CallGraph is the tree of model turns and tool calls of a run: each turn
+// holds the tool calls the model made in it, and a tool call that started a
+// subagent (the Task tool) holds the subagent's turns. Build one with
+// BuildCallGraph.
+type CallGraph struct {
+	// Turns are the top-level model turns, in order.
+	Turns []*TurnNode
+
+	toolCalls map[string]*ToolCallNode
+}
+
+// TurnNode is one model response.
+type TurnNode struct {
+	// Messages are the assistant messages of the response. The CLI may split
+	// a response into several messages sharing Message.ID.
+	Messages []*AssistantMessage
+	// ToolCalls are the tool_use blocks of the response, in order.
+	ToolCalls []*ToolCallNode
+}
+
+// ToolCallNode is one tool invocation.
+type ToolCallNode struct {
+	ID    string
+	Name  string
+	Input json.RawMessage
+	// Agent is the subagent type requested by a Task call, e.g. "Explore".
+	Agent string
+	// Result is the tool_result block fed back to the model; nil while the
+	// call has no result.
+	Result *ContentBlock
+	// Turns are the turns of the subagent this call started, in order.
+	Turns []*TurnNode
+}
+
+// BuildCallGraph assembles the call graph of events, typically everything one
+// Query or Session turn delivered. Messages are linked to the tool call that
+// started their subagent through parent_tool_use_id; the CLI reports no other
+// agent identifier in the stream. Messages whose parent is not among events are
+// placed at the top level. Other event types are ignored.
+func BuildCallGraph(events []Event) *CallGraph {
+	g := &CallGraph{toolCalls: make(map[string]*ToolCallNode)}
+	for _, e := range events {
+		switch {
+		case e.Assistant != nil:
+			g.addAssistant(e.Assistant)
+		case e.User != nil:
+			for _, b := range e.User.Message.Content {
+				if call, ok := g.toolCalls[b.ToolUseID]; ok && b.Type == "tool_result" {
+					call.Result = &b
+				}
+			}
+		}
+	}
+	return g
+}
+
+func (g *CallGraph) addAssistant(m *AssistantMessage) {
+	turns := &g.Turns
+	if m.ParentToolUseID != nil {
+		if parent, ok := g.toolCalls[*m.ParentToolUseID]; ok {
+			turns = &parent.Turns
+		}
+	}
+	var turn *TurnNode
+	if n := len(*turns); n > 0 && m.Message.ID != "" {
+		if last := (*turns)[n-1]; last.Messages[len(last.Messages)-1].Message.ID == m.Message.ID {
+			turn = last
+		}
+	}
+	if turn == nil {
+		turn = &TurnNode{}
+		*turns = append(*turns, turn)
+	}
+	turn.Messages = append(turn.Messages, m)
+
+	for _, b := range m.Message.Content {
+		if b.Type != "tool_use" {
+			continue
+		}
+		call := &ToolCallNode{ID: b.ID, Name: b.Name, Input: b.Input}
+		if b.Name == "Task" || b.Name == "Agent" {
+			var in struct {
+				SubagentType string `json:"subagent_type"`
+			}
+			if json.Unmarshal(b.Input, &in) == nil {
+				call.Agent = in.SubagentType
+			}
+		}
+		turn.ToolCalls = append(turn.ToolCalls, call)
+		g.toolCalls[b.ID] = call
+	}
+}
+
+// ToolCall returns the tool call with the given tool_use ID, or nil.
+func (g *CallGraph) ToolCall(id string) *ToolCallNode {
+	return g.toolCalls[id]
+}
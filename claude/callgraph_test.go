@@ -0,0 +1,46 @@
+package claude
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildCallGraph(t *testing.T) {
+	lines := []string{
+		`{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"text","text":"Looking."}]},"parent_tool_use_id":null}`,
+		`{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Task","input":{"subagent_type":"Explore","prompt":"find it"}},{"type":"tool_use","id":"t2","name":"Read","input":{"file_path":"a.go"}}]},"parent_tool_use_id":null}`,
+		`{"type":"assistant","message":{"id":"s1","role":"assistant","content":[{"type":"tool_use","id":"t3","name":"Grep","input":{"pattern":"x"}}]},"parent_tool_use_id":"t1"}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t3","content":"a.go:1"}]},"parent_tool_use_id":"t1"}`,
+		`{"type":"assistant","message":{"id":"s2","role":"assistant","content":[{"type":"text","text":"In a.go"}]},"parent_tool_use_id":"t1"}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"In a.go"},{"type":"tool_result","tool_use_id":"t2","content":"denied","is_error":true}]},"parent_tool_use_id":null}`,
+		`{"type":"assistant","message":{"id":"m2","role":"assistant","content":[{"type":"text","text":"Done."}]},"parent_tool_use_id":null}`,
+		`{"type":"result","subtype":"success","result":"Done."}`,
+	}
+	var events []Event
+	for e := range ReplayFromReader(strings.NewReader(strings.Join(lines, "\n"))).Events() {
+		events = append(events, e)
+	}
+
+	g := BuildCallGraph(events)
+	if len(g.Turns) != 2 {
+		t.Fatalf("expected 2 top-level turns, got %d", len(g.Turns))
+	}
+	first := g.Turns[0]
+	if len(first.Messages) != 2 || len(first.ToolCalls) != 2 {
+		t.Fatalf("expected the split response as one turn with 2 tool calls, got %d messages, %d calls",
+			len(first.Messages), len(first.ToolCalls))
+	}
+	task := first.ToolCalls[0]
+	if task.Name != "Task" || task.Agent != "Explore" || task.Result == nil || task.Result.ResultText() != "In a.go" {
+		t.Fatalf("unexpected Task node %+v", task)
+	}
+	if len(task.Turns) != 2 || len(task.Turns[0].ToolCalls) != 1 || task.Turns[0].ToolCalls[0].Name != "Grep" {
+		t.Fatalf("expected the subagent's 2 turns under the Task call, got %+v", task.Turns)
+	}
+	if g.ToolCall("t3").Result == nil {
+		t.Fatal("expected the subagent's Grep call to have its result")
+	}
+	if read := g.ToolCall("t2"); read.Result == nil || !read.Result.IsError {
+		t.Fatalf("expected the Read call to carry its error result, got %+v", read.Result)
+	}
+}
@@ -1,11 +1,16 @@
 package claude
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Stream represents an active claude subprocess streaming session.
@@ -17,22 +22,238 @@ import (
 // may be called concurrently from any goroutine while the stream is active.
 type Stream struct {
 	events    chan Event
+	view      <-chan Event // replaces events for consumers when set (TeeToWriter, Subscribe)
 	write     func(any) error
 	ctx       context.Context
+	requestID string
+	prefill   string // written after each user message (WithResponsePrefill)
+	seedID    string // session ID to stamp on user messages before the CLI reports one
 	interrupt func() // graceful shutdown trigger (idempotent)
+	softStop  func() // closes stdin without signalling the subprocess (idempotent)
+
+	// interruptReason is set by InterruptWithReason.
+	interruptReason atomic.Pointer[string]
 
 	// pending maps request_id → response channel for blocking control requests.
 	pending   map[string]chan controlResponse
 	pendingMu sync.Mutex
+
+	// done is closed once the subprocess has exited; interruptCh is closed when
+	// Interrupt/Close was called or the context was cancelled.
+	done        chan struct{}
+	interruptCh chan struct{}
+
+	// softStopCh is closed when SoftStop was called.
+	softStopCh chan struct{}
+
+	// drainOnce starts the Drain goroutine at most once.
+	drainOnce sync.Once
+
+	// partial feeds PartialStructured; nil until it is first called.
+	partial     atomic.Pointer[partialStructured]
+	partialOnce sync.Once
+
+	// thinking feeds ThinkingReader; nil until it is first called.
+	thinking     atomic.Pointer[thinkingBuffer]
+	thinkingOnce sync.Once
+
+	// turnIDs holds the correlation IDs of turns sent by Session, oldest
+	// first; the head belongs to the turn in progress. turnIdle is open while
+	// turnIDs is not empty. Both are guarded by turnIDsMu.
+	turnIDs   []string
+	turnIdle  chan struct{}
+	turnIDsMu sync.Mutex
+
+	// unresponsive is set when the last keep-alive ping went unanswered.
+	unresponsive atomic.Bool
+
+	// contextTokens is the context size of the latest model call, and
+	// transcript the events kept for the WithAutoCompaction summarizer.
+	contextTokens atomic.Int64
+	transcript    []Event
+	transcriptMu  sync.Mutex
+
+	// compactMetadata is the last compact_boundary's metadata, held for the
+	// summary that follows it. Only the delivery goroutine uses it.
+	compactMetadata *CompactMetadata
+
+	// turnTimer interrupts the current turn when WithPerTurnTimeout is set;
+	// turnErr records that it, or a WithToolTimeout watchdog, fired. Both are
+	// guarded by turnMu.
+	turnTimer *time.Timer
+	turnErr   error
+	turnMu    sync.Mutex
+
+	// fan copies events to Subscribe channels; created by the first Subscribe.
+	fan     *fanout
+	fanOnce sync.Once
+
+	// tracer records spans when a Tracer is configured; nil otherwise.
+	tracer *runTracer
+
+	// exitErr is the cmd.Wait error; it is only read after done is closed.
+	exitErr error
+
+	// err is why the stream ended abnormally; see Err. transcriptErr is a
+	// TeeToWriter write error, reported only when err is nil. Both are guarded
+	// by errMu.
+	err           error
+	transcriptErr error
+	errMu         sync.Mutex
+
+	// sessionID is the most recent session ID reported by the CLI.
+	sessionID   string
+	sessionIDMu sync.Mutex
+
+	// initMsg is the first init system message; initCh is closed once it arrives.
+	initMsg  *SystemMessage
+	initCh   chan struct{}
+	initOnce sync.Once
 }
 
 // Events returns the receive-only channel of events streamed from the subprocess.
 // The channel is closed when the session ends. Callers should always range until
 // the channel closes.
 func (s *Stream) Events() <-chan Event {
+	if s.view != nil {
+		return s.view
+	}
 	return s.events
 }
 
+// RequestID returns the run's correlation ID: the value passed to
+// WithRequestID, or a generated one when it was not set.
+func (s *Stream) RequestID() string {
+	return s.requestID
+}
+
+// Err returns why the stream ended, in the spirit of bufio.Scanner.Err. Call it
+// after the Events() channel has closed:
+//   - nil: the stream ended cleanly (result received, or Close/Interrupt/SoftStop)
+//   - ctx.Err(): the context was cancelled before the run finished
+//   - *ProcessError: the subprocess exited with an error before a result
+//     (wrapped in an *AuthRequiredError when the CLI is not authenticated)
+//   - *InterruptedError: InterruptWithReason stopped the run before a result
+//   - any other error: reading the subprocess output (or, when the stream
+//     otherwise ended cleanly, writing a TeeToWriter transcript) failed
+func (s *Stream) Err() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	if s.err == nil {
+		return s.transcriptErr
+	}
+	return s.err
+}
+
+func (s *Stream) setErr(err error) {
+	s.errMu.Lock()
+	s.err = err
+	s.errMu.Unlock()
+}
+
+// SessionID returns the most recent session ID reported by the CLI, or "" if
+// no message carrying a session ID has been received yet.
+func (s *Stream) SessionID() string {
+	s.sessionIDMu.Lock()
+	defer s.sessionIDMu.Unlock()
+	return s.sessionID
+}
+
+// recordSessionID remembers the session ID carried by e, if any.
+func (s *Stream) recordSessionID(e Event) {
+	id := sessionIDOf(e)
+	if id == "" {
+		return
+	}
+	s.sessionIDMu.Lock()
+	s.sessionID = id
+	s.sessionIDMu.Unlock()
+}
+
+// recordInit stores the first init system message and unblocks Capabilities.
+// It reports whether m was the first init message.
+func (s *Stream) recordInit(m *SystemMessage) bool {
+	first := false
+	s.initOnce.Do(func() {
+		s.initMsg = m
+		close(s.initCh)
+		first = true
+	})
+	return first
+}
+
+// Capabilities blocks until the CLI's init message arrives and returns the
+// tools, agents, skills, plugins, slash commands, betas, and model it reports.
+// Returns an error if the stream ends before init or the context is cancelled.
+func (s *Stream) Capabilities() (Capabilities, error) {
+	select {
+	case <-s.initCh:
+	case <-s.done:
+		select {
+		case <-s.initCh:
+		default:
+			return Capabilities{}, fmt.Errorf("claude: capabilities: stream ended before init message")
+		}
+	case <-s.ctx.Done():
+		return Capabilities{}, s.ctx.Err()
+	}
+	m := s.initMsg
+	return Capabilities{
+		Model:         m.Model,
+		Tools:         m.Tools,
+		Agents:        m.Agents,
+		Skills:        m.Skills,
+		Plugins:       m.Plugins,
+		SlashCommands: m.SlashCommands,
+		Betas:         m.Betas,
+	}, nil
+}
+
+// exited reports whether the subprocess has exited.
+func (s *Stream) exited() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// interrupted reports whether shutdown was requested via Interrupt, Close, or
+// context cancellation.
+func (s *Stream) interrupted() bool {
+	select {
+	case <-s.interruptCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeRequested reports whether the caller asked the stream to end, either
+// immediately (interrupted) or after the current turn (SoftStop).
+func (s *Stream) closeRequested() bool {
+	if s.interrupted() {
+		return true
+	}
+	select {
+	case <-s.softStopCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// closedError describes why the stream can no longer accept messages.
+func (s *Stream) closedError() *SessionClosedError {
+	var err error
+	if s.exited() {
+		err = s.exitErr
+	}
+	clean := s.closeRequested() || s.ctx.Err() != nil
+	return &SessionClosedError{Crashed: err != nil && !clean, Err: err}
+}
+
 // SetModel asks the claude CLI to switch to a different model mid-session.
 // Blocks until the CLI acknowledges the change or the context is cancelled.
 func (s *Stream) SetModel(model string) error {
@@ -57,12 +278,44 @@ func (s *Stream) SetMaxThinkingTokens(n int) error {
 
 // Interrupt initiates graceful shutdown of the session: stdin is closed and
 // SIGTERM is sent to the claude subprocess. If the process does not exit within
-// 5 seconds, SIGKILL is sent. Interrupt is idempotent.
+// 5 seconds, or WithShutdownTimeout, SIGKILL is sent. Interrupt is idempotent.
 func (s *Stream) Interrupt() error {
 	s.interrupt()
 	return nil
 }
 
+// InterruptWithReason is Interrupt, recording why: InterruptReason returns
+// reason, and if the stream ends without a result, Err (and Run) return an
+// *InterruptedError carrying it, as does the tracer's span status. The reason
+// stays in the SDK; the CLI's interrupt has no field for it. Only the first
+// reason is kept.
+func (s *Stream) InterruptWithReason(reason string) error {
+	s.interruptReason.CompareAndSwap(nil, &reason)
+	s.interrupt()
+	return nil
+}
+
+// InterruptReason returns the reason given to InterruptWithReason, or "".
+func (s *Stream) InterruptReason() string {
+	if r := s.interruptReason.Load(); r != nil {
+		return *r
+	}
+	return ""
+}
+
+// SoftStop lets the in-flight turn finish and then ends the stream. stdin is
+// closed so no further messages or turns can be sent, but the subprocess is not
+// signalled: the current turn's events, including its TypeResult, are still
+// delivered, after which the CLI exits and the Events() channel closes.
+//
+// Contrast with Interrupt, which sends SIGTERM immediately (SIGKILL after 5 s
+// by default) and may discard the answer being produced. If the turn does not
+// finish in time, call Interrupt afterwards to force shutdown. SoftStop is idempotent.
+func (s *Stream) SoftStop() error {
+	s.softStop()
+	return nil
+}
+
 // Close gracefully shuts down the stream. It is equivalent to Interrupt and is
 // idempotent. Provided as a more semantically appropriate name when using Session.
 func (s *Stream) Close() error {
@@ -70,12 +323,63 @@ func (s *Stream) Close() error {
 	return nil
 }
 
+// Drain abandons the stream: it interrupts the run as Interrupt does and
+// consumes the remaining events in the background, so the reader goroutine
+// never blocks on an unread Events() channel and the subprocess is reaped.
+// Call it instead of finishing the range when breaking out of an event loop
+// early. After Drain the stream is unusable: its events are discarded and the
+// Events() channel must not be read. Drain is idempotent.
+func (s *Stream) Drain() {
+	s.interrupt()
+	s.drainOnce.Do(func() {
+		go func() {
+			for range s.Events() {
+			}
+		}()
+	})
+}
+
 // SendUserMessage injects an additional user message into the running subprocess.
 // In single-turn (Query/Run) usage this can be called mid-stream (before TypeResult
 // is emitted) to inject extra context — matching TypeScript's streamInput().
 // For persistent multi-turn usage prefer Session.Send which wraps this method.
 func (s *Stream) SendUserMessage(msg string) error {
-	return s.write(userMsg(msg))
+	s.tracer.startTurn()
+	return writeUserTurn(s.write, msg, s.prefill, cmp.Or(s.SessionID(), s.seedID))
+}
+
+// sendCorrelatedTurn sends msg as a new turn whose events carry id as their
+// CorrelationID. The CLI answers turns in order, one TypeResult each, so the
+// queue head always belongs to the turn being streamed.
+func (s *Stream) sendCorrelatedTurn(msg, id string) error {
+	s.turnIDsMu.Lock()
+	s.turnIDs = append(s.turnIDs, id)
+	s.updateTurnIdle()
+	s.turnIDsMu.Unlock()
+	err := s.SendUserMessage(msg)
+	if err != nil {
+		// Nothing was sent, so no result will pop the entry; drop it here.
+		s.turnIDsMu.Lock()
+		s.turnIDs = s.turnIDs[:len(s.turnIDs)-1]
+		s.updateTurnIdle()
+		s.turnIDsMu.Unlock()
+	}
+	return err
+}
+
+// correlate returns the correlation ID for e and retires it once e ends the turn.
+func (s *Stream) correlate(e Event) string {
+	s.turnIDsMu.Lock()
+	defer s.turnIDsMu.Unlock()
+	if len(s.turnIDs) == 0 {
+		return ""
+	}
+	id := s.turnIDs[0]
+	if e.Type == TypeResult {
+		s.turnIDs = s.turnIDs[1:]
+		s.updateTurnIdle()
+	}
+	return id
 }
 
 // RewindFiles asks the CLI to rewind files to the state at the given user message ID.
@@ -110,22 +414,22 @@ func (s *Stream) SetMcpServers(servers map[string]any) error {
 // SupportedModels queries the CLI for the list of supported models.
 // Returns the raw JSON response body.
 func (s *Stream) SupportedModels() (json.RawMessage, error) {
-	return s.sendControlRequestWithResponse("supported_models", nil)
+	return s.Control("supported_models", nil)
 }
 
 // SupportedCommands queries the CLI for the list of supported commands.
 func (s *Stream) SupportedCommands() (json.RawMessage, error) {
-	return s.sendControlRequestWithResponse("supported_commands", nil)
+	return s.Control("supported_commands", nil)
 }
 
 // SupportedAgents queries the CLI for the list of supported agents.
 func (s *Stream) SupportedAgents() (json.RawMessage, error) {
-	return s.sendControlRequestWithResponse("supported_agents", nil)
+	return s.Control("supported_agents", nil)
 }
 
 // AccountInfo queries the CLI for the current account information.
 func (s *Stream) AccountInfo() (json.RawMessage, error) {
-	return s.sendControlRequestWithResponse("account_info", nil)
+	return s.Control("account_info", nil)
 }
 
 // StopTask asks the CLI to stop a running background task.
@@ -135,9 +439,26 @@ func (s *Stream) StopTask(taskID string) error {
 	})
 }
 
-// sendControlRequestWithResponse is like sendControlRequest but returns the raw
-// JSON response body on success.
-func (s *Stream) sendControlRequestWithResponse(subtype string, extras map[string]any) (json.RawMessage, error) {
+// Control sends a control_request with the given subtype and payload fields and
+// blocks until the CLI replies or the context is cancelled. It returns the raw
+// JSON response body on success. Use it to call control subtypes the SDK does
+// not model yet; the typed methods (SetModel, SupportedModels, ...) are built
+// on top of it.
+func (s *Stream) Control(subtype string, payload map[string]any) (json.RawMessage, error) {
+	resp, err := s.control(s.ctx, subtype, payload)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("claude: %s: %s", subtype, resp.Error)
+	}
+	return resp.Body, nil
+}
+
+// control writes a control_request and waits for the matching response. err is
+// non-nil only when the request could not be written or ctx ended first; an
+// error reply from the CLI is returned as a response with Success false.
+func (s *Stream) control(ctx context.Context, subtype string, payload map[string]any) (controlResponse, error) {
 	reqID := newUUID()
 	respCh := make(chan controlResponse, 1)
 
@@ -146,7 +467,7 @@ func (s *Stream) sendControlRequestWithResponse(subtype string, extras map[strin
 	s.pendingMu.Unlock()
 
 	req := map[string]any{"subtype": subtype}
-	for k, v := range extras {
+	for k, v := range payload {
 		req[k] = v
 	}
 
@@ -159,28 +480,88 @@ func (s *Stream) sendControlRequestWithResponse(subtype string, extras map[strin
 		s.pendingMu.Lock()
 		delete(s.pending, reqID)
 		s.pendingMu.Unlock()
-		return nil, fmt.Errorf("claude: %s: %w", subtype, err)
+		return controlResponse{}, fmt.Errorf("claude: %s: %w", subtype, err)
 	}
 
 	select {
 	case resp := <-respCh:
-		if !resp.Success {
-			return nil, fmt.Errorf("claude: %s: %s", subtype, resp.Error)
-		}
-		return resp.Body, nil
-	case <-s.ctx.Done():
+		return resp, nil
+	case <-ctx.Done():
 		s.pendingMu.Lock()
 		delete(s.pending, reqID)
 		s.pendingMu.Unlock()
-		return nil, s.ctx.Err()
+		return controlResponse{}, ctx.Err()
 	}
 }
 
+// startTurnTimer arms the per-turn deadline for the turn that was just sent.
+// When it expires before the turn's result arrives, the CLI is asked to
+// interrupt the turn; the process keeps running.
+func (s *Stream) startTurnTimer(d time.Duration) {
+	s.turnMu.Lock()
+	defer s.turnMu.Unlock()
+	if s.turnTimer != nil {
+		s.turnTimer.Stop()
+	}
+	s.turnErr = nil
+	var timer *time.Timer
+	timer = time.AfterFunc(d, func() {
+		s.turnMu.Lock()
+		if s.turnTimer != timer {
+			s.turnMu.Unlock()
+			return
+		}
+		s.turnErr = &TurnTimeoutError{Timeout: d}
+		s.turnMu.Unlock()
+		_ = s.sendControlRequest("interrupt", nil)
+	})
+	s.turnTimer = timer
+}
+
+// endTurn disarms the per-turn deadline once the turn's result arrives.
+func (s *Stream) endTurn() {
+	s.turnMu.Lock()
+	defer s.turnMu.Unlock()
+	if s.turnTimer != nil {
+		s.turnTimer.Stop()
+		s.turnTimer = nil
+	}
+}
+
+// clearTurnErr forgets the error of the previous turn.
+func (s *Stream) clearTurnErr() {
+	s.turnMu.Lock()
+	defer s.turnMu.Unlock()
+	s.turnErr = nil
+}
+
+// lastTurnErr returns the *TurnTimeoutError or *ToolTimeoutError of the most
+// recent turn, if any.
+func (s *Stream) lastTurnErr() error {
+	s.turnMu.Lock()
+	defer s.turnMu.Unlock()
+	return s.turnErr
+}
+
+// keepAliveSubtype is the read-only control request used as a liveness probe.
+const keepAliveSubtype = "mcp_status"
+
+// ping sends a keep-alive probe and reports whether the CLI replied within
+// timeout. Any reply counts, including an error reply: it proves the process is
+// still reading stdin. The outcome is recorded for Session.Alive.
+func (s *Stream) ping(timeout time.Duration) bool {
+	ctx, cancel := context.WithTimeout(s.ctx, timeout)
+	defer cancel()
+	_, err := s.control(ctx, keepAliveSubtype, nil)
+	s.unresponsive.Store(err != nil)
+	return err == nil
+}
+
 // sendControlRequest writes a control_request with the given subtype and extra
 // fields, then blocks until a matching control_response arrives or the ctx
 // is cancelled.
 func (s *Stream) sendControlRequest(subtype string, extras map[string]any) error {
-	_, err := s.sendControlRequestWithResponse(subtype, extras)
+	_, err := s.Control(subtype, extras)
 	return err
 }
 
@@ -211,6 +592,11 @@ func Query(ctx context.Context, prompt string, opts ...Option) (*Stream, error)
 	for _, opt := range opts {
 		opt(o)
 	}
+	if o.ModelRouter != nil {
+		if model := o.ModelRouter(prompt); model != "" {
+			o.Model = model
+		}
+	}
 	return spawnAndStream(ctx, o, prompt)
 }
 
@@ -221,7 +607,10 @@ func Query(ctx context.Context, prompt string, opts ...Option) (*Stream, error)
 // are discarded. Use Query directly if you need to process them.
 //
 // Errors from the subprocess itself (bad flags, auth failures, crashes) are
-// surfaced as Go errors so callers always get a meaningful message.
+// surfaced as Go errors so callers always get a meaningful message. A run
+// refused by a rate or usage limit fails with a *RateLimitError, or is retried
+// once the limit resets when WithRateLimitRetry is set. A run whose model is
+// overloaded is retried on the next model of WithModelFallbackChain.
 //
 // Example:
 //
@@ -233,33 +622,146 @@ func Query(ctx context.Context, prompt string, opts ...Option) (*Stream, error)
 //	fmt.Println(result.Result)
 //	fmt.Println("session:", result.SessionID)
 func Run(ctx context.Context, prompt string, opts ...Option) (*Result, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	fallbacks := o.fallbackChain()
+	attempt := opts
+	for waits := 0; ; {
+		result, err := runOnce(ctx, prompt, attempt)
+		if err == nil && o.ValidateOutput && o.structuredOutput() {
+			if err := o.OutputFormat.Validate(result.StructuredOutput); err != nil {
+				return result, err
+			}
+		}
+		var rlErr *RateLimitError
+		if !errors.As(err, &rlErr) && len(fallbacks) > 0 && modelUnavailable(err) {
+			attempt = append(slices.Clip(opts), withFallbackAttempt(fallbacks[0]))
+			fallbacks = fallbacks[1:]
+			continue
+		}
+		if rlErr == nil || waits >= o.RateLimitRetries {
+			return result, err
+		}
+		wait := time.Until(rlErr.ResetsAt)
+		if rlErr.ResetsAt.IsZero() {
+			wait = rateLimitBackoff(waits)
+		}
+		waits++
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Backoff used by Run for a rate limit with no known reset time: the first
+// wait is rateLimitBaseDelay and each further wait doubles it, up to
+// rateLimitMaxDelay.
+var (
+	rateLimitBaseDelay = 30 * time.Second
+	rateLimitMaxDelay  = 30 * time.Minute
+)
+
+// rateLimitBackoff returns how long Run waits before retry number waits+1.
+// It doubles by hand rather than shifting so a large retry count cannot
+// overflow the duration into zero or a negative wait.
+func rateLimitBackoff(waits int) time.Duration {
+	delay := rateLimitBaseDelay
+	for i := 0; i < waits && delay < rateLimitMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, rateLimitMaxDelay)
+}
+
+// runOnce performs a single Run attempt.
+func runOnce(ctx context.Context, prompt string, opts []Option) (*Result, error) {
 	stream, err := Query(ctx, prompt, opts...)
 	if err != nil {
 		return nil, err
 	}
+	return awaitResult(stream)
+}
 
+// awaitResult consumes stream's events up to the first result and returns it,
+// or the error that ended the run.
+func awaitResult(stream *Stream) (*Result, error) {
+	// rejected is the last rate_limit_event that refused the run, if any.
+	var rejected *RateLimitInfo
 	for event := range stream.Events() {
 		switch event.Type {
 
 		case TypeResult:
-			r := event.Result
-			if r.IsError {
-				msg := r.Subtype
-				if len(r.Errors) > 0 {
-					msg = strings.Join(r.Errors, "; ")
+			var toolErr *ToolTimeoutError
+			if errors.As(stream.lastTurnErr(), &toolErr) {
+				return nil, toolErr
+			}
+			if err := resultError(event.Result); err != nil {
+				if rlErr := rateLimitError(err, rejected, err.Error()); rlErr != nil {
+					return nil, rlErr
+				}
+				return nil, err
+			}
+			return event.Result, nil
+
+		case TypeRateLimitEvent:
+			// A later event that no longer rejects the run clears the limit.
+			if event.RateLimit != nil {
+				rejected = nil
+				if event.RateLimit.RateLimitInfo.Status == RateLimitStatusRejected {
+					rejected = &event.RateLimit.RateLimitInfo
 				}
-				return nil, fmt.Errorf("claude: agent error (%s): %s", r.Subtype, msg)
 			}
-			return r, nil
 
 		case TypeSystem:
 			// Surface process-level errors (bad flag, auth failure, crash) that
 			// were synthesised by spawnAndStream because no result message arrived.
 			if event.System != nil && event.System.Subtype == "error" {
-				return nil, fmt.Errorf("claude: %s", event.System.Message)
+				if authErr := authError(event.System.Message); authErr != nil {
+					return nil, authErr
+				}
+				err := fmt.Errorf("claude: %s", event.System.Message)
+				if rlErr := rateLimitError(err, rejected, event.System.Message); rlErr != nil {
+					return nil, rlErr
+				}
+				return nil, err
 			}
 		}
 	}
 
+	var interrupted *InterruptedError
+	var tooLarge *MessageTooLargeError
+	var transform *resultTransformError
+	if err := stream.Err(); errors.As(err, &interrupted) || errors.As(err, &tooLarge) || errors.As(err, &transform) {
+		return nil, err
+	}
 	return nil, fmt.Errorf("claude: agent finished without a result message")
 }
+
+// resultError returns the error described by an error Result, or nil when r
+// reports success.
+//
+// Authentication failures are returned as *AuthRequiredError.
+func resultError(r *Result) error {
+	if !r.IsError {
+		return nil
+	}
+	msg := r.Subtype
+	if len(r.Errors) > 0 {
+		parts := make([]string, len(r.Errors))
+		for i, e := range r.Errors {
+			parts[i] = e.String()
+		}
+		msg = strings.Join(parts, "; ")
+	} else if r.Result != "" {
+		msg = r.Result
+	}
+	if authErr := authError(msg); authErr != nil {
+		return authErr
+	}
+	return &agentError{subtype: r.Subtype, errors: r.Errors, msg: msg}
+}
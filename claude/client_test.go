@@ -0,0 +1,550 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestQuery_RequestID(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"ok"}'
+      exit 0 ;;
+  esac
+done
+`)
+	ctx := context.Background()
+
+	stream, err := Query(ctx, "hi", WithClaudeExecutable(exe), WithRequestID("req-42"))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for range stream.Events() {
+	}
+	if got := stream.RequestID(); got != "req-42" {
+		t.Fatalf("expected request ID req-42, got %q", got)
+	}
+
+	stream, err = Query(ctx, "hi", WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for range stream.Events() {
+	}
+	if stream.RequestID() == "" {
+		t.Fatal("expected a generated request ID")
+	}
+}
+
+func TestStreamControl_RoundTrip(t *testing.T) {
+	s := &Stream{
+		ctx:     context.Background(),
+		pending: make(map[string]chan controlResponse),
+	}
+	var sent map[string]any
+	s.write = func(v any) error {
+		sent = v.(map[string]any)
+		reqID := sent["request_id"].(string)
+		go routeControlResponse([]byte(fmt.Sprintf(
+			`{"type":"control_response","request_id":%q,"response":{"subtype":"success","value":42}}`, reqID)), s)
+		return nil
+	}
+
+	body, err := s.Control("future_subtype", map[string]any{"flag": true})
+	if err != nil {
+		t.Fatalf("Control: %v", err)
+	}
+	req := sent["request"].(map[string]any)
+	if req["subtype"] != "future_subtype" || req["flag"] != true {
+		t.Fatalf("unexpected request: %v", req)
+	}
+	var resp struct {
+		Value int `json:"value"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || resp.Value != 42 {
+		t.Fatalf("unexpected response body %s (err %v)", body, err)
+	}
+}
+
+func TestStreamErr(t *testing.T) {
+	ok := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"ok"}'
+      exit 0 ;;
+  esac
+done
+`)
+	// Reads the initialize message, then fails like a CLI rejecting a flag.
+	crash := writeFakeCLI(t, `read -r line
+echo "fatal: bad flag" >&2
+exit 2
+`)
+
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(ok))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for range stream.Events() {
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("expected clean end, got %v", err)
+	}
+
+	stream, err = Query(context.Background(), "", WithClaudeExecutable(crash))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for range stream.Events() {
+	}
+	var procErr *ProcessError
+	if !errors.As(stream.Err(), &procErr) {
+		t.Fatalf("expected *ProcessError, got %T: %v", stream.Err(), stream.Err())
+	}
+	if procErr.ExitCode != 2 || procErr.Stderr != "fatal: bad flag" {
+		t.Fatalf("unexpected process error: %+v", procErr)
+	}
+}
+
+func TestQuery_RawEventHook(t *testing.T) {
+	exe := writeFakeCLI(t, `echo 'not json'
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"ok"}'
+      exit 0 ;;
+  esac
+done
+`)
+	var lines []string
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe), WithRawEventHook(func(line []byte) {
+		lines = append(lines, string(line))
+	}))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for range stream.Events() {
+	}
+	want := []string{"not json", `{"type":"result","subtype":"success","result":"ok"}`}
+	if !slices.Equal(lines, want) {
+		t.Fatalf("expected raw lines %q, got %q", want, lines)
+	}
+}
+
+func TestStreamDrain(t *testing.T) {
+	// Emits more events than the channel buffers, then waits for stdin to close.
+	exe := writeFakeCLI(t, `read -r line
+i=0
+while [ $i -lt 100 ]; do
+  echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"x"}]}}'
+  i=$((i+1))
+done
+cat >/dev/null
+`)
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for range stream.Events() {
+		break
+	}
+	stream.Drain()
+	stream.Drain()
+	select {
+	case <-stream.done:
+	case <-time.After(3 * time.Second):
+		t.Fatal("subprocess still running after Drain")
+	}
+}
+
+func TestRun_AuthRequired(t *testing.T) {
+	tests := []struct {
+		name   string
+		prompt string
+		script string
+		kind   AuthKind
+	}{
+		{
+			name:   "invalid api key result",
+			prompt: "hi",
+			script: `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","is_error":true,"result":"Invalid API key · Please run /login"}'
+      exit 0 ;;
+  esac
+done
+`,
+			kind: AuthKindAPIKey,
+		},
+		{
+			name: "expired oauth on exit",
+			script: `read -r line
+echo "OAuth token has expired. Please obtain a new token or refresh your existing token." >&2
+exit 1
+`,
+			kind: AuthKindOAuth,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			exe := writeFakeCLI(t, tc.script)
+			_, err := Run(context.Background(), tc.prompt, WithClaudeExecutable(exe))
+			var authErr *AuthRequiredError
+			if !errors.As(err, &authErr) {
+				t.Fatalf("expected *AuthRequiredError, got %T: %v", err, err)
+			}
+			if authErr.Kind != tc.kind || authErr.Hint() == "" {
+				t.Fatalf("unexpected auth error: %+v", authErr)
+			}
+		})
+	}
+}
+
+func TestAuthError_Unrelated(t *testing.T) {
+	if authError("tool execution failed: exit status 1") != nil {
+		t.Fatal("expected no auth error for an unrelated message")
+	}
+}
+
+func TestQuery_ControlRequestsAnsweredWhileConsumerPaused(t *testing.T) {
+	// Floods more events than the channel buffers, then asks for permission
+	// and only finishes once the answer arrives.
+	exe := writeFakeCLI(t, `read -r line
+read -r line
+i=0
+while [ $i -lt 100 ]; do
+  echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"x"}]}}'
+  i=$((i+1))
+done
+echo '{"type":"control_request","request_id":"perm-1","request":{"subtype":"can_use_tool","tool_name":"Bash","tool_use_id":"tu1","input":{}}}'
+while IFS= read -r line; do
+  case "$line" in
+    *'"request_id":"perm-1"'*)
+      echo '{"type":"result","subtype":"success","result":"answered"}'
+      exit 0 ;;
+  esac
+done
+`)
+	asked := make(chan struct{})
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe),
+		WithPermissionHandler(func(string, json.RawMessage, PermissionContext) PermissionResult {
+			close(asked)
+			return PermissionResult{Behavior: "allow"}
+		}))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	select {
+	case <-asked:
+	case <-time.After(3 * time.Second):
+		stream.Drain()
+		t.Fatal("permission request was not handled while Events() was unread")
+	}
+	var result *Result
+	for e := range stream.Events() {
+		if e.Result != nil {
+			result = e.Result
+		}
+	}
+	if result == nil || result.Result != "answered" {
+		t.Fatalf("expected the run to finish after the answer, got %+v", result)
+	}
+}
+
+func TestRun_RateLimitRetry(t *testing.T) {
+	// Rejects the first run with a rate_limit_event that has already reset,
+	// then succeeds.
+	marker := filepath.Join(t.TempDir(), "limited")
+	exe := writeFakeCLI(t, fmt.Sprintf(`while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      if [ ! -e %[1]q ]; then
+        touch %[1]q
+        echo '{"type":"rate_limit_event","rate_limit_info":{"status":"rejected","resetsAt":%[2]d,"rateLimitType":"five_hour"}}'
+        echo '{"type":"result","subtype":"success","is_error":true,"result":"Rate limit reached"}'
+      else
+        echo '{"type":"result","subtype":"success","result":"ok"}'
+      fi
+      exit 0 ;;
+  esac
+done
+`, marker, time.Now().Add(-time.Second).Unix()))
+
+	_, err := Run(context.Background(), "hi", WithClaudeExecutable(exe))
+	var rlErr *RateLimitError
+	if !errors.As(err, &rlErr) || rlErr.ResetsAt.IsZero() {
+		t.Fatalf("expected *RateLimitError with a reset time, got %T: %v", err, err)
+	}
+
+	if err := os.Remove(marker); err != nil {
+		t.Fatal(err)
+	}
+	result, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithRateLimitRetry(1))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Result != "ok" {
+		t.Fatalf("expected the retried run's result, got %q", result.Result)
+	}
+}
+
+func TestRun_RateLimitRetryWithoutResetTime(t *testing.T) {
+	oldDelay := rateLimitBaseDelay
+	rateLimitBaseDelay = 100 * time.Millisecond
+	defer func() { rateLimitBaseDelay = oldDelay }()
+
+	marker := filepath.Join(t.TempDir(), "limited")
+	exe := writeFakeCLI(t, fmt.Sprintf(`while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      if [ ! -e %[1]q ]; then
+        touch %[1]q
+        echo '{"type":"rate_limit_event","rate_limit_info":{"status":"rejected","rateLimitType":"five_hour"}}'
+        echo '{"type":"result","subtype":"success","is_error":true,"result":"Rate limit reached"}'
+      else
+        echo '{"type":"result","subtype":"success","result":"ok"}'
+      fi
+      exit 0 ;;
+  esac
+done
+`, marker))
+
+	start := time.Now()
+	result, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithRateLimitRetry(1))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Result != "ok" {
+		t.Fatalf("expected the retried run's result, got %q", result.Result)
+	}
+	if elapsed := time.Since(start); elapsed < rateLimitBaseDelay {
+		t.Fatalf("retried after %v, want a backoff of at least %v", elapsed, rateLimitBaseDelay)
+	}
+}
+
+// TestRateLimitBackoff checks that the backoff doubles from the base delay
+// and stays capped, rather than overflowing, for a large retry count.
+func TestRateLimitBackoff(t *testing.T) {
+	if got := rateLimitBackoff(0); got != rateLimitBaseDelay {
+		t.Errorf("rateLimitBackoff(0) = %v, want %v", got, rateLimitBaseDelay)
+	}
+	if got := rateLimitBackoff(2); got != 4*rateLimitBaseDelay {
+		t.Errorf("rateLimitBackoff(2) = %v, want %v", got, 4*rateLimitBaseDelay)
+	}
+	for _, waits := range []int{10, 28, 40, 64, 1000} {
+		if got := rateLimitBackoff(waits); got != rateLimitMaxDelay {
+			t.Errorf("rateLimitBackoff(%d) = %v, want the cap %v", waits, got, rateLimitMaxDelay)
+		}
+	}
+}
+
+// TestRun_RateLimitCleared checks that an error after the limit was lifted is
+// not reported as a *RateLimitError.
+func TestRun_RateLimitCleared(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"rate_limit_event","rate_limit_info":{"status":"rejected","resetsAt":1,"rateLimitType":"five_hour"}}'
+      echo '{"type":"rate_limit_event","rate_limit_info":{"status":"allowed","rateLimitType":"five_hour"}}'
+      echo '{"type":"result","subtype":"error_during_execution","is_error":true,"result":"tool crashed"}'
+      exit 0 ;;
+  esac
+done
+`)
+	_, err := Run(context.Background(), "hi", WithClaudeExecutable(exe))
+	var rlErr *RateLimitError
+	if err == nil || errors.As(err, &rlErr) {
+		t.Fatalf("expected a plain error, got %T: %v", err, err)
+	}
+}
+
+func TestRun_ModelFallbackChain(t *testing.T) {
+	// Every model but haiku is overloaded. The log records the --model and
+	// --fallback-model of each attempt.
+	log := filepath.Join(t.TempDir(), "attempts")
+	exe := writeFakeCLI(t, fmt.Sprintf(`model=; fallback=; prev=
+for a in "$@"; do
+  [ "$prev" = --model ] && model=$a
+  [ "$prev" = --fallback-model ] && fallback=$a
+  prev=$a
+done
+echo "$model/$fallback" >> %q
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      printf '%%s\n' "{\"type\":\"system\",\"subtype\":\"init\",\"session_id\":\"s1\",\"model\":\"$model\"}"
+      if [ "$model" = haiku ]; then
+        echo '{"type":"result","subtype":"success","result":"ok","session_id":"s1"}'
+      else
+        echo '{"type":"result","subtype":"error_during_execution","is_error":true,"errors":[{"type":"overloaded_error","message":"Overloaded"}]}'
+      fi
+      exit 0 ;;
+  esac
+done
+`, log))
+
+	result, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithModel("opus"),
+		WithFallbackModel("sonnet"), WithModelFallbackChain("sonnet", "haiku"))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Model != "haiku" {
+		t.Fatalf("Result.Model = %q, want haiku", result.Model)
+	}
+	b, _ := os.ReadFile(log)
+	if got, want := string(b), "opus/sonnet\nhaiku/\n"; got != want {
+		t.Fatalf("attempts:\n%s, want:\n%s", got, want)
+	}
+
+	// Without a chain the overload error is returned.
+	if _, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithModel("opus")); err == nil || !modelUnavailable(err) {
+		t.Fatalf("expected an overloaded error, got %v", err)
+	}
+}
+
+func TestModelUnavailable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&agentError{subtype: "error_during_execution", errors: []ResultError{{Type: "overloaded_error", Message: "Overloaded"}}}, true},
+		{&agentError{subtype: "error_during_execution", errors: []ResultError{{Type: "not_found_error", Message: "model: claude-x"}}}, true},
+		{&agentError{subtype: "success", msg: `API Error: 529 {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}`}, true},
+		{&agentError{subtype: "success", msg: `API Error: 404 {"type":"error","error":{"type":"not_found_error","message":"model: claude-x"}}`}, true},
+		{errors.New("claude: API Error: 529 Overloaded"), true},
+		{&agentError{subtype: "error_during_execution", errors: []ResultError{{Type: "invalid_request_error", Message: "overloaded 529"}}}, false},
+		{&agentError{subtype: "success", msg: "cat /tmp/run-529/out.log: no such file"}, false},
+		{&agentError{subtype: "success", msg: "API Error: 500 Internal server error"}, false},
+		{errors.New("claude: process error (exit 1): line 529: overloaded_error"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := modelUnavailable(tt.err); got != tt.want {
+			t.Errorf("modelUnavailable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitError_UsageLimitMessage(t *testing.T) {
+	err := rateLimitError(errors.New("x"), nil, "Claude AI usage limit reached|1760000000")
+	if err == nil || !err.ResetsAt.Equal(time.Unix(1760000000, 0)) {
+		t.Fatalf("unexpected rate limit error %+v", err)
+	}
+	if rateLimitError(errors.New("x"), nil, "tool failed") != nil {
+		t.Fatal("expected no rate limit error for an unrelated message")
+	}
+}
+
+func TestRun_OnResult(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"ok","total_cost_usd":0.25}'
+      exit 0 ;;
+  esac
+done
+`)
+	var got []*Result
+	result, err := Run(context.Background(), "hi", WithClaudeExecutable(exe),
+		WithOnResult(func(r *Result) { got = append(got, r) }))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	// The callback has run by the time Run returns, with the same result.
+	if len(got) != 1 || got[0] != result {
+		t.Fatalf("expected one callback with the returned result, got %v", got)
+	}
+}
+
+func TestRun_OnSuccessOnError(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      case "$line" in
+        *fail*) echo '{"type":"result","subtype":"error_max_turns","is_error":true}' ;;
+        *) echo '{"type":"result","subtype":"success","result":"ok"}' ;;
+      esac
+      exit 0 ;;
+  esac
+done
+`)
+	var successes, failures []string
+	opts := []Option{
+		WithClaudeExecutable(exe),
+		WithOnSuccess(func(r *Result) { successes = append(successes, r.Subtype) }),
+		WithOnError(func(r *Result) { failures = append(failures, r.Subtype) }),
+	}
+	if _, err := Run(context.Background(), "hi", opts...); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if _, err := Run(context.Background(), "fail", opts...); err == nil {
+		t.Fatal("expected the failed run to return an error")
+	}
+	if !slices.Equal(successes, []string{"success"}) || !slices.Equal(failures, []string{"error_max_turns"}) {
+		t.Fatalf("successes = %v, failures = %v", successes, failures)
+	}
+}
+
+func TestStream_InterruptWithReason(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"system","subtype":"init","session_id":"s1"}'
+      sleep 10 ;;
+  esac
+done
+`)
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for e := range stream.Events() {
+		if e.Type == TypeSystem {
+			_ = stream.InterruptWithReason("budget hit")
+			_ = stream.InterruptWithReason("ignored")
+		}
+	}
+	var interrupted *InterruptedError
+	if !errors.As(stream.Err(), &interrupted) || interrupted.Reason != "budget hit" {
+		t.Fatalf("expected *InterruptedError with the first reason, got %v", stream.Err())
+	}
+	if got := stream.InterruptReason(); got != "budget hit" {
+		t.Fatalf("unexpected InterruptReason %q", got)
+	}
+}
+
+func TestQuery_AgentEventHandler(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Task","input":{}},{"type":"tool_use","id":"t2","name":"Task","input":{}}]},"parent_tool_use_id":null}'
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"a"}]},"parent_tool_use_id":"t1"}'
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"b"}]},"parent_tool_use_id":"t2"}'
+      echo '{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"x","content":"ok"}]},"parent_tool_use_id":"t1"}'
+      echo '{"type":"result","subtype":"success","result":"ok"}'
+      exit 0 ;;
+  esac
+done
+`)
+	var got []string
+	_, err := Run(context.Background(), "hi", WithClaudeExecutable(exe),
+		WithAgentEventHandler(func(parentToolUseID string, e Event) {
+			got = append(got, parentToolUseID+":"+string(e.Type))
+		}))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	want := []string{"t1:assistant", "t2:assistant", "t1:user"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
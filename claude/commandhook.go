@@ -0,0 +1,98 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// defaultCommandHookTimeout matches the CLI's default for command hooks.
+const defaultCommandHookTimeout = 60 * time.Second
+
+// CommandHook adapts a shell command written for the CLI's native command
+// hooks (the "type": "command" entries in settings.json) into a HookFunc, so
+// existing hook scripts can be reused from the SDK unchanged. The command runs
+// via `sh -c` with the same contract as in the CLI:
+//
+//   - The hook input JSON is written to its stdin; it runs in the session's
+//     cwd with CLAUDE_PROJECT_DIR set to it.
+//   - Exit 0: stdout, when it is a JSON object, is decoded as the HookOutput;
+//     any other stdout is ignored.
+//   - Exit 2: a blocking error. stderr becomes the reason fed back to Claude
+//     (for PreToolUse, the tool call is denied).
+//   - Any other exit status: a non-blocking error; execution continues.
+//
+// timeout bounds each run; zero means 60 seconds.
+func CommandHook(command string, timeout time.Duration) HookFunc {
+	if timeout <= 0 {
+		timeout = defaultCommandHookTimeout
+	}
+	return func(event HookEvent, input json.RawMessage, _ string) (*HookOutput, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var payload struct {
+			CWD string `json:"cwd"`
+		}
+		_ = json.Unmarshal(input, &payload)
+
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdin = bytes.NewReader(input)
+		if payload.CWD != "" {
+			cmd.Dir = payload.CWD
+			cmd.Env = append(os.Environ(), "CLAUDE_PROJECT_DIR="+payload.CWD)
+		}
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		// Don't wait on background children still holding the output pipes
+		// after the shell itself was killed on timeout.
+		cmd.WaitDelay = time.Second
+
+		err := cmd.Run()
+		var exitErr *exec.ExitError
+		switch {
+		case err == nil:
+			return commandHookOutput(stdout.Bytes()), nil
+		case ctx.Err() != nil:
+			return nil, fmt.Errorf("claude: command hook %q timed out after %s", command, timeout)
+		case errors.As(err, &exitErr) && exitErr.ExitCode() == 2:
+			return blockingHookOutput(event, strings.TrimSpace(stderr.String())), nil
+		default:
+			return nil, fmt.Errorf("claude: command hook %q: %w: %s", command, err, strings.TrimSpace(stderr.String()))
+		}
+	}
+}
+
+// commandHookOutput decodes a successful hook's stdout. Output that is not a
+// JSON object yields nil, meaning "no opinion".
+func commandHookOutput(stdout []byte) *HookOutput {
+	stdout = bytes.TrimSpace(stdout)
+	if len(stdout) == 0 || stdout[0] != '{' {
+		return nil
+	}
+	var out HookOutput
+	if err := json.Unmarshal(stdout, &out); err != nil {
+		return nil
+	}
+	return &out
+}
+
+// blockingHookOutput is the HookOutput for a hook that exited with status 2.
+func blockingHookOutput(event HookEvent, reason string) *HookOutput {
+	out := &HookOutput{Decision: "block", Reason: reason}
+	if event == HookEventPreToolUse {
+		out.HookSpecificOutput = map[string]any{
+			"hookEventName":            string(HookEventPreToolUse),
+			"permissionDecision":       string(PermissionBehaviorDeny),
+			"permissionDecisionReason": reason,
+		}
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+package claude
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCommandHook(t *testing.T) {
+	dir := t.TempDir()
+	input := json.RawMessage(`{"cwd":"` + dir + `","tool_name":"Bash"}`)
+
+	tests := []struct {
+		name    string
+		command string
+		check   func(t *testing.T, out *HookOutput, err error)
+	}{
+		{
+			name:    "json stdout",
+			command: `grep -q '"tool_name":"Bash"' && echo '{"systemMessage":"seen '"$CLAUDE_PROJECT_DIR"'"}'`,
+			check: func(t *testing.T, out *HookOutput, err error) {
+				if err != nil || out == nil || out.SystemMessage != "seen "+dir {
+					t.Fatalf("unexpected output %+v (err %v)", out, err)
+				}
+			},
+		},
+		{
+			name:    "plain stdout",
+			command: `echo hello`,
+			check: func(t *testing.T, out *HookOutput, err error) {
+				if err != nil || out != nil {
+					t.Fatalf("expected no output, got %+v (err %v)", out, err)
+				}
+			},
+		},
+		{
+			name:    "exit 2 blocks",
+			command: `echo "rm is not allowed" >&2; exit 2`,
+			check: func(t *testing.T, out *HookOutput, err error) {
+				if err != nil || out == nil || out.Reason != "rm is not allowed" {
+					t.Fatalf("unexpected output %+v (err %v)", out, err)
+				}
+				if out.HookSpecificOutput["permissionDecision"] != string(PermissionBehaviorDeny) {
+					t.Fatalf("expected a deny decision, got %v", out.HookSpecificOutput)
+				}
+			},
+		},
+		{
+			name:    "other exit is an error",
+			command: `exit 1`,
+			check: func(t *testing.T, _ *HookOutput, err error) {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			out, err := CommandHook(tc.command, 0)(HookEventPreToolUse, input, "tu1")
+			tc.check(t, out, err)
+		})
+	}
+}
+
+func TestCommandHook_Timeout(t *testing.T) {
+	_, err := CommandHook("exec sleep 5", 50*time.Millisecond)(HookEventStop, json.RawMessage(`{}`), "")
+	if err == nil {
+		t.Fatal("expected a timeout error")
+	}
+}
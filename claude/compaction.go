@@ -0,0 +1,144 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// compactionPrompt asks the model for the summary that seeds a compacted
+// session when WithAutoCompaction has no summarizer.
+const compactionPrompt = "Summarize our conversation so far so that it can be continued " +
+	"in a new session without the original history. Include the goal, decisions made, " +
+	"the current state of the work, open questions and the next steps. " +
+	"Reply with the summary only."
+
+// compactionPreamble introduces the summary in the new session's system prompt.
+const compactionPreamble = "This session continues an earlier conversation that was compacted. " +
+	"Summary of the earlier conversation:\n\n"
+
+// observeCompaction tracks the context size, and the transcript when a
+// summarizer needs it. It runs on the delivery goroutine.
+func (s *Stream) observeCompaction(e Event, keepTranscript bool) {
+	switch {
+	case e.Assistant != nil && e.Assistant.ParentToolUseID == nil && e.Assistant.Message.Usage != nil:
+		u := e.Assistant.Message.Usage
+		s.contextTokens.Store(int64(u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens + u.OutputTokens))
+	case e.Result != nil && s.contextTokens.Load() == 0:
+		// Without per-call usage, the turn's total is an upper bound.
+		u := e.Result.Usage
+		s.contextTokens.Store(int64(u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens + u.OutputTokens))
+	}
+	if keepTranscript && e.StreamEvent == nil {
+		s.transcriptMu.Lock()
+		s.transcript = append(s.transcript, e)
+		s.transcriptMu.Unlock()
+	}
+}
+
+// parseCompaction returns the Compaction a user message line carries when the
+// CLI marked it as a compaction summary, and nil otherwise.
+func parseCompaction(line []byte) *Compaction {
+	var m struct {
+		IsCompactSummary bool   `json:"isCompactSummary"`
+		SessionID        string `json:"session_id"`
+		UUID             string `json:"uuid"`
+		Message          struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(line, &m); err != nil || !m.IsCompactSummary {
+		return nil
+	}
+	return &Compaction{
+		// The content is a string or text blocks, like a tool result's.
+		Summary:   ContentBlock{Content: m.Message.Content}.ResultText(),
+		SessionID: m.SessionID,
+		UUID:      m.UUID,
+	}
+}
+
+// attachCompactMetadata fills a compaction summary's token counts from the
+// compact_boundary message before it. It runs on the delivery goroutine.
+func (s *Stream) attachCompactMetadata(e *Event) {
+	switch {
+	case e.System != nil && e.System.Subtype == SubtypeCompactBoundary:
+		s.compactMetadata = e.System.CompactMetadata
+	case e.Compaction != nil && s.compactMetadata != nil:
+		e.Compaction.Trigger = s.compactMetadata.Trigger
+		e.Compaction.PreTokens = s.compactMetadata.PreTokens
+		e.Compaction.PostTokens = s.compactMetadata.PostTokens
+		s.compactMetadata = nil
+	}
+}
+
+// compactIfNeeded replaces the subprocess with a fresh one seeded with a
+// summary once the context has reached the WithAutoCompaction threshold.
+// Callers must hold s.mu.
+func (s *Session) compactIfNeeded() error {
+	if s.opts.AutoCompactTokens <= 0 || s.stream.contextTokens.Load() < int64(s.opts.AutoCompactTokens) {
+		return nil
+	}
+	summary, err := s.summarize()
+	if err != nil {
+		return fmt.Errorf("claude: compaction: %w", err)
+	}
+	prev := s.summary
+	s.summary = summary
+	opts := s.spawnOptions()
+	opts.ResumeSessionID = ""
+	opts.CustomSessionID = ""
+	opts.Continue = false
+	opts.ForkSession = false
+	stream, err := spawnSession(s.ctx, opts)
+	if err != nil {
+		s.summary = prev
+		return fmt.Errorf("claude: compaction: %w", err)
+	}
+	_ = s.stream.Close()
+	s.stream = stream
+	return nil
+}
+
+// summarize returns the summary of the current subprocess's conversation.
+// Callers must hold s.mu.
+func (s *Session) summarize() (string, error) {
+	if fn := s.opts.AutoCompactSummarizer; fn != nil {
+		s.stream.transcriptMu.Lock()
+		transcript := s.stream.transcript
+		s.stream.transcriptMu.Unlock()
+		return fn(transcript), nil
+	}
+	if err := s.stream.sendCorrelatedTurn(compactionPrompt, ""); err != nil {
+		return "", err
+	}
+	for {
+		select {
+		case e, ok := <-s.stream.Events():
+			if !ok {
+				return "", errors.New("session ended before the summary")
+			}
+			if e.Result == nil {
+				continue
+			}
+			if e.Result.IsError {
+				return "", fmt.Errorf("summary turn failed: %s", e.Result.Result)
+			}
+			return strings.TrimSpace(e.Result.Result), nil
+		case <-s.ctx.Done():
+			return "", s.ctx.Err()
+		}
+	}
+}
+
+// spawnOptions returns a copy of the session's options for a new subprocess,
+// with the compaction summary, if any, appended to the system prompt.
+func (s *Session) spawnOptions() *Options {
+	opts := *s.opts
+	opts.RequestID = s.stream.RequestID()
+	if s.summary != "" {
+		opts.AppendSystemPrompt = strings.TrimSpace(opts.AppendSystemPrompt + "\n\n" + compactionPreamble + s.summary)
+	}
+	return &opts
+}
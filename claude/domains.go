@@ -0,0 +1,109 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// domainMatcher is the PreToolUse matcher for the tools restricted by
+// WithAllowedDomains.
+const domainMatcher = "WebFetch|WebSearch"
+
+// withAllowedDomainsHook returns a copy of hooks with an extra PreToolUse hook
+// that denies WebFetch/WebSearch calls reaching outside domains. The hook
+// returns a permissionDecision so the CLI's permission machinery applies the
+// denial in every permission mode, including bypassPermissions.
+func withAllowedDomainsHook(hooks map[HookEvent][]HookMatcher, domains []string) map[HookEvent][]HookMatcher {
+	return withPreToolUseHook(hooks, domainMatcher, allowedDomainsHook(domains))
+}
+
+// withPreToolUseHook returns a copy of hooks with fn appended as a PreToolUse
+// hook for matcher, leaving the caller's map and slices untouched.
+func withPreToolUseHook(hooks map[HookEvent][]HookMatcher, matcher string, fn HookFunc) map[HookEvent][]HookMatcher {
+	return withHook(hooks, HookEventPreToolUse, matcher, fn)
+}
+
+// withHook returns a copy of hooks with fn appended as an event hook for
+// matcher, leaving the caller's map and slices untouched.
+func withHook(hooks map[HookEvent][]HookMatcher, event HookEvent, matcher string, fn HookFunc) map[HookEvent][]HookMatcher {
+	out := make(map[HookEvent][]HookMatcher, len(hooks)+1)
+	for e, matchers := range hooks {
+		out[e] = matchers
+	}
+	out[event] = append(append([]HookMatcher(nil), hooks[event]...), HookMatcher{
+		Matcher: matcher,
+		Hooks:   []HookFunc{fn},
+	})
+	return out
+}
+
+// denyToolUse is the PreToolUse output that denies the call with reason.
+func denyToolUse(reason string) *HookOutput {
+	return &HookOutput{
+		HookSpecificOutput: map[string]any{
+			"hookEventName":            string(HookEventPreToolUse),
+			"permissionDecision":       string(PermissionBehaviorDeny),
+			"permissionDecisionReason": reason,
+		},
+	}
+}
+
+// allowedDomainsHook builds the PreToolUse HookFunc used by withAllowedDomainsHook.
+func allowedDomainsHook(domains []string) HookFunc {
+	return func(_ HookEvent, input json.RawMessage, _ string) (*HookOutput, error) {
+		var payload struct {
+			ToolName  string `json:"tool_name"`
+			ToolInput struct {
+				URL            string   `json:"url"`
+				AllowedDomains []string `json:"allowed_domains"`
+			} `json:"tool_input"`
+		}
+		if err := json.Unmarshal(input, &payload); err != nil {
+			return nil, fmt.Errorf("claude: allowed domains: decode hook input: %w", err)
+		}
+
+		var reason string
+		switch payload.ToolName {
+		case "WebFetch":
+			u, err := url.Parse(payload.ToolInput.URL)
+			if err != nil || !domainAllowed(u.Hostname(), domains) {
+				reason = fmt.Sprintf("WebFetch of %q is outside the allowed domains: %s",
+					payload.ToolInput.URL, strings.Join(domains, ", "))
+			}
+		case "WebSearch":
+			ok := len(payload.ToolInput.AllowedDomains) > 0
+			for _, d := range payload.ToolInput.AllowedDomains {
+				if !domainAllowed(d, domains) {
+					ok = false
+					break
+				}
+			}
+			if !ok {
+				reason = fmt.Sprintf("WebSearch must set allowed_domains to a subset of: %s",
+					strings.Join(domains, ", "))
+			}
+		}
+		if reason == "" {
+			return nil, nil
+		}
+		return denyToolUse(reason), nil
+	}
+}
+
+// domainAllowed reports whether host equals one of domains or is a subdomain of
+// one. Matching is case-insensitive; a leading "*." on a domain is ignored.
+func domainAllowed(host string, domains []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return false
+	}
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimPrefix(d, "*."))
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
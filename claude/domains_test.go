@@ -0,0 +1,75 @@
+package claude
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDomainAllowed(t *testing.T) {
+	domains := []string{"wiki.internal", "*.corp.example"}
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"wiki.internal", true},
+		{"docs.wiki.internal", true},
+		{"WIKI.INTERNAL", true},
+		{"team.corp.example", true},
+		{"corp.example", true},
+		{"notwiki.internal", false},
+		{"example.com", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := domainAllowed(tt.host, domains); got != tt.want {
+			t.Errorf("domainAllowed(%q) = %v, want %v", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestAllowedDomainsHook(t *testing.T) {
+	hook := allowedDomainsHook([]string{"wiki.internal"})
+	tests := []struct {
+		name     string
+		input    string
+		wantDeny bool
+	}{
+		{"fetch allowed", `{"tool_name":"WebFetch","tool_input":{"url":"https://wiki.internal/page"}}`, false},
+		{"fetch denied", `{"tool_name":"WebFetch","tool_input":{"url":"https://example.com/"}}`, true},
+		{"search without domains", `{"tool_name":"WebSearch","tool_input":{"query":"go"}}`, true},
+		{"search within allowlist", `{"tool_name":"WebSearch","tool_input":{"query":"go","allowed_domains":["wiki.internal"]}}`, false},
+		{"search outside allowlist", `{"tool_name":"WebSearch","tool_input":{"query":"go","allowed_domains":["example.com"]}}`, true},
+		{"other tool", `{"tool_name":"Bash","tool_input":{"command":"ls"}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := hook(HookEventPreToolUse, json.RawMessage(tt.input), "tu1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			denied := out != nil && out.HookSpecificOutput["permissionDecision"] == "deny"
+			if denied != tt.wantDeny {
+				t.Fatalf("expected deny=%v, got %+v", tt.wantDeny, out)
+			}
+		})
+	}
+}
+
+func TestWithAllowedDomainsHook_PreservesUserHooks(t *testing.T) {
+	user := map[HookEvent][]HookMatcher{
+		HookEventPreToolUse: {{Matcher: "Bash"}},
+		HookEventStop:       {{}},
+	}
+	hooks := withAllowedDomainsHook(user, []string{"wiki.internal"})
+
+	if len(user[HookEventPreToolUse]) != 1 {
+		t.Fatal("expected user hooks map to be left unmodified")
+	}
+	pre := hooks[HookEventPreToolUse]
+	if len(pre) != 2 || pre[0].Matcher != "Bash" || pre[1].Matcher != domainMatcher {
+		t.Fatalf("unexpected PreToolUse matchers: %+v", pre)
+	}
+	if len(hooks[HookEventStop]) != 1 {
+		t.Fatal("expected Stop hooks to be preserved")
+	}
+}
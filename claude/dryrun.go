@@ -0,0 +1,82 @@
+package claude
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// DryRunResult describes the CLI invocation a Query, Run, or NewSession call
+// would perform. It is returned as the error when WithDryRun is set.
+type DryRunResult struct {
+	// Path is the resolved executable, or ClaudeExecutable as configured when
+	// it cannot be found on this machine.
+	Path string
+	// Args is the full argv after Path.
+	Args []string
+	// Env is the subprocess environment. Values of variables whose names look
+	// secret (with a KEY, TOKEN, SECRET, or PASSWORD word, as in
+	// ANTHROPIC_API_KEY) are redacted.
+	Env []string
+	// Dir is the working directory, or "" for the caller's.
+	Dir string
+	// Messages are the JSON lines that would be written to stdin before the
+	// first event is read: the initialize request, then the prompt (and any
+	// response prefill) unless in session mode.
+	Messages []json.RawMessage
+}
+
+// Error implements error so that WithDryRun can return the result from
+// functions whose signatures only allow an error.
+func (d *DryRunResult) Error() string {
+	return "claude: dry run: " + strings.Join(append([]string{d.Path}, d.Args...), " ")
+}
+
+// redacted replaces the value of secret-looking environment variables.
+const redacted = "[REDACTED]"
+
+// dryRun builds the DryRunResult for opts and prompt without spawning anything.
+func dryRun(opts *Options, prompt string) *DryRunResult {
+	path, prefix, err := resolveCommand(opts)
+	if err != nil {
+		path, prefix = opts.ClaudeExecutable, nil
+	}
+	d := &DryRunResult{
+		Path: path,
+		Args: append(prefix, opts.buildArgs()...),
+		Dir:  opts.CWD,
+	}
+	for _, kv := range buildEnv(opts) {
+		if k, _, ok := strings.Cut(kv, "="); ok && secretEnvName(k) {
+			kv = k + "=" + redacted
+		}
+		d.Env = append(d.Env, kv)
+	}
+
+	hooksConfig, _ := buildHooksForInitialize(sdkHooks(opts))
+	msgs := []any{initializeMsg(opts, hooksConfig)}
+	if !opts.sessionMode && prompt != "" {
+		msgs = append(msgs, userMsg(prompt, opts.knownSessionID()))
+		if prefill := opts.responsePrefill(); prefill != "" {
+			msgs = append(msgs, prefillMsg(prefill, opts.knownSessionID()))
+		}
+	}
+	for _, m := range msgs {
+		if b, err := json.Marshal(m); err == nil {
+			d.Messages = append(d.Messages, b)
+		}
+	}
+	return d
+}
+
+// secretEnvName reports whether an environment variable name suggests its
+// value is a credential. Whole underscore-separated words are matched so that
+// e.g. MAX_THINKING_TOKENS is left alone.
+func secretEnvName(name string) bool {
+	for _, word := range strings.Split(strings.ToUpper(name), "_") {
+		switch word {
+		case "KEY", "TOKEN", "SECRET", "PASSWORD":
+			return true
+		}
+	}
+	return false
+}
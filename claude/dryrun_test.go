@@ -0,0 +1,46 @@
+package claude
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWithDryRun(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "sk-secret")
+	_, err := Run(t.Context(), "hello",
+		WithClaudeExecutable("/does/not/exist/claude"),
+		WithModel("claude-opus-4-6"),
+		WithMaxThinkingTokens(2048),
+		WithDryRun())
+	var dry *DryRunResult
+	if !errors.As(err, &dry) {
+		t.Fatalf("expected *DryRunResult, got %T: %v", err, err)
+	}
+	if dry.Path != "/does/not/exist/claude" {
+		t.Fatalf("unexpected path %q", dry.Path)
+	}
+	if !containsFlag(dry.Args, "--model", "claude-opus-4-6") {
+		t.Fatalf("expected --model in args %v", dry.Args)
+	}
+	if !slices.Contains(dry.Env, "ANTHROPIC_API_KEY=[REDACTED]") || !slices.Contains(dry.Env, "MAX_THINKING_TOKENS=2048") {
+		t.Fatalf("unexpected env redaction: %v", dry.Env)
+	}
+	if len(dry.Messages) != 2 {
+		t.Fatalf("expected initialize and user messages, got %d", len(dry.Messages))
+	}
+	var user struct {
+		Type    string `json:"type"`
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(dry.Messages[1], &user); err != nil || user.Type != "user" || user.Message.Content != "hello" {
+		t.Fatalf("unexpected user message %s (err %v)", dry.Messages[1], err)
+	}
+	if !strings.Contains(string(dry.Messages[0]), `"subtype":"initialize"`) {
+		t.Fatalf("unexpected initialize message %s", dry.Messages[0])
+	}
+}
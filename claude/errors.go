@@ -1,16 +1,33 @@
 package claude
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // CLINotFoundError is returned when the claude binary cannot be found or executed.
 type CLINotFoundError struct {
 	ExecutablePath string
+	// SearchedPath is the PATH that was searched for ExecutablePath.
+	SearchedPath string
+	// Err is the underlying lookup error, if any.
+	Err error
 }
 
 func (e *CLINotFoundError) Error() string {
+	if e.SearchedPath != "" {
+		return fmt.Sprintf("claude: binary not found: %q (PATH=%s)", e.ExecutablePath, e.SearchedPath)
+	}
 	return fmt.Sprintf("claude: binary not found: %q", e.ExecutablePath)
 }
 
+func (e *CLINotFoundError) Unwrap() error { return e.Err }
+
 // ProcessError is returned when the claude subprocess exits with a non-zero status.
 type ProcessError struct {
 	ExitCode int
@@ -36,3 +53,257 @@ func (e *CLIJSONDecodeError) Error() string {
 }
 
 func (e *CLIJSONDecodeError) Unwrap() error { return e.Err }
+
+// AuthKind identifies which credential the CLI is missing or rejected.
+type AuthKind string
+
+const (
+	// AuthKindAPIKey means the API key is missing or invalid.
+	AuthKindAPIKey AuthKind = "api_key"
+	// AuthKindOAuth means there is no Claude login or its OAuth token expired.
+	AuthKindOAuth AuthKind = "oauth"
+)
+
+// AuthRequiredError is returned when the CLI cannot run because it is not
+// authenticated. Kind tells an onboarding flow which credential to ask for;
+// Hint gives a ready-made instruction.
+type AuthRequiredError struct {
+	Kind AuthKind
+	// Message is the CLI's own description of the failure.
+	Message string
+	// Err is the underlying error, e.g. the *ProcessError of a CLI that exited.
+	Err error
+}
+
+func (e *AuthRequiredError) Error() string {
+	return fmt.Sprintf("claude: authentication required (%s): %s", e.Kind, e.Message)
+}
+
+func (e *AuthRequiredError) Unwrap() error { return e.Err }
+
+// Hint returns a short instruction for fixing the failure.
+func (e *AuthRequiredError) Hint() string {
+	if e.Kind == AuthKindAPIKey {
+		return "set a valid ANTHROPIC_API_KEY, or run `claude /login` to use a Claude account"
+	}
+	return "run `claude /login` to sign in again"
+}
+
+// authError returns an *AuthRequiredError when msg is one of the CLI's
+// authentication failures, and nil otherwise.
+func authError(msg string) *AuthRequiredError {
+	m := strings.ToLower(msg)
+	switch {
+	case strings.Contains(m, "oauth") && (strings.Contains(m, "expired") || strings.Contains(m, "revoked")):
+		return &AuthRequiredError{Kind: AuthKindOAuth, Message: msg}
+	case strings.Contains(m, "invalid api key"), strings.Contains(m, "no api key"),
+		strings.Contains(m, "api key not found"), strings.Contains(m, "missing api key"):
+		return &AuthRequiredError{Kind: AuthKindAPIKey, Message: msg}
+	case strings.Contains(m, "not logged in"), strings.Contains(m, "please run /login"):
+		return &AuthRequiredError{Kind: AuthKindOAuth, Message: msg}
+	}
+	return nil
+}
+
+// InterruptedError is returned by Run and Stream.Err when the run was stopped
+// with InterruptWithReason before it produced a result.
+type InterruptedError struct {
+	Reason string
+}
+
+func (e *InterruptedError) Error() string {
+	return "claude: interrupted: " + e.Reason
+}
+
+// MessageTooLargeError is returned by Stream.Err and Run when an assistant
+// message exceeded WithMaxMessageSize under OversizeError.
+type MessageTooLargeError struct {
+	// Size is the message's size in bytes of JSON.
+	Size int
+	// Limit is the configured maximum.
+	Limit int
+}
+
+func (e *MessageTooLargeError) Error() string {
+	return fmt.Sprintf("claude: assistant message of %d bytes exceeds the %d-byte limit", e.Size, e.Limit)
+}
+
+// PromptTooLargeError is returned by Run and Query, before the CLI is
+// started, when the prompt exceeds WithMaxInputTokens.
+type PromptTooLargeError struct {
+	// Tokens is the counted size of the prompt and system prompt.
+	Tokens int
+	// Limit is the configured maximum.
+	Limit int
+}
+
+func (e *PromptTooLargeError) Error() string {
+	return fmt.Sprintf("claude: prompt of about %d tokens exceeds the %d-token limit", e.Tokens, e.Limit)
+}
+
+// resultTransformError wraps an error from the WithResultTransform function.
+type resultTransformError struct{ err error }
+
+func (e *resultTransformError) Error() string { return "claude: result transform: " + e.err.Error() }
+
+func (e *resultTransformError) Unwrap() error { return e.err }
+
+// SessionClosedError is returned by Session.Send when the underlying subprocess
+// has already exited or the session was closed.
+type SessionClosedError struct {
+	// Crashed is true when the subprocess exited on its own with an error, as
+	// opposed to a clean close via Close, Interrupt, or context cancellation.
+	Crashed bool
+	// Err is the subprocess exit error, if any.
+	Err error
+}
+
+func (e *SessionClosedError) Error() string {
+	if e.Crashed {
+		return fmt.Sprintf("claude: session crashed: %v", e.Err)
+	}
+	return "claude: session closed"
+}
+
+func (e *SessionClosedError) Unwrap() error { return e.Err }
+
+// SessionBusyError is returned by Session.Send under WithConcurrentSessionGuard
+// when an earlier turn has not produced its result yet.
+type SessionBusyError struct{}
+
+func (e *SessionBusyError) Error() string {
+	return "claude: session busy: a turn is already in progress"
+}
+
+// TurnTimeoutError is reported by Session.TurnErr when a turn exceeded the
+// deadline set with WithPerTurnTimeout and was interrupted.
+type TurnTimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TurnTimeoutError) Error() string {
+	return fmt.Sprintf("claude: turn timed out after %s", e.Timeout)
+}
+
+// ToolTimeoutError is returned by Run, and reported by Session.TurnErr, when a
+// tool call outlasted WithToolTimeout and its turn was interrupted.
+type ToolTimeoutError struct {
+	Tool      string
+	ToolUseID string
+	Timeout   time.Duration
+}
+
+func (e *ToolTimeoutError) Error() string {
+	return fmt.Sprintf("claude: tool %s (%s) timed out after %s", e.Tool, e.ToolUseID, e.Timeout)
+}
+
+// RateLimitError is returned by Run when the run was rejected by a rate or
+// usage limit. ResetsAt is when the limit resets, or zero when the CLI did not
+// say. WithRateLimitRetry waits for it and retries instead.
+type RateLimitError struct {
+	ResetsAt time.Time
+	// Err is the error the run failed with.
+	Err error
+}
+
+func (e *RateLimitError) Error() string {
+	if e.ResetsAt.IsZero() {
+		return fmt.Sprintf("claude: rate limited: %v", e.Err)
+	}
+	return fmt.Sprintf("claude: rate limited until %s: %v", e.ResetsAt.Format(time.RFC3339), e.Err)
+}
+
+func (e *RateLimitError) Unwrap() error { return e.Err }
+
+// usageLimitRe matches the CLI's "Claude AI usage limit reached|<unix time>"
+// message, capturing the reset time.
+var usageLimitRe = regexp.MustCompile(`usage limit reached\|(\d+)`)
+
+// rateLimitError wraps err in a *RateLimitError when the run was rate limited:
+// the CLI sent a rejected rate_limit_event (info non-nil) or msg is a usage
+// limit message. It returns nil otherwise.
+func rateLimitError(err error, info *RateLimitInfo, msg string) *RateLimitError {
+	if info != nil {
+		return &RateLimitError{ResetsAt: info.ResetTime(), Err: err}
+	}
+	if m := usageLimitRe.FindStringSubmatch(msg); m != nil {
+		secs, _ := strconv.ParseInt(m[1], 10, 64)
+		return &RateLimitError{ResetsAt: time.Unix(secs, 0), Err: err}
+	}
+	return nil
+}
+
+// agentError is the error of a Result that reports failure. It keeps the
+// result's structured errors so that Run can tell an unavailable model from
+// other failures.
+type agentError struct {
+	subtype string
+	errors  []ResultError
+	msg     string
+}
+
+func (e *agentError) Error() string {
+	return fmt.Sprintf("claude: agent error (%s): %s", e.subtype, e.msg)
+}
+
+// unavailableErrorTypes are the API error types that mean the model cannot
+// serve the request, so another model may succeed.
+var unavailableErrorTypes = map[string]bool{"overloaded_error": true, "not_found_error": true}
+
+// apiErrorRe matches a line in which the CLI relays a failed API call, such as
+// `API Error: 529 {"type":"error","error":{"type":"overloaded_error",...}}`,
+// capturing the HTTP status and the response body.
+var apiErrorRe = regexp.MustCompile(`(?m)^(?:claude: )?API Error: (\d{3})\b(?:\s+(\{.*\}))?`)
+
+// modelUnavailable reports whether err says the model was overloaded or
+// otherwise unavailable, so another model may succeed. It relies on the API
+// error type the CLI reports, or on the status and body of an "API Error"
+// line, never on a status code appearing elsewhere in the text.
+func modelUnavailable(err error) bool {
+	var agentErr *agentError
+	if !errors.As(err, &agentErr) {
+		return err != nil && apiErrorUnavailable(err.Error())
+	}
+	for _, e := range agentErr.errors {
+		if unavailableErrorTypes[e.Type] || (e.Type == "" && apiErrorUnavailable(e.Message)) {
+			return true
+		}
+	}
+	return len(agentErr.errors) == 0 && apiErrorUnavailable(agentErr.msg)
+}
+
+// apiErrorUnavailable reports whether text holds an "API Error" line with
+// status 529 (overloaded) or a body whose error type is in
+// unavailableErrorTypes.
+func apiErrorUnavailable(text string) bool {
+	for _, m := range apiErrorRe.FindAllStringSubmatch(text, -1) {
+		if m[1] == "529" {
+			return true
+		}
+		var body ResultError
+		if m[2] != "" && json.Unmarshal([]byte(m[2]), &body) == nil && unavailableErrorTypes[body.Type] {
+			return true
+		}
+	}
+	return false
+}
+
+// BatchError is returned by RunBatch when one or more prompts failed. The
+// results of the prompts that succeeded are still returned alongside it.
+type BatchError struct {
+	// Errors maps the index of each failed prompt to its error.
+	Errors map[int]error
+	// Total is the number of prompts in the batch.
+	Total int
+}
+
+func (e *BatchError) Error() string {
+	first := -1
+	for i := range e.Errors {
+		if first < 0 || i < first {
+			first = i
+		}
+	}
+	return fmt.Sprintf("claude: batch: %d of %d prompts failed (first: prompt %d: %v)",
+		len(e.Errors), e.Total, first, e.Errors[first])
+}
@@ -0,0 +1,58 @@
+package claude
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// ResolveExecutable looks up the claude binary the way the SDK does before
+// spawning it. A name without a path separator is searched for in PATH; any
+// other path is checked as-is, a relative one against the current directory.
+// The result is absolute, so the spawned process does not depend on the
+// working directory or a later change to PATH. The SDK itself resolves a
+// relative path against WithCWD when it is set, as the subprocess would.
+//
+// When the binary cannot be found, the error is a *CLINotFoundError carrying
+// the PATH that was searched.
+func ResolveExecutable(name string) (string, error) {
+	return resolveExecutable(name, "")
+}
+
+// resolveExecutable is ResolveExecutable with a relative path that contains a
+// separator resolved against dir instead of the current directory.
+func resolveExecutable(name, dir string) (string, error) {
+	lookup := name
+	if dir != "" && !filepath.IsAbs(name) && strings.ContainsRune(name, filepath.Separator) {
+		lookup = filepath.Join(dir, name)
+	}
+	path, err := exec.LookPath(lookup)
+	if err != nil {
+		return "", &CLINotFoundError{ExecutablePath: name, SearchedPath: os.Getenv("PATH"), Err: err}
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", &CLINotFoundError{ExecutablePath: name, SearchedPath: os.Getenv("PATH"), Err: err}
+	}
+	return abs, nil
+}
+
+// npxPackage is the npm package run by WithNpxFallback.
+const npxPackage = "@anthropic-ai/claude-code"
+
+// resolveCommand returns the program that runs the CLI and the arguments that
+// precede the CLI's own. With WithNpxFallback, a missing claude binary is
+// replaced by `npx -y @anthropic-ai/claude-code`; the original
+// *CLINotFoundError is returned when npx is missing too.
+func resolveCommand(opts *Options) (path string, prefix []string, err error) {
+	path, err = resolveExecutable(opts.ClaudeExecutable, opts.CWD)
+	if err == nil || !opts.NpxFallback {
+		return path, nil, err
+	}
+	npx, npxErr := ResolveExecutable("npx")
+	if npxErr != nil {
+		return "", nil, err
+	}
+	return npx, []string{"-y", npxPackage}, nil
+}
@@ -0,0 +1,115 @@
+package claude
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveExecutable(t *testing.T) {
+	exe := writeFakeCLI(t, "exit 0\n")
+	t.Setenv("PATH", filepath.Dir(exe))
+
+	got, err := ResolveExecutable("claude")
+	if err != nil {
+		t.Fatalf("ResolveExecutable: %v", err)
+	}
+	if got != exe {
+		t.Fatalf("expected %q, got %q", exe, got)
+	}
+}
+
+// TestQuery_RelativeExecutableWithCWD is a regression test for a relative
+// executable path being resolved against the parent's working directory
+// rather than WithCWD, where the subprocess runs.
+func TestQuery_RelativeExecutableWithCWD(t *testing.T) {
+	exe := writeFakeCLI(t, `echo '{"type":"system","subtype":"init","session_id":"s1"}'
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"ok"}'
+      exit 0 ;;
+  esac
+done
+`)
+	cwd := t.TempDir()
+	if err := os.Mkdir(filepath.Join(cwd, "bin"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(exe, filepath.Join(cwd, "bin", "claude")); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Run(t.Context(), "hi", WithClaudeExecutable("./bin/claude"), WithCWD(cwd))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Result != "ok" {
+		t.Fatalf("unexpected result %q", result.Result)
+	}
+}
+
+func TestResolveExecutable_NotFound(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+
+	_, err := ResolveExecutable("claude")
+	var notFound *CLINotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected *CLINotFoundError, got %T: %v", err, err)
+	}
+	if notFound.SearchedPath != dir {
+		t.Fatalf("expected searched PATH %q, got %q", dir, notFound.SearchedPath)
+	}
+
+	_, err = Query(t.Context(), "hi")
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected Query to fail with *CLINotFoundError, got %T: %v", err, err)
+	}
+}
+
+func TestQuery_NpxFallback(t *testing.T) {
+	// The fake npx records its arguments and then plays the CLI.
+	npx := writeFakeCLI(t, `echo "$@" > "$ARGS_FILE"
+echo '{"type":"system","subtype":"init","session_id":"s1"}'
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"ok"}'
+      exit 0 ;;
+  esac
+done
+`)
+	dir := t.TempDir()
+	if err := os.Rename(npx, filepath.Join(dir, "npx")); err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+	t.Setenv("PATH", dir)
+	argsFile := filepath.Join(t.TempDir(), "args")
+
+	stream, err := Query(t.Context(), "hi",
+		WithNpxFallback(),
+		WithEnv(map[string]string{"ARGS_FILE": argsFile}),
+	)
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var warned bool
+	for e := range stream.Events() {
+		if e.System != nil && e.System.Subtype == SubtypeWarning && strings.Contains(e.System.Message, "npx") {
+			warned = true
+		}
+	}
+	if !warned {
+		t.Fatal("expected a warning naming the npx fallback")
+	}
+	b, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("read args: %v", err)
+	}
+	if !strings.HasPrefix(string(b), "-y "+npxPackage+" ") {
+		t.Fatalf("expected npx -y %s prefix, got %q", npxPackage, b)
+	}
+}
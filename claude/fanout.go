@@ -0,0 +1,101 @@
+package claude
+
+import (
+	"fmt"
+	"sync"
+)
+
+// fanout copies every event read from Events() to additional subscribers.
+type fanout struct {
+	mu     sync.Mutex
+	subs   []*subscriber
+	closed bool
+}
+
+type subscriber struct {
+	ch     chan Event
+	warned bool // a drop warning has already been emitted for this subscriber
+}
+
+// Subscribe registers an additional consumer of the stream's events and
+// returns its channel. Each subscriber receives every event delivered after it
+// subscribed, in order, through a buffer the size of the Events() buffer; the
+// channel is closed when the stream ends.
+//
+// Events() stays the primary consumer and must still be drained: events it has
+// not taken queue up in memory without bound (see WithEventBufferSize).
+// Subscribers never block it — when a subscriber's buffer is full the event is
+// dropped for that subscriber, and a warning system event is emitted on
+// Events() the first time that happens.
+//
+// The first Subscribe must be called before Events() is first consumed; later
+// calls may be made from any goroutine while the stream is active. Subscribing
+// after the stream has ended returns a closed channel.
+func (s *Stream) Subscribe() <-chan Event {
+	s.fanOnce.Do(func() {
+		s.fan = &fanout{}
+		in := s.Events()
+		out := make(chan Event, cap(s.events))
+		s.view = out
+		go s.fan.run(s, in, out)
+	})
+
+	sub := &subscriber{ch: make(chan Event, cap(s.events))}
+	s.fan.mu.Lock()
+	defer s.fan.mu.Unlock()
+	if s.fan.closed {
+		close(sub.ch)
+		return sub.ch
+	}
+	s.fan.subs = append(s.fan.subs, sub)
+	return sub.ch
+}
+
+// run forwards events from in to out, copying each one to the subscribers
+// without blocking. It closes out and every subscriber channel when in closes
+// or the stream's context is cancelled.
+func (f *fanout) run(s *Stream, in <-chan Event, out chan<- Event) {
+	defer func() {
+		f.mu.Lock()
+		f.closed = true
+		for _, sub := range f.subs {
+			close(sub.ch)
+		}
+		f.mu.Unlock()
+		close(out)
+	}()
+	for e := range in {
+		for _, w := range f.publish(e) {
+			select {
+			case out <- w:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+		select {
+		case out <- e:
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// publish offers e to every subscriber and returns the warnings to emit for
+// subscribers that dropped it for the first time.
+func (f *fanout) publish(e Event) []Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var warnings []Event
+	for i, sub := range f.subs {
+		select {
+		case sub.ch <- e:
+		default:
+			if !sub.warned {
+				sub.warned = true
+				warnings = append(warnings, warningEvent(fmt.Sprintf(
+					"claude: subscriber %d is not keeping up; dropping events", i+1)))
+			}
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,65 @@
+package claude
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func assistantTranscript(n int) string {
+	var b strings.Builder
+	for i := range n {
+		fmt.Fprintf(&b, `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"%d"}]}}`+"\n", i)
+	}
+	return b.String()
+}
+
+func TestSubscribe(t *testing.T) {
+	stream := ReplayFromReader(strings.NewReader(assistantTranscript(3)))
+	a, b := stream.Subscribe(), stream.Subscribe()
+	primary := 0
+	for range stream.Events() {
+		primary++
+	}
+	for name, ch := range map[string]<-chan Event{"a": a, "b": b} {
+		count := 0
+		for range ch {
+			count++
+		}
+		if count != primary || count != 3 {
+			t.Fatalf("subscriber %s got %d events, Events() got %d; expected 3", name, count, primary)
+		}
+	}
+	if _, ok := <-stream.Subscribe(); ok {
+		t.Fatal("expected a closed channel when subscribing after the stream ended")
+	}
+}
+
+func TestSubscribe_SlowConsumerDrops(t *testing.T) {
+	const n = 40
+	stream := ReplayFromReader(strings.NewReader(assistantTranscript(n)))
+	slow := stream.Subscribe() // not read until the stream ends
+
+	var primary int
+	var warnings []string
+	for e := range stream.Events() {
+		if e.System != nil && e.System.Subtype == SubtypeWarning {
+			warnings = append(warnings, e.System.Message)
+			continue
+		}
+		primary++
+	}
+	if primary != n {
+		t.Fatalf("expected %d events on Events(), got %d", n, primary)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "subscriber 1") {
+		t.Fatalf("expected one drop warning for subscriber 1, got %q", warnings)
+	}
+	kept := 0
+	for range slow {
+		kept++
+	}
+	if kept != cap(stream.events) {
+		t.Fatalf("expected slow subscriber to keep %d buffered events, got %d", cap(stream.events), kept)
+	}
+}
@@ -0,0 +1,46 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// withMaxFileReadSizeHook returns a copy of hooks with an extra PreToolUse
+// hook that denies Read calls for files larger than limit bytes.
+func withMaxFileReadSizeHook(hooks map[HookEvent][]HookMatcher, limit int) map[HookEvent][]HookMatcher {
+	return withPreToolUseHook(hooks, "Read", maxFileReadSizeHook(limit))
+}
+
+// maxFileReadSizeHook builds the PreToolUse HookFunc used by
+// withMaxFileReadSizeHook. Files that cannot be stat'ed are left to the CLI,
+// which reports the error itself.
+func maxFileReadSizeHook(limit int) HookFunc {
+	return func(_ HookEvent, input json.RawMessage, _ string) (*HookOutput, error) {
+		var payload struct {
+			CWD       string `json:"cwd"`
+			ToolInput struct {
+				FilePath string `json:"file_path"`
+				Limit    int    `json:"limit"`
+			} `json:"tool_input"`
+		}
+		if err := json.Unmarshal(input, &payload); err != nil {
+			return nil, fmt.Errorf("claude: max file read size: decode hook input: %w", err)
+		}
+		if payload.ToolInput.Limit > 0 || payload.ToolInput.FilePath == "" {
+			return nil, nil
+		}
+		path := payload.ToolInput.FilePath
+		if !filepath.IsAbs(path) && payload.CWD != "" {
+			path = filepath.Join(payload.CWD, path)
+		}
+		info, err := os.Stat(path)
+		if err != nil || info.Size() <= int64(limit) {
+			return nil, nil
+		}
+		return denyToolUse(fmt.Sprintf(
+			"%s is %d bytes, over the %d-byte read limit; read it in parts with offset and limit",
+			payload.ToolInput.FilePath, info.Size(), limit)), nil
+	}
+}
@@ -0,0 +1,58 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMaxFileReadSizeHook(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "small.txt"), []byte("ok"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "big.log"), []byte(strings.Repeat("x", 100)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	hook := maxFileReadSizeHook(10)
+	tests := []struct {
+		name     string
+		input    string
+		wantDeny bool
+	}{
+		{"small file", fmt.Sprintf(`{"tool_name":"Read","tool_input":{"file_path":%q}}`, filepath.Join(dir, "small.txt")), false},
+		{"big file", fmt.Sprintf(`{"tool_name":"Read","tool_input":{"file_path":%q}}`, filepath.Join(dir, "big.log")), true},
+		{"big file relative to cwd", fmt.Sprintf(`{"cwd":%q,"tool_name":"Read","tool_input":{"file_path":"big.log"}}`, dir), true},
+		{"big file with line limit", fmt.Sprintf(`{"tool_name":"Read","tool_input":{"file_path":%q,"limit":20}}`, filepath.Join(dir, "big.log")), false},
+		{"missing file", `{"tool_name":"Read","tool_input":{"file_path":"/does/not/exist"}}`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := hook(HookEventPreToolUse, json.RawMessage(tt.input), "tu1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			denied := out != nil && out.HookSpecificOutput["permissionDecision"] == string(PermissionBehaviorDeny)
+			if denied != tt.wantDeny {
+				t.Fatalf("denied = %v, want %v (output %+v)", denied, tt.wantDeny, out)
+			}
+		})
+	}
+}
+
+func TestWithMaxFileReadSizeHook_KeepsUserHooks(t *testing.T) {
+	user := map[HookEvent][]HookMatcher{
+		HookEventPreToolUse: {{Matcher: "Bash", Hooks: []HookFunc{func(HookEvent, json.RawMessage, string) (*HookOutput, error) { return nil, nil }}}},
+	}
+	got := withMaxFileReadSizeHook(user, 10)
+	if len(got[HookEventPreToolUse]) != 2 || got[HookEventPreToolUse][1].Matcher != "Read" {
+		t.Fatalf("unexpected PreToolUse matchers: %+v", got[HookEventPreToolUse])
+	}
+	if len(user[HookEventPreToolUse]) != 1 {
+		t.Fatal("caller's hooks were modified")
+	}
+}
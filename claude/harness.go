@@ -0,0 +1,273 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+// TestingT is the part of *testing.T that Harness uses.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Harness unit-tests the permission handler and hooks configured by a set of
+// options without a live CLI. It plays the CLI's side of the control
+// protocol: each expectation sends the can_use_tool or hook_callback request
+// the CLI would send and checks the control_response the SDK writes back, so
+// the handlers run exactly as in a real session.
+//
+//	h := claude.NewHarness(t, claude.WithPermissionHandler(policy))
+//	h.ExpectPermissionRequest("Bash").
+//	    WithInput(map[string]any{"command": "rm -rf /"}).
+//	    Respond(claude.PermissionResult{Behavior: "deny", Message: "destructive"})
+//
+// Mismatches are reported with t.Errorf, so one test can check several
+// expectations.
+type Harness struct {
+	t     TestingT
+	opts  *Options
+	hooks map[string]any // the initialize message's hooks config
+	reg   hookRegistry
+	seq   int
+}
+
+// NewHarness returns a Harness for the handlers configured by opts, including
+// the hooks the SDK installs itself (WithAllowedDomains, WithMaxFileReadSize).
+func NewHarness(t TestingT, opts ...Option) *Harness {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	hooks, reg := buildHooksForInitialize(sdkHooks(o))
+	return &Harness{t: t, opts: o, hooks: hooks, reg: reg}
+}
+
+// PermissionExpectation is a can_use_tool request built by
+// Harness.ExpectPermissionRequest.
+type PermissionExpectation struct {
+	h     *Harness
+	tool  string
+	input json.RawMessage
+	ctx   PermissionContext
+}
+
+// ExpectPermissionRequest starts a can_use_tool request for toolName with an
+// empty input. Finish it with Respond.
+func (h *Harness) ExpectPermissionRequest(toolName string) *PermissionExpectation {
+	return &PermissionExpectation{h: h, tool: toolName, input: json.RawMessage(`{}`)}
+}
+
+// WithInput sets the tool input, any value that marshals to a JSON object.
+func (e *PermissionExpectation) WithInput(input any) *PermissionExpectation {
+	e.input = e.h.marshal(input)
+	return e
+}
+
+// WithContext sets the request's suggestions, blocked path, decision reason
+// and agent ID. ToolUseID is generated when empty.
+func (e *PermissionExpectation) WithContext(ctx PermissionContext) *PermissionExpectation {
+	e.ctx = ctx
+	return e
+}
+
+// Respond sends the request and checks that the SDK answers as it would for
+// want. With no permission handler every tool is allowed.
+func (e *PermissionExpectation) Respond(want PermissionResult) {
+	e.h.t.Helper()
+	id := e.ctx.ToolUseID
+	if id == "" {
+		id = e.h.nextID("toolu_harness")
+	}
+	req := map[string]any{
+		"subtype":     "can_use_tool",
+		"tool_name":   e.tool,
+		"tool_use_id": id,
+		"input":       e.input,
+	}
+	if len(e.ctx.Suggestions) > 0 {
+		req["permission_suggestions"] = e.ctx.Suggestions
+	}
+	for k, v := range map[string]string{"blocked_path": e.ctx.BlockedPath, "decision_reason": e.ctx.DecisionReason, "agent_id": e.ctx.AgentID} {
+		if v != "" {
+			req[k] = v
+		}
+	}
+	got, err := e.h.send(req)
+	if err != nil {
+		e.h.t.Errorf("claude: permission request for %s: %v", e.tool, err)
+		return
+	}
+	if w := e.h.normalize(permissionResponse(want, id)); !reflect.DeepEqual(got, w) {
+		e.h.t.Errorf("claude: permission request for %s: SDK answered %s, want %s", e.tool, e.h.marshal(got), e.h.marshal(w))
+	}
+}
+
+// HookExpectation is a hook_callback request built by Harness.ExpectHook.
+type HookExpectation struct {
+	h         *Harness
+	event     HookEvent
+	tool      string
+	toolSet   bool
+	input     json.RawMessage
+	toolUseID string
+}
+
+// ExpectHook starts a hook_callback request for event, sent to every hook
+// registered for it. Narrow it with ForTool and finish it with Respond.
+func (h *Harness) ExpectHook(event HookEvent) *HookExpectation {
+	return &HookExpectation{h: h, event: event}
+}
+
+// ForTool limits the request to hooks whose matcher matches toolName, as the
+// CLI does, and names the tool in the default input.
+func (e *HookExpectation) ForTool(toolName string) *HookExpectation {
+	e.tool, e.toolSet = toolName, true
+	return e
+}
+
+// WithInput sets the hook input payload. By default it holds the
+// hook_event_name, session_id, and for ForTool the tool_name and an empty
+// tool_input.
+func (e *HookExpectation) WithInput(input any) *HookExpectation {
+	e.input = e.h.marshal(input)
+	return e
+}
+
+// WithToolUseID sets the tool use ID passed to the hooks.
+func (e *HookExpectation) WithToolUseID(id string) *HookExpectation {
+	e.toolUseID = id
+	return e
+}
+
+// Respond sends the request to each matching hook and checks that every hook
+// that returns output returns want. Hooks returning nil are ignored, so
+// Respond(HookOutput{}) checks that none had anything to say. A hook error,
+// or no matching hook, is reported as a failure.
+func (e *HookExpectation) Respond(want HookOutput) {
+	e.h.t.Helper()
+	ids := e.h.callbacks(e.event, e.tool, e.toolSet)
+	if len(ids) == 0 {
+		e.h.t.Errorf("claude: no %s hook matches %q", e.event, e.tool)
+		return
+	}
+	input := e.input
+	if input == nil {
+		payload := map[string]any{"hook_event_name": e.event, "session_id": "harness"}
+		if e.toolSet {
+			payload["tool_name"] = e.tool
+			payload["tool_input"] = map[string]any{}
+		}
+		input = e.h.marshal(payload)
+	}
+	w := e.h.normalize(want)
+	for _, id := range ids {
+		got, err := e.h.send(map[string]any{
+			"subtype":     "hook_callback",
+			"callback_id": id,
+			"hook_event":  e.event,
+			"tool_use_id": e.toolUseID,
+			"input":       input,
+		})
+		switch {
+		case err != nil:
+			e.h.t.Errorf("claude: %s hook: %v", e.event, err)
+		case got != nil && !reflect.DeepEqual(got, w):
+			e.h.t.Errorf("claude: %s hook answered %s, want %s", e.event, e.h.marshal(got), e.h.marshal(w))
+		}
+	}
+}
+
+// callbacks returns the callback IDs registered for event, limited to
+// matchers that match tool when filter is set.
+func (h *Harness) callbacks(event HookEvent, tool string, filter bool) []string {
+	matchers, _ := h.hooks[string(event)].([]map[string]any)
+	var ids []string
+	for _, m := range matchers {
+		pattern, _ := m["matcher"].(string)
+		if filter && !hookMatches(pattern, tool) {
+			continue
+		}
+		ids = append(ids, m["callback_id"].(string))
+	}
+	return ids
+}
+
+// hookMatches reports whether a hook matcher selects tool: an empty matcher
+// or "*" matches every tool, others are regular expressions over the whole
+// name such as "Bash" or "Edit|Write".
+func hookMatches(pattern, tool string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return pattern == tool
+	}
+	return re.MatchString(tool)
+}
+
+// send dispatches a control_request as the CLI would and returns the body of
+// the SDK's success response, decoded; nil when it has none.
+func (h *Harness) send(req map[string]any) (any, error) {
+	var written []byte
+	write := func(v any) error {
+		b, err := json.Marshal(v)
+		written = b
+		return err
+	}
+	line := h.marshal(map[string]any{
+		"type":       "control_request",
+		"request_id": h.nextID("req_harness"),
+		"request":    req,
+	})
+	handleControlRequest(line, write, h.opts, h.reg)
+	if written == nil {
+		return nil, fmt.Errorf("SDK wrote no control_response")
+	}
+	var resp struct {
+		Response struct {
+			Subtype  string          `json:"subtype"`
+			Error    string          `json:"error"`
+			Response json.RawMessage `json:"response"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(written, &resp); err != nil {
+		return nil, fmt.Errorf("malformed control_response %s: %w", written, err)
+	}
+	if resp.Response.Subtype == "error" {
+		return nil, fmt.Errorf("SDK answered with an error: %s", resp.Response.Error)
+	}
+	if resp.Response.Response == nil {
+		return nil, nil
+	}
+	var body any
+	if err := json.Unmarshal(resp.Response.Response, &body); err != nil {
+		return nil, fmt.Errorf("malformed control_response %s: %w", written, err)
+	}
+	return body, nil
+}
+
+// normalize round-trips v through JSON so it compares equal to a decoded
+// response.
+func (h *Harness) normalize(v any) any {
+	var out any
+	_ = json.Unmarshal(h.marshal(v), &out)
+	return out
+}
+
+func (h *Harness) marshal(v any) json.RawMessage {
+	b, err := json.Marshal(v)
+	if err != nil {
+		h.t.Helper()
+		h.t.Errorf("claude: harness: %v", err)
+	}
+	return b
+}
+
+func (h *Harness) nextID(prefix string) string {
+	h.seq++
+	return fmt.Sprintf("%s_%d", prefix, h.seq)
+}
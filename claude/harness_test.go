@@ -0,0 +1,69 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// recordingT records the failures a Harness reports.
+type recordingT struct{ errs []string }
+
+func (r *recordingT) Helper() {}
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func TestHarness_Permission(t *testing.T) {
+	policy := func(tool string, input json.RawMessage, _ PermissionContext) PermissionResult {
+		if tool == "Bash" && strings.Contains(string(input), "rm -rf") {
+			return PermissionResult{Behavior: "deny", Message: "destructive", Interrupt: true}
+		}
+		return PermissionResult{Behavior: "allow", UpdatedInput: map[string]any{"checked": true}}
+	}
+	h := NewHarness(t, WithPermissionHandler(policy))
+	h.ExpectPermissionRequest("Bash").
+		WithInput(map[string]any{"command": "rm -rf /"}).
+		Respond(PermissionResult{Behavior: "deny", Message: "destructive", Interrupt: true})
+	h.ExpectPermissionRequest("Read").
+		Respond(PermissionResult{Behavior: "allow", UpdatedInput: map[string]any{"checked": true}})
+
+	rec := &recordingT{}
+	NewHarness(rec, WithPermissionHandler(policy)).
+		ExpectPermissionRequest("Read").
+		Respond(PermissionResult{Behavior: "deny"})
+	if len(rec.errs) != 1 || !strings.Contains(rec.errs[0], `"allowed":true`) {
+		t.Fatalf("expected one mismatch showing the SDK's answer, got %q", rec.errs)
+	}
+}
+
+func TestHarness_Hook(t *testing.T) {
+	deny := &HookOutput{Decision: "block", Reason: "no writes"}
+	h := NewHarness(t, WithHooks(map[HookEvent][]HookMatcher{
+		HookEventPreToolUse: {
+			{Matcher: "Edit|Write", Hooks: []HookFunc{func(HookEvent, json.RawMessage, string) (*HookOutput, error) {
+				return deny, nil
+			}}},
+			{Hooks: []HookFunc{func(HookEvent, json.RawMessage, string) (*HookOutput, error) {
+				return nil, nil // logging only
+			}}},
+		},
+	}))
+	h.ExpectHook(HookEventPreToolUse).ForTool("Write").Respond(*deny)
+	h.ExpectHook(HookEventPreToolUse).ForTool("Read").Respond(HookOutput{})
+
+	rec := &recordingT{}
+	NewHarness(rec).ExpectHook(HookEventStop).Respond(HookOutput{})
+	if len(rec.errs) != 1 || !strings.Contains(rec.errs[0], "no Stop hook") {
+		t.Fatalf("expected a missing-hook failure, got %q", rec.errs)
+	}
+}
+
+func TestHarness_SDKHooks(t *testing.T) {
+	// The WithAllowedDomains hook is exercised like a user hook.
+	h := NewHarness(t, WithAllowedDomains("example.com"))
+	h.ExpectHook(HookEventPreToolUse).ForTool("WebFetch").
+		WithInput(map[string]any{"tool_name": "WebFetch", "tool_input": map[string]any{"url": "https://example.com/a"}}).
+		Respond(HookOutput{})
+}
@@ -1,6 +1,11 @@
 package claude
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+)
 
 // HookEvent identifies the lifecycle event that triggered a hook callback.
 type HookEvent string
@@ -116,3 +121,81 @@ func buildHooksForInitialize(hooks map[HookEvent][]HookMatcher) (map[string]any,
 
 	return hooksConfig, reg
 }
+
+// ─── Hook payloads ────────────────────────────────────────────────────────────
+
+// PreCompactTrigger identifies what initiated a context compaction.
+type PreCompactTrigger string
+
+const (
+	// PreCompactTriggerManual is a compaction requested by the user (/compact).
+	PreCompactTriggerManual PreCompactTrigger = "manual"
+	// PreCompactTriggerAuto is a compaction started because the context window filled up.
+	PreCompactTriggerAuto PreCompactTrigger = "auto"
+)
+
+// PreCompactInfo is the decoded input of a PreCompact hook.
+type PreCompactInfo struct {
+	// SessionID is the session being compacted.
+	SessionID string `json:"session_id"`
+	// TranscriptPath is the path of the transcript file about to be compacted.
+	TranscriptPath string `json:"transcript_path"`
+	// CWD is the working directory of the session.
+	CWD string `json:"cwd"`
+	// Trigger is PreCompactTriggerManual or PreCompactTriggerAuto.
+	Trigger PreCompactTrigger `json:"trigger"`
+	// CustomInstructions holds the instructions passed to /compact, if any.
+	CustomInstructions string `json:"custom_instructions"`
+	// PreTokens is the context size in tokens before compaction, when reported.
+	PreTokens int `json:"pre_tokens,omitempty"`
+}
+
+// DecodePreCompact decodes the input of a PreCompact hook callback.
+func DecodePreCompact(input json.RawMessage) (*PreCompactInfo, error) {
+	var info PreCompactInfo
+	if err := json.Unmarshal(input, &info); err != nil {
+		return nil, fmt.Errorf("claude: decode PreCompact input: %w", err)
+	}
+	return &info, nil
+}
+
+// ToolFailureInfo is the decoded input of a PostToolUseFailure hook.
+type ToolFailureInfo struct {
+	// SessionID is the session the tool ran in.
+	SessionID string `json:"session_id"`
+	// CWD is the working directory of the session.
+	CWD string `json:"cwd"`
+	// ToolName is the name of the tool that failed (e.g. "Bash").
+	ToolName string `json:"tool_name"`
+	// ToolInput is the raw input the tool was called with.
+	ToolInput json.RawMessage `json:"tool_input"`
+	// ToolUseID identifies the failed tool call.
+	ToolUseID string `json:"tool_use_id"`
+	// Error is the failure message reported to the model.
+	Error string `json:"error"`
+	// IsInterrupt is true when the tool was stopped by a user interrupt rather
+	// than failing on its own.
+	IsInterrupt bool `json:"is_interrupt"`
+	// ExitCode is the exit status of a failed Bash command, parsed from Error;
+	// nil for other tools or when Error carries no exit code.
+	ExitCode *int `json:"-"`
+}
+
+// exitCodePattern matches the "Exit code N" prefix the CLI puts on failed Bash
+// commands.
+var exitCodePattern = regexp.MustCompile(`\bExit code (-?\d+)`)
+
+// DecodePostToolUseFailure decodes the input of a PostToolUseFailure hook
+// callback.
+func DecodePostToolUseFailure(input json.RawMessage) (*ToolFailureInfo, error) {
+	var info ToolFailureInfo
+	if err := json.Unmarshal(input, &info); err != nil {
+		return nil, fmt.Errorf("claude: decode PostToolUseFailure input: %w", err)
+	}
+	if m := exitCodePattern.FindStringSubmatch(info.Error); m != nil {
+		if code, err := strconv.Atoi(m[1]); err == nil {
+			info.ExitCode = &code
+		}
+	}
+	return &info, nil
+}
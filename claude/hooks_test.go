@@ -104,3 +104,50 @@ func TestHookEventConstants(t *testing.T) {
 		}
 	}
 }
+
+func TestDecodePreCompact(t *testing.T) {
+	input := json.RawMessage(`{"hook_event_name":"PreCompact","session_id":"s1","transcript_path":"/tmp/t.jsonl","cwd":"/work","trigger":"auto","custom_instructions":null,"pre_tokens":150000}`)
+	info, err := DecodePreCompact(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Trigger != PreCompactTriggerAuto {
+		t.Fatalf("expected trigger auto, got %q", info.Trigger)
+	}
+	if info.SessionID != "s1" || info.TranscriptPath != "/tmp/t.jsonl" {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	if info.PreTokens != 150000 {
+		t.Fatalf("expected PreTokens=150000, got %d", info.PreTokens)
+	}
+
+	if _, err := DecodePreCompact(json.RawMessage(`not json`)); err == nil {
+		t.Fatal("expected error for invalid JSON")
+	}
+}
+
+func TestDecodePostToolUseFailure(t *testing.T) {
+	input := json.RawMessage(`{"hook_event_name":"PostToolUseFailure","session_id":"s1","cwd":"/work","tool_name":"Bash","tool_input":{"command":"make test"},"tool_use_id":"tu1","error":"Exit code 2\nmake: *** [test] Error 1","is_interrupt":false}`)
+	info, err := DecodePostToolUseFailure(input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.ToolName != "Bash" || info.ToolUseID != "tu1" || info.IsInterrupt {
+		t.Fatalf("unexpected info: %+v", info)
+	}
+	if info.ExitCode == nil || *info.ExitCode != 2 {
+		t.Fatalf("expected exit code 2, got %v", info.ExitCode)
+	}
+
+	info, err = DecodePostToolUseFailure(json.RawMessage(`{"tool_name":"Read","error":"File does not exist."}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.ExitCode != nil {
+		t.Fatalf("expected no exit code, got %d", *info.ExitCode)
+	}
+
+	if _, err := DecodePostToolUseFailure(json.RawMessage(`not json`)); err == nil {
+		t.Fatal("expected error for invalid JSON")
+	}
+}
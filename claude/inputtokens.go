@@ -0,0 +1,43 @@
+package claude
+
+import "unicode/utf8"
+
+// Tokenizer counts the tokens in text. See WithTokenizer.
+type Tokenizer func(text string) int
+
+// EstimateTokens approximates the number of tokens in text without a model
+// tokenizer: one token per four bytes of ASCII, rounded up, plus one per
+// non-ASCII character. English prose and code usually come within about 20%
+// of the real count, and CJK text is counted high rather than low. It is the
+// Tokenizer WithMaxInputTokens uses by default.
+func EstimateTokens(text string) int {
+	ascii, other := 0, 0
+	for i := 0; i < len(text); {
+		if text[i] < utf8.RuneSelf {
+			ascii++
+			i++
+			continue
+		}
+		_, size := utf8.DecodeRuneInString(text[i:])
+		other++
+		i += size
+	}
+	return (ascii+3)/4 + other
+}
+
+// checkInputTokens returns a *PromptTooLargeError when prompt and the system
+// prompts in opts exceed opts.MaxInputTokens.
+func checkInputTokens(opts *Options, prompt string) error {
+	if opts.MaxInputTokens <= 0 {
+		return nil
+	}
+	count := opts.Tokenizer
+	if count == nil {
+		count = EstimateTokens
+	}
+	tokens := count(prompt) + count(opts.SystemPrompt) + count(opts.AppendSystemPrompt)
+	if tokens > opts.MaxInputTokens {
+		return &PromptTooLargeError{Tokens: tokens, Limit: opts.MaxInputTokens}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"abc", 1},
+		{"abcd", 1},
+		{"hello world", 3},
+		{"日本語", 3},
+		{"héllo", 2},
+	}
+	for _, tt := range tests {
+		if got := EstimateTokens(tt.text); got != tt.want {
+			t.Errorf("EstimateTokens(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestWithMaxInputTokens(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "spawned")
+	exe := writeFakeCLI(t, "touch "+marker+"\nexit 1\n")
+
+	_, err := Run(context.Background(), strings.Repeat("word ", 100),
+		WithClaudeExecutable(exe), WithSystemPrompt("Be brief."), WithMaxInputTokens(100))
+	var tooLarge *PromptTooLargeError
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected *PromptTooLargeError, got %T: %v", err, err)
+	}
+	if tooLarge.Tokens != 125+3 || tooLarge.Limit != 100 {
+		t.Fatalf("unexpected error: %+v", tooLarge)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("CLI was spawned for an oversized prompt")
+	}
+
+	words := func(text string) int { return len(strings.Fields(text)) }
+	_, err = Run(context.Background(), strings.Repeat("word ", 100),
+		WithClaudeExecutable(exe), WithMaxInputTokens(100), WithTokenizer(words))
+	if errors.As(err, &tooLarge) {
+		t.Fatalf("100 words should fit with a word tokenizer: %v", err)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Fatal("CLI was not spawned for a prompt within the limit")
+	}
+}
@@ -2,11 +2,19 @@ package claude
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
 	mcp "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
@@ -16,7 +24,14 @@ import (
 // The HTTP listener is bound to a random local port on 127.0.0.1 and is stopped
 // when ctx is cancelled. This is the clean Go equivalent of the TypeScript SDK's
 // McpSdkServerConfig{type:'sdk'} — HTTP is the bridge between in-process Go code
-// and the claude subprocess.
+// and the claude subprocess. StartInMemoryMCPServer avoids the HTTP hop for
+// servers that handle many calls.
+//
+// Handlers on server see the values of ctx, and while a Query or Session that
+// uses the config is running, the values, deadline and cancellation of the ctx
+// passed to it: a tool called during Run(reqCtx, ...) can read reqCtx's trace
+// ID or request ID. Values of the Query ctx take precedence over those of ctx.
+// This is done with a receiving middleware added to server.
 //
 // Example:
 //
@@ -25,30 +40,264 @@ import (
 //	result, err := claude.Run(ctx, prompt,
 //	    claude.WithMcpServers(map[string]any{"my-server": mcpCfg}),
 //	)
-func StartInProcessMCPServer(ctx context.Context, name string, server *mcp.Server) (McpHTTPServer, error) {
-	listener, err := net.Listen("tcp", "127.0.0.1:0")
+//
+// On cancellation in-flight requests get DefaultMCPShutdownTimeout to finish
+// before their connections are closed; see WithMCPShutdownTimeout and
+// WithMCPErrorHandler.
+//
+// Binary tool results, such as mcp.ImageContent, travel base64-encoded over
+// this transport and the in-memory one alike and reach the CLI byte for byte;
+// the tool_result the CLI echoes back exposes them through
+// ContentBlock.ResultImages. Each message the SDK reads is limited to 64 MiB
+// of JSON, and the CLI caps tool output on its side (see
+// WithMaxToolResultTokens), so very large images are better downscaled or
+// returned as a file path.
+func StartInProcessMCPServer(ctx context.Context, name string, server *mcp.Server, opts ...MCPServerOption) (McpHTTPServer, error) {
+	return startMCPHTTPServer(ctx, name, server, nil, opts)
+}
+
+// StartInProcessMCPServerTLS is StartInProcessMCPServer serving HTTPS with
+// tlsConfig, which must provide a server certificate. Set tlsConfig.ClientAuth
+// and ClientCAs to require client certificates (mTLS). The returned URL uses
+// the https scheme; Type stays "http", the CLI's name for the streamable HTTP
+// transport whatever the scheme.
+//
+// Use WithMCPListenAddr when the CLI runs on another host, and make sure it
+// trusts the server certificate (e.g. NODE_EXTRA_CA_CERTS via WithEnv).
+func StartInProcessMCPServerTLS(ctx context.Context, name string, server *mcp.Server, tlsConfig *tls.Config, opts ...MCPServerOption) (McpHTTPServer, error) {
+	if tlsConfig == nil || (len(tlsConfig.Certificates) == 0 && tlsConfig.GetCertificate == nil && tlsConfig.GetConfigForClient == nil) {
+		return McpHTTPServer{}, fmt.Errorf("claude: mcp %q: tls config has no server certificate", name)
+	}
+	return startMCPHTTPServer(ctx, name, server, tlsConfig, opts)
+}
+
+func startMCPHTTPServer(ctx context.Context, name string, server *mcp.Server, tlsConfig *tls.Config, opts []MCPServerOption) (McpHTTPServer, error) {
+	cfg := mcpServerConfig{addr: "127.0.0.1:0", shutdownTimeout: DefaultMCPShutdownTimeout}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	listener, err := net.Listen("tcp", cfg.addr)
 	if err != nil {
 		return McpHTTPServer{}, fmt.Errorf("claude: mcp %q: listen: %w", name, err)
 	}
+	scheme := "http"
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		scheme = "https"
+	}
+
+	contexts := &mcpContexts{base: ctx, runs: make(map[string]context.Context)}
+	server.AddReceivingMiddleware(contexts.middleware)
 
 	handler := mcp.NewStreamableHTTPHandler(func(_ *http.Request) *mcp.Server {
 		return server
 	}, nil)
 
-	httpServer := &http.Server{Handler: handler}
+	var root http.Handler = handler
+	if cfg.healthCheck {
+		mux := http.NewServeMux()
+		mux.Handle("/", handler)
+		mux.HandleFunc("GET "+mcpHealthPath, func(w http.ResponseWriter, _ *http.Request) {
+			if ctx.Err() != nil {
+				http.Error(w, "shutting down", http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = io.WriteString(w, "ok\n")
+		})
+		root = mux
+	}
+
+	httpServer := &http.Server{Handler: root}
 	go func() {
 		if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
-			// Errors after context cancellation are expected; ignore.
-			_ = err
+			cfg.reportError(fmt.Errorf("claude: mcp %q: serve: %w", name, err))
 		}
 	}()
 	go func() {
 		<-ctx.Done()
-		_ = httpServer.Shutdown(context.Background())
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+		defer cancel()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			// A handler is still running: drop its connection rather than
+			// keep the process from exiting.
+			_ = httpServer.Close()
+			cfg.reportError(fmt.Errorf("claude: mcp %q: shutdown: %w", name, err))
+		}
 	}()
 
-	serverURL := "http://" + listener.Addr().String()
-	return McpHTTPServer{Type: "http", URL: serverURL}, nil
+	serverURL := scheme + "://" + listener.Addr().String()
+	return McpHTTPServer{Type: "http", URL: serverURL, contexts: contexts}, nil
+}
+
+// mcpContextHeader carries the token that ties an HTTP MCP request to the run
+// whose CLI sent it.
+const mcpContextHeader = "X-Claude-Sdk-Run"
+
+// mcpContexts holds the contexts visible to an in-process server's handlers:
+// the server's own and those of the runs currently using it, by token.
+type mcpContexts struct {
+	base context.Context
+
+	mu   sync.Mutex
+	runs map[string]context.Context
+}
+
+// middleware gives each request a context carrying the server's values and,
+// when the request comes from a registered run, that run's values, deadline
+// and cancellation.
+func (c *mcpContexts) middleware(next mcp.MethodHandler) mcp.MethodHandler {
+	return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+		ctx = valuesContext{ctx, c.base}
+		if extra := req.GetExtra(); extra != nil && extra.Header != nil {
+			c.mu.Lock()
+			run, ok := c.runs[extra.Header.Get(mcpContextHeader)]
+			c.mu.Unlock()
+			if ok {
+				var cancel context.CancelFunc
+				ctx, cancel = withRunContext(ctx, run)
+				defer cancel()
+			}
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// valuesContext looks values up in values before falling back to Context.
+type valuesContext struct {
+	context.Context
+	values context.Context
+}
+
+func (c valuesContext) Value(key any) any {
+	if v := c.values.Value(key); v != nil {
+		return v
+	}
+	return c.Context.Value(key)
+}
+
+// withRunContext returns ctx with run's values, deadline and cancellation.
+func withRunContext(ctx, run context.Context) (context.Context, context.CancelFunc) {
+	ctx = valuesContext{ctx, run}
+	var cancel context.CancelFunc
+	if deadline, ok := run.Deadline(); ok {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	stop := context.AfterFunc(run, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// mcpRun registers one run's context with the in-process servers it uses.
+type mcpRun struct {
+	token    string
+	contexts []*mcpContexts
+}
+
+// withMCPRun returns opts with a run token header added to every server
+// started by StartInProcessMCPServer, and the mcpRun that binds the token.
+// opts itself is not modified.
+func withMCPRun(opts *Options) (*Options, *mcpRun) {
+	run := &mcpRun{token: newUUID()}
+	var servers map[string]any
+	for name, v := range opts.McpServers {
+		srv, ok := v.(McpHTTPServer)
+		if !ok || srv.contexts == nil {
+			continue
+		}
+		if servers == nil {
+			servers = maps.Clone(opts.McpServers)
+		}
+		srv.Headers = maps.Clone(srv.Headers)
+		if srv.Headers == nil {
+			srv.Headers = make(map[string]string, 1)
+		}
+		srv.Headers[mcpContextHeader] = run.token
+		servers[name] = srv
+		run.contexts = append(run.contexts, srv.contexts)
+	}
+	if servers == nil {
+		return opts, run
+	}
+	o := *opts
+	o.McpServers = servers
+	return &o, run
+}
+
+// bind makes ctx visible to handlers of requests carrying the run's token.
+func (r *mcpRun) bind(ctx context.Context) {
+	for _, c := range r.contexts {
+		c.mu.Lock()
+		c.runs[r.token] = ctx
+		c.mu.Unlock()
+	}
+}
+
+// release forgets the run's context once the run has ended.
+func (r *mcpRun) release() {
+	for _, c := range r.contexts {
+		c.mu.Lock()
+		delete(c.runs, r.token)
+		c.mu.Unlock()
+	}
+}
+
+// DefaultMCPShutdownTimeout is how long StartInProcessMCPServer waits for
+// in-flight requests once its context is cancelled.
+const DefaultMCPShutdownTimeout = 5 * time.Second
+
+// MCPServerOption configures StartInProcessMCPServer.
+type MCPServerOption func(*mcpServerConfig)
+
+type mcpServerConfig struct {
+	addr            string
+	shutdownTimeout time.Duration
+	onError         func(error)
+	healthCheck     bool
+}
+
+// mcpHealthPath is where WithMCPHealthCheck serves the health check.
+const mcpHealthPath = "/healthz"
+
+func (c *mcpServerConfig) reportError(err error) {
+	if c.onError != nil {
+		c.onError(err)
+	}
+}
+
+// WithMCPShutdownTimeout sets how long the server waits for in-flight requests
+// after its context is cancelled before closing their connections. Defaults to
+// DefaultMCPShutdownTimeout.
+func WithMCPShutdownTimeout(d time.Duration) MCPServerOption {
+	return func(c *mcpServerConfig) { c.shutdownTimeout = d }
+}
+
+// WithMCPListenAddr sets the TCP address the server listens on, such as
+// "10.0.0.5:8443" or ":0". Defaults to a random port on 127.0.0.1. The
+// returned URL is built from the bound address, so rewrite its host when the
+// CLI reaches the server through another name.
+func WithMCPListenAddr(addr string) MCPServerOption {
+	return func(c *mcpServerConfig) { c.addr = addr }
+}
+
+// WithMCPHealthCheck also serves GET /healthz on the server's listener, below
+// the returned URL. It answers 200 while the server accepts requests and 503
+// once its context is cancelled. The listener is bound before
+// StartInProcessMCPServer returns, so the check succeeds as soon as the URL is
+// known; it is meant for orchestrators and probes that only see the URL.
+func WithMCPHealthCheck() MCPServerOption {
+	return func(c *mcpServerConfig) { c.healthCheck = true }
+}
+
+// WithMCPErrorHandler sets a callback for errors the server hits after it has
+// started: the listener failing, or shutdown timing out (the error then wraps
+// context.DeadlineExceeded). It is called from the server's goroutines.
+func WithMCPErrorHandler(fn func(error)) MCPServerOption {
+	return func(c *mcpServerConfig) { c.onError = fn }
 }
 
 // ServeStdioMCP runs server as an MCP stdio server, reading from os.Stdin and
@@ -85,3 +334,147 @@ func SelfAsStdioMCPServer(extraArgs ...string) (McpStdioServer, error) {
 		Args:    extraArgs,
 	}, nil
 }
+
+// StartInMemoryMCPServer connects server to an in-memory transport and returns
+// the McpSdkServer config to pass to WithMcpServers under the same name.
+//
+// Unlike StartInProcessMCPServer there is no listener: the CLI forwards each
+// JSON-RPC message as an mcp_message control request on the subprocess's
+// stdin/stdout, and the SDK relays it to server over a pipe. This saves the
+// HTTP round trip, connection handling and SSE framing per tool call (see
+// BenchmarkMCPToolCall), at the cost of sharing the control channel with the
+// rest of the session. Server-to-client requests such as sampling or roots are
+// answered with a method-not-found error, and server notifications are
+// dropped, because the control channel has no way to deliver them to the CLI.
+// Handlers see only the values of ctx, not those of the Query that made the call.
+//
+// The connection is closed when ctx is cancelled. The config can be reused
+// across queries and sessions.
+//
+// Example:
+//
+//	mcpCfg, err := claude.StartInMemoryMCPServer(ctx, "my-server", server)
+//	if err != nil { ... }
+//	result, err := claude.Run(ctx, prompt,
+//	    claude.WithMcpServers(map[string]any{"my-server": mcpCfg}),
+//	)
+func StartInMemoryMCPServer(ctx context.Context, name string, server *mcp.Server) (McpSdkServer, error) {
+	serverT, clientT := mcp.NewInMemoryTransports()
+	session, err := server.Connect(ctx, serverT, nil)
+	if err != nil {
+		return McpSdkServer{}, fmt.Errorf("claude: mcp %q: connect: %w", name, err)
+	}
+	conn, err := clientT.Connect(ctx)
+	if err != nil {
+		_ = session.Close()
+		return McpSdkServer{}, fmt.Errorf("claude: mcp %q: connect: %w", name, err)
+	}
+
+	b := &mcpBridge{conn: conn, pending: make(map[string]chan *jsonrpc.Response), done: make(chan struct{})}
+	go b.readLoop()
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+		_ = session.Close()
+	}()
+	return McpSdkServer{Type: "sdk", Name: name, bridge: b}, nil
+}
+
+// DefaultMCPCallTimeout is how long the SDK waits for an in-memory MCP server
+// to answer a request relayed from the CLI before answering the CLI with an
+// error and cancelling the request.
+const DefaultMCPCallTimeout = 10 * time.Minute
+
+// mcpBridge relays JSON-RPC messages between the CLI's control channel and an
+// in-memory MCP server connection.
+//
+// One bridge serves every CLI the config is passed to, and each CLI numbers
+// its requests from the same start, so requests are forwarded under
+// bridge-unique IDs and the CLI's ID is restored on the response.
+type mcpBridge struct {
+	conn mcp.Connection
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[string]chan *jsonrpc.Response // keyed by bridge request ID
+	done    chan struct{}                     // closed when the connection fails
+}
+
+// call sends msg, one JSON-RPC message from the CLI, to the server. For a
+// request it waits for and returns the server's response; for a notification
+// or response it returns nil once the message is written. When ctx ends
+// first, the server is told to cancel the request.
+func (b *mcpBridge) call(ctx context.Context, msg json.RawMessage) (json.RawMessage, error) {
+	decoded, err := jsonrpc.DecodeMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	req, ok := decoded.(*jsonrpc.Request)
+	if !ok || !req.IsCall() {
+		return nil, b.conn.Write(ctx, decoded)
+	}
+
+	ch := make(chan *jsonrpc.Response, 1)
+	b.mu.Lock()
+	b.nextID++
+	key := fmt.Sprintf("claude-bridge-%d", b.nextID)
+	b.pending[key] = ch
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		delete(b.pending, key)
+		b.mu.Unlock()
+	}()
+
+	callerID := req.ID
+	forwarded := *req
+	forwarded.ID, err = jsonrpc.MakeID(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.conn.Write(ctx, &forwarded); err != nil {
+		return nil, err
+	}
+	select {
+	case resp := <-ch:
+		restored := *resp
+		restored.ID = callerID
+		return jsonrpc.EncodeMessage(&restored)
+	case <-b.done:
+		return nil, errors.New("mcp server connection closed")
+	case <-ctx.Done():
+		params, _ := json.Marshal(map[string]any{"requestId": key, "reason": ctx.Err().Error()})
+		_ = b.conn.Write(context.Background(), &jsonrpc.Request{Method: "notifications/cancelled", Params: params})
+		return nil, ctx.Err()
+	}
+}
+
+// readLoop delivers the server's responses to waiting calls until the
+// connection is closed.
+func (b *mcpBridge) readLoop() {
+	defer close(b.done)
+	ctx := context.Background()
+	for {
+		msg, err := b.conn.Read(ctx)
+		if err != nil {
+			return
+		}
+		switch m := msg.(type) {
+		case *jsonrpc.Response:
+			b.mu.Lock()
+			ch, ok := b.pending[fmt.Sprint(m.ID.Raw())]
+			b.mu.Unlock()
+			if ok {
+				ch <- m
+			}
+		case *jsonrpc.Request:
+			if m.IsCall() {
+				resp := &jsonrpc.Response{ID: m.ID, Error: &jsonrpc.Error{
+					Code:    jsonrpc.CodeMethodNotFound,
+					Message: "claude: " + m.Method + " is not supported by the in-memory transport",
+				}}
+				_ = b.conn.Write(ctx, resp)
+			}
+		}
+	}
+}
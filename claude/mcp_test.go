@@ -0,0 +1,568 @@
+package claude
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	mcp "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+type echoInput struct {
+	Text string `json:"text"`
+}
+
+func newEchoServer() *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "echo", Version: SDKVersion}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "echo", Description: "Echo text"},
+		func(ctx context.Context, req *mcp.CallToolRequest, in echoInput) (*mcp.CallToolResult, any, error) {
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: in.Text}}}, nil, nil
+		})
+	return server
+}
+
+// mcpControlRequest wraps a JSON-RPC message the way the CLI forwards it.
+func mcpControlRequest(id, msg string) []byte {
+	return []byte(fmt.Sprintf(`{"type":"control_request","request_id":%q,"request":{"subtype":"mcp_message","server_name":"echo","message":%s}}`, id, msg))
+}
+
+func TestStartInMemoryMCPServer(t *testing.T) {
+	cfg, err := StartInMemoryMCPServer(t.Context(), "echo", newEchoServer())
+	if err != nil {
+		t.Fatalf("StartInMemoryMCPServer: %v", err)
+	}
+	if b, _ := json.Marshal(cfg); string(b) != `{"type":"sdk","name":"echo"}` {
+		t.Fatalf("unexpected config JSON %s", b)
+	}
+
+	responses := make(chan string, 1)
+	write := func(v any) error {
+		b, _ := json.Marshal(v)
+		responses <- string(b)
+		return nil
+	}
+	opts := defaultOptions()
+	WithMcpServers(map[string]any{"echo": cfg})(opts)
+	exchange := func(id, msg string) string {
+		t.Helper()
+		handleControlRequest(mcpControlRequest(id, msg), write, opts, hookRegistry{})
+		select {
+		case resp := <-responses:
+			if !strings.Contains(resp, `"request_id":"`+id+`"`) {
+				t.Fatalf("response for the wrong request: %s", resp)
+			}
+			return resp
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for the response to %s", id)
+			return ""
+		}
+	}
+
+	if resp := exchange("c1", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"claude","version":"1"}}}`); !strings.Contains(resp, `"serverInfo"`) {
+		t.Fatalf("unexpected initialize response: %s", resp)
+	}
+	if resp := exchange("c2", `{"jsonrpc":"2.0","method":"notifications/initialized"}`); !strings.Contains(resp, `"mcp_response":{"jsonrpc":"2.0","result":{}}`) {
+		t.Fatalf("unexpected notification ack: %s", resp)
+	}
+	resp := exchange("c3", `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hello"}}}`)
+	if !strings.Contains(resp, `"id":2`) || !strings.Contains(resp, `"text":"hello"`) {
+		t.Fatalf("unexpected tools/call response: %s", resp)
+	}
+}
+
+// TestStartInMemoryMCPServer_SharedAcrossCLIs is a regression test for two CLIs
+// using one config: both number their requests from 1, and each must get the
+// response to its own request.
+func TestStartInMemoryMCPServer_SharedAcrossCLIs(t *testing.T) {
+	server := newEchoServer()
+	release := make(chan struct{})
+	mcp.AddTool(server, &mcp.Tool{Name: "wait", Description: "Block until released"},
+		func(ctx context.Context, req *mcp.CallToolRequest, in echoInput) (*mcp.CallToolResult, any, error) {
+			<-release
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: in.Text}}}, nil, nil
+		})
+	cfg, err := StartInMemoryMCPServer(t.Context(), "echo", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.bridge.call(t.Context(), json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"claude","version":"1"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cfg.bridge.call(t.Context(), json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan string, 2)
+	for _, text := range []string{"first", "second"} {
+		go func() {
+			resp, err := cfg.bridge.call(t.Context(), json.RawMessage(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"wait","arguments":{"text":"`+text+`"}}}`))
+			if err != nil {
+				results <- err.Error()
+				return
+			}
+			results <- string(resp)
+		}()
+	}
+	// Wait until both calls are pending before letting the tool answer.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cfg.bridge.mu.Lock()
+		n := len(cfg.bridge.pending)
+		cfg.bridge.mu.Unlock()
+		if n == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d calls pending, want 2", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	got := map[string]bool{}
+	for range 2 {
+		select {
+		case resp := <-results:
+			if !strings.Contains(resp, `"id":2`) {
+				t.Fatalf("response lost the caller's id: %s", resp)
+			}
+			for _, text := range []string{"first", "second"} {
+				if strings.Contains(resp, `"text":"`+text+`"`) {
+					got[text] = true
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for both responses")
+		}
+	}
+	if !got["first"] || !got["second"] {
+		t.Fatalf("responses crossed: %v", got)
+	}
+}
+
+func TestMCPBridge_CallTimeout(t *testing.T) {
+	server := newEchoServer()
+	cancelled := make(chan struct{})
+	mcp.AddTool(server, &mcp.Tool{Name: "hang", Description: "Block until cancelled"},
+		func(ctx context.Context, req *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+			<-ctx.Done()
+			close(cancelled)
+			return nil, nil, ctx.Err()
+		})
+	cfg, err := StartInMemoryMCPServer(t.Context(), "echo", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := cfg.bridge
+	if _, err := b.call(t.Context(), json.RawMessage(`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"claude","version":"1"}}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.call(t.Context(), json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := b.call(ctx, json.RawMessage(`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"hang","arguments":{}}}`)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server was not told to cancel the request")
+	}
+}
+
+// newImageServer serves a "screenshot" tool returning png as mcp.ImageContent.
+func newImageServer(png []byte) *mcp.Server {
+	server := mcp.NewServer(&mcp.Implementation{Name: "shots", Version: SDKVersion}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "screenshot", Description: "Capture the screen"},
+		func(ctx context.Context, req *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+			return &mcp.CallToolResult{Content: []mcp.Content{
+				&mcp.TextContent{Text: "captured"},
+				&mcp.ImageContent{MIMEType: "image/png", Data: png},
+			}}, nil, nil
+		})
+	return server
+}
+
+// TestMCPServer_BinaryContent is a regression test for image results being
+// mangled on their way to the CLI: the bytes must survive both transports,
+// including the control_response the SDK writes for in-memory servers.
+func TestMCPServer_BinaryContent(t *testing.T) {
+	png := make([]byte, 256*1024)
+	for i := range png {
+		png[i] = byte(i * 7)
+	}
+	copy(png, "\x89PNG\r\n\x1a\n<&>\x00\u2028")
+	checkImage := func(t *testing.T, res *mcp.CallToolResult) {
+		t.Helper()
+		if len(res.Content) != 2 {
+			t.Fatalf("got %d content blocks, want 2", len(res.Content))
+		}
+		img, ok := res.Content[1].(*mcp.ImageContent)
+		if !ok {
+			t.Fatalf("second block is %T, want *mcp.ImageContent", res.Content[1])
+		}
+		if img.MIMEType != "image/png" || !bytes.Equal(img.Data, png) {
+			t.Fatalf("image changed in transit: %s, %d bytes", img.MIMEType, len(img.Data))
+		}
+	}
+	call := &mcp.CallToolParams{Name: "screenshot", Arguments: map[string]any{}}
+
+	t.Run("http", func(t *testing.T) {
+		cfg, err := StartInProcessMCPServer(t.Context(), "shots", newImageServer(png))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "1"}, nil)
+		session, err := client.Connect(t.Context(), &mcp.StreamableClientTransport{Endpoint: cfg.URL}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer session.Close()
+		res, err := session.CallTool(t.Context(), call)
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		checkImage(t, res)
+	})
+
+	t.Run("in-memory", func(t *testing.T) {
+		cfg, err := StartInMemoryMCPServer(t.Context(), "echo", newImageServer(png))
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts := defaultOptions()
+		WithMcpServers(map[string]any{"echo": cfg})(opts)
+		responses := make(chan []byte, 1)
+		write := func(v any) error {
+			b, err := json.Marshal(v)
+			responses <- b
+			return err
+		}
+		exchange := func(id, msg string) []byte {
+			t.Helper()
+			handleControlRequest(mcpControlRequest(id, msg), write, opts, hookRegistry{})
+			select {
+			case b := <-responses:
+				return b
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for the response to %s", id)
+				return nil
+			}
+		}
+		exchange("c1", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"claude","version":"1"}}}`)
+		exchange("c2", `{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+		raw := exchange("c3", `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"screenshot","arguments":{}}}`)
+
+		var resp struct {
+			Response struct {
+				Response struct {
+					MCPResponse struct {
+						Result *mcp.CallToolResult `json:"result"`
+					} `json:"mcp_response"`
+				} `json:"response"`
+			} `json:"response"`
+		}
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			t.Fatalf("decode control_response: %v", err)
+		}
+		if resp.Response.Response.MCPResponse.Result == nil {
+			t.Fatalf("no tool result in %.200s", raw)
+		}
+		checkImage(t, resp.Response.Response.MCPResponse.Result)
+	})
+}
+
+// BenchmarkMCPToolCall compares a tool call over the loopback HTTP transport
+// of StartInProcessMCPServer with the in-memory relay of StartInMemoryMCPServer.
+// The HTTP figure excludes the CLI side; the in-memory figure excludes the
+// control-channel hop through the subprocess's stdin/stdout.
+func BenchmarkMCPToolCall(b *testing.B) {
+	ctx := b.Context()
+	call := &mcp.CallToolParams{Name: "echo", Arguments: map[string]any{"text": "hello"}}
+
+	b.Run("http", func(b *testing.B) {
+		cfg, err := StartInProcessMCPServer(ctx, "echo", newEchoServer())
+		if err != nil {
+			b.Fatal(err)
+		}
+		client := mcp.NewClient(&mcp.Implementation{Name: "bench", Version: "1"}, nil)
+		session, err := client.Connect(ctx, &mcp.StreamableClientTransport{Endpoint: cfg.URL}, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer session.Close()
+		for b.Loop() {
+			if _, err := session.CallTool(ctx, call); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("in-memory", func(b *testing.B) {
+		cfg, err := StartInMemoryMCPServer(ctx, "echo", newEchoServer())
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := cfg.bridge.call(ctx, json.RawMessage(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"bench","version":"1"}}}`)); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := cfg.bridge.call(ctx, json.RawMessage(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)); err != nil {
+			b.Fatal(err)
+		}
+		id := 0
+		for b.Loop() {
+			id++
+			msg := fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":"echo","arguments":{"text":"hello"}}}`, id)
+			if _, err := cfg.bridge.call(ctx, json.RawMessage(msg)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+type ctxKey string
+
+// headerTransport adds fixed headers to every request, as the CLI does with
+// McpHTTPServer.Headers.
+type headerTransport map[string]string
+
+func (h headerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	for k, v := range h {
+		r.Header.Set(k, v)
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestStartInProcessMCPServer_RunContext(t *testing.T) {
+	server := mcp.NewServer(&mcp.Implementation{Name: "ctx", Version: SDKVersion}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "whoami", Description: "Report context values"},
+		func(ctx context.Context, req *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+			_, hasDeadline := ctx.Deadline()
+			text := fmt.Sprintf("%v %v %v", ctx.Value(ctxKey("app")), ctx.Value(ctxKey("trace")), hasDeadline)
+			return &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: text}}}, nil, nil
+		})
+	base := context.WithValue(t.Context(), ctxKey("app"), "billing")
+	cfg, err := StartInProcessMCPServer(base, "ctx", server)
+	if err != nil {
+		t.Fatalf("StartInProcessMCPServer: %v", err)
+	}
+
+	opts, run := withMCPRun(&Options{McpServers: map[string]any{"ctx": cfg}})
+	routed := opts.McpServers["ctx"].(McpHTTPServer)
+	if routed.Headers[mcpContextHeader] == "" {
+		t.Fatalf("expected a run header, got %v", routed.Headers)
+	}
+	if cfg.Headers != nil {
+		t.Fatal("withMCPRun modified the caller's config")
+	}
+	runCtx, cancel := context.WithTimeout(context.WithValue(t.Context(), ctxKey("trace"), "t-123"), time.Minute)
+	defer cancel()
+	run.bind(runCtx)
+
+	call := func(headers map[string]string) string {
+		t.Helper()
+		client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "1"}, nil)
+		session, err := client.Connect(t.Context(), &mcp.StreamableClientTransport{
+			Endpoint:   routed.URL,
+			HTTPClient: &http.Client{Transport: headerTransport(headers)},
+		}, nil)
+		if err != nil {
+			t.Fatalf("connect: %v", err)
+		}
+		defer session.Close()
+		res, err := session.CallTool(t.Context(), &mcp.CallToolParams{Name: "whoami", Arguments: map[string]any{}})
+		if err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+		return res.Content[0].(*mcp.TextContent).Text
+	}
+
+	if got := call(routed.Headers); got != "billing t-123 true" {
+		t.Fatalf("expected the run's values and deadline, got %q", got)
+	}
+	run.release()
+	if got := call(routed.Headers); got != "billing <nil> false" {
+		t.Fatalf("expected only the server's values after release, got %q", got)
+	}
+}
+
+func TestStartInProcessMCPServer_ShutdownTimeout(t *testing.T) {
+	entered, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	server := mcp.NewServer(&mcp.Implementation{Name: "stuck", Version: SDKVersion}, nil)
+	mcp.AddTool(server, &mcp.Tool{Name: "stuck", Description: "Never returns on its own"},
+		func(ctx context.Context, req *mcp.CallToolRequest, _ struct{}) (*mcp.CallToolResult, any, error) {
+			close(entered)
+			<-release
+			return &mcp.CallToolResult{}, nil, nil
+		})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	errs := make(chan error, 1)
+	cfg, err := StartInProcessMCPServer(ctx, "stuck", server,
+		WithMCPShutdownTimeout(50*time.Millisecond),
+		WithMCPErrorHandler(func(err error) { errs <- err }))
+	if err != nil {
+		t.Fatalf("StartInProcessMCPServer: %v", err)
+	}
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "1"}, nil)
+	session, err := client.Connect(t.Context(), &mcp.StreamableClientTransport{Endpoint: cfg.URL}, nil)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer session.Close()
+	go func() {
+		_, _ = session.CallTool(t.Context(), &mcp.CallToolParams{Name: "stuck", Arguments: map[string]any{}})
+	}()
+	<-entered
+
+	cancel()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected a shutdown deadline error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown did not give up on the stuck handler")
+	}
+}
+
+func TestStartInProcessMCPServer_HealthCheck(t *testing.T) {
+	cfg, err := StartInProcessMCPServer(t.Context(), "echo", newEchoServer(), WithMCPHealthCheck())
+	if err != nil {
+		t.Fatalf("StartInProcessMCPServer: %v", err)
+	}
+	resp, err := http.Get(cfg.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("GET /healthz: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	// The MCP endpoint itself is unaffected.
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "1"}, nil)
+	session, err := client.Connect(t.Context(), &mcp.StreamableClientTransport{Endpoint: cfg.URL}, nil)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer session.Close()
+	if _, err := session.CallTool(t.Context(), &mcp.CallToolParams{Name: "echo", Arguments: map[string]any{"text": "hi"}}); err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+}
+
+// testCA issues certificates for the TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestStartInProcessMCPServerTLS(t *testing.T) {
+	if _, err := StartInProcessMCPServerTLS(t.Context(), "echo", newEchoServer(), &tls.Config{}); err == nil {
+		t.Fatal("expected an error for a tls config without a certificate")
+	}
+
+	ca := newTestCA(t)
+	cfg, err := StartInProcessMCPServerTLS(t.Context(), "echo", newEchoServer(), &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	})
+	if err != nil {
+		t.Fatalf("StartInProcessMCPServerTLS: %v", err)
+	}
+	if cfg.Type != "http" || !strings.HasPrefix(cfg.URL, "https://127.0.0.1:") {
+		t.Fatalf("unexpected config %+v", cfg)
+	}
+
+	connect := func(certs []tls.Certificate) error {
+		client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "1"}, nil)
+		session, err := client.Connect(t.Context(), &mcp.StreamableClientTransport{
+			Endpoint: cfg.URL,
+			HTTPClient: &http.Client{Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: ca.pool, Certificates: certs},
+			}},
+		}, nil)
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+		_, err = session.CallTool(t.Context(), &mcp.CallToolParams{Name: "echo", Arguments: map[string]any{"text": "hi"}})
+		return err
+	}
+	if err := connect([]tls.Certificate{ca.issue(t, x509.ExtKeyUsageClientAuth)}); err != nil {
+		t.Fatalf("expected the client certificate to be accepted: %v", err)
+	}
+	if err := connect(nil); err == nil {
+		t.Fatal("expected a connection without a client certificate to fail")
+	}
+}
@@ -0,0 +1,120 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MemoryStore holds long-term memory carried across runs; see WithMemory.
+// Save may be called from the SDK's goroutines, at most once at a time per
+// run.
+type MemoryStore interface {
+	// Load returns the current memory, "" when there is none.
+	Load() string
+	// Save replaces the memory with the model's updated version.
+	Save(memory string)
+}
+
+// memoryFileName is the file the model edits to update its memory.
+const memoryFileName = "MEMORY.md"
+
+// memoryPrompt is appended to the system prompt; %s is the memory file path
+// and %s the memory itself.
+const memoryPrompt = `
+
+# Memory
+
+You have a long-term memory that persists across conversations. It is kept in
+the file %s and its current content is below. When you learn something worth
+remembering, such as a user preference, update that file with the Edit or
+Write tool; keep it short and organised, and remove entries that no longer
+apply. It is saved when you finish.
+
+<memory>
+%s
+</memory>`
+
+// memoryRun is the per-run state of WithMemory: a temporary directory holding
+// the memory file, and the content last loaded or saved.
+type memoryRun struct {
+	store MemoryStore
+	dir   string
+	mu    sync.Mutex
+	last  string
+}
+
+// withMemory returns opts prepared for opts.Memory: the memory is loaded into
+// a file in a new temporary directory the CLI may access, described in the
+// appended system prompt, and saved by a Stop hook. opts itself is not
+// modified. The returned memoryRun is nil without a MemoryStore.
+func withMemory(opts *Options) (*Options, *memoryRun, error) {
+	if opts.Memory == nil {
+		return opts, nil, nil
+	}
+	dir, err := os.MkdirTemp("", "claude-memory-")
+	if err != nil {
+		return nil, nil, fmt.Errorf("claude: memory: %w", err)
+	}
+	run := &memoryRun{store: opts.Memory, dir: dir, last: opts.Memory.Load()}
+	if err := os.WriteFile(run.path(), []byte(run.last), 0o600); err != nil {
+		os.RemoveAll(dir)
+		return nil, nil, fmt.Errorf("claude: memory: %w", err)
+	}
+	o := *opts
+	o.AppendSystemPrompt += fmt.Sprintf(memoryPrompt, run.path(), run.last)
+	o.AdditionalDirectories = append(append([]string(nil), opts.AdditionalDirectories...), dir)
+	o.Hooks = withHook(opts.Hooks, HookEventStop, "", func(HookEvent, json.RawMessage, string) (*HookOutput, error) {
+		run.commit()
+		return nil, nil
+	})
+	return &o, run, nil
+}
+
+func (r *memoryRun) path() string { return filepath.Join(r.dir, memoryFileName) }
+
+// commit saves the memory file when the model changed it. It is a no-op on a
+// nil memoryRun.
+func (r *memoryRun) commit() {
+	if r == nil {
+		return
+	}
+	b, err := os.ReadFile(r.path())
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if string(b) != r.last {
+		r.last = string(b)
+		r.store.Save(r.last)
+	}
+}
+
+// release saves any change the Stop hook missed, e.g. in an interrupted turn,
+// and removes the directory. It is a no-op on a nil memoryRun.
+func (r *memoryRun) release() {
+	if r == nil {
+		return
+	}
+	r.commit()
+	os.RemoveAll(r.dir)
+}
+
+// FileMemoryStore is a MemoryStore kept in a file at the given path. A
+// missing file is empty memory; write errors are ignored, so use a path the
+// process can write.
+type FileMemoryStore string
+
+// Load implements MemoryStore.
+func (f FileMemoryStore) Load() string {
+	b, _ := os.ReadFile(string(f))
+	return string(b)
+}
+
+// Save implements MemoryStore.
+func (f FileMemoryStore) Save(memory string) {
+	_ = os.WriteFile(string(f), []byte(memory), 0o600)
+}
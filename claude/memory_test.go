@@ -0,0 +1,74 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWithMemory_StopHookSaves(t *testing.T) {
+	store := FileMemoryStore(filepath.Join(t.TempDir(), "memory.md"))
+	store.Save("- prefers tabs\n")
+
+	opts, run, err := withMemory(&Options{AppendSystemPrompt: "Be brief.", Memory: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer run.release()
+	if !strings.HasPrefix(opts.AppendSystemPrompt, "Be brief.") || !strings.Contains(opts.AppendSystemPrompt, "- prefers tabs") {
+		t.Fatalf("memory missing from the system prompt: %q", opts.AppendSystemPrompt)
+	}
+	if len(opts.AdditionalDirectories) != 1 || opts.AdditionalDirectories[0] != run.dir {
+		t.Fatalf("AdditionalDirectories = %v, want [%s]", opts.AdditionalDirectories, run.dir)
+	}
+
+	if err := os.WriteFile(run.path(), []byte("- prefers tabs\n- uses Go 1.24\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stop := opts.Hooks[HookEventStop][0].Hooks[0]
+	if _, err := stop(HookEventStop, json.RawMessage(`{}`), ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Load(); got != "- prefers tabs\n- uses Go 1.24\n" {
+		t.Fatalf("saved memory = %q", got)
+	}
+
+	run.release()
+	if _, err := os.Stat(run.dir); !os.IsNotExist(err) {
+		t.Fatalf("memory directory not removed: %v", err)
+	}
+}
+
+func TestWithMemory_Query(t *testing.T) {
+	store := FileMemoryStore(filepath.Join(t.TempDir(), "memory.md"))
+	store.Save("old")
+
+	// The fake CLI checks that the memory reached the initialize message,
+	// then edits the memory file in the --add-dir directory without running a
+	// Stop hook; the SDK still saves the change with the result.
+	exe := writeFakeCLI(t, `while [ $# -gt 0 ]; do
+  [ "$1" = "--add-dir" ] && dir="$2"
+  shift
+done
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      printf 'new' > "$dir/MEMORY.md"
+      echo '{"type":"result","subtype":"success","result":"ok","session_id":"s1","is_error":false}'
+      exit 0 ;;
+    *'"subtype":"initialize"'*)
+      printf '%s' "$line" | grep -qF 'memory\u003e\nold\n' ||
+        { echo "memory not in initialize" >&2; exit 1; } ;;
+  esac
+done
+`)
+	if _, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithMemory(store)); err != nil {
+		t.Fatal(err)
+	}
+	if got := store.Load(); got != "new" {
+		t.Fatalf("saved memory = %q, want %q", got, "new")
+	}
+}
@@ -4,7 +4,12 @@
 // of @anthropic-ai/claude-agent-sdk.
 package claude
 
-import "encoding/json"
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 // MessageType is the discriminant field present on every message.
 type MessageType string
@@ -39,36 +44,213 @@ const (
 	TypeHookResponse MessageType = "hook_response"
 	// TypeCompactBoundary marks context compaction boundaries.
 	TypeCompactBoundary MessageType = "compact_boundary"
+	// TypeCompaction carries the summary the CLI continues a compacted
+	// conversation from; see Event.Compaction. The CLI sends it as a user
+	// message marked isCompactSummary, which parseLine reports under this type.
+	TypeCompaction MessageType = "compaction"
 	// TypeFilesPersisted is emitted when files are checkpointed to disk.
 	TypeFilesPersisted MessageType = "files_persisted"
 	// TypeAuthStatus carries authentication status updates.
 	TypeAuthStatus MessageType = "auth_status"
 	// TypePromptSuggestion carries prompt suggestions from the agent.
 	TypePromptSuggestion MessageType = "prompt_suggestion"
+	// TypeUser echoes a user turn, including tool results fed back to the
+	// model (SDKUserMessage).
+	TypeUser MessageType = "user"
+	// TypeTurnStart and TypeTurnEnd are synthetic markers emitted by the SDK
+	// around each agent turn when WithTurnMarkers is set; see Event.Turn.
+	TypeTurnStart MessageType = "turn_start"
+	TypeTurnEnd   MessageType = "turn_end"
 )
 
 // System message subtype constants.
 const (
 	SubtypeInit   = "init"
 	SubtypeStatus = "status"
+	// SubtypeWarning marks a synthetic, non-fatal warning emitted by the SDK
+	// itself (for example when an option references something the CLI does not
+	// report as available). The text is in SystemMessage.Message.
+	SubtypeWarning = "warning"
+	// SubtypeCompactBoundary is emitted by the CLI after it compacted the
+	// conversation; see SystemMessage.CompactMetadata.
+	SubtypeCompactBoundary = "compact_boundary"
 )
 
+// maxLineSize is the largest single message, in bytes of JSON, that the SDK
+// reads from the CLI or a transcript. Tool results carrying images arrive
+// base64-encoded, a third larger than the raw bytes, so this leaves room for
+// screenshots well beyond the per-image limits of the API. A longer line ends
+// the stream with a bufio.ErrTooLong error.
+const maxLineSize = 64 * 1024 * 1024
+
 // ─── Content blocks ────────────────────────────────────────────────────────────
 
-// ContentBlock is one element of an assistant message's content array.
-// Type is always set; Text and Thinking are populated based on Type.
+// ContentBlock is one element of a message's content array.
+// Type is always set; the remaining fields are populated based on Type.
 type ContentBlock struct {
 	Type     string `json:"type"`
 	Text     string `json:"text,omitempty"`
 	Thinking string `json:"thinking,omitempty"`
+
+	// Signature verifies a thinking block when it is passed back to the model.
+	Signature string `json:"signature,omitempty"`
+	// Data is the encrypted content of a redacted_thinking block. It is opaque
+	// and must be passed back unchanged.
+	Data string `json:"data,omitempty"`
+
+	// Citations links a text block to the sources backing it; nil when the
+	// block cites nothing.
+	Citations []Citation `json:"citations,omitempty"`
+
+	// Source holds the data of an image block.
+	Source *ImageSource `json:"source,omitempty"`
+
+	// tool_use and server_tool_use fields.
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	// tool_result and web_search_tool_result fields. For tool_result, Content is
+	// either a JSON string or an array of content blocks; use ResultText to
+	// flatten it. For web_search_tool_result use WebSearchResults.
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   json.RawMessage `json:"content,omitempty"`
+	IsError   bool            `json:"is_error,omitempty"`
+
+	// DurationMS is how long the tool ran, measured by the SDK from the
+	// tool_use block to this tool_result. Set on tool_result blocks of
+	// TypeUser events only; the CLI does not report tool timing itself.
+	DurationMS int64 `json:"-"`
+}
+
+// ResultText returns the text of a tool_result block's Content, concatenating
+// the text blocks when Content is an array.
+func (b ContentBlock) ResultText() string {
+	var str string
+	if err := json.Unmarshal(b.Content, &str); err == nil {
+		return str
+	}
+	var blocks []ContentBlock
+	if err := json.Unmarshal(b.Content, &blocks); err != nil {
+		return ""
+	}
+	var out string
+	for _, c := range blocks {
+		if c.Type == "text" {
+			out += c.Text
+		}
+	}
+	return out
+}
+
+// ResultImages returns the image blocks of a tool_result block's Content, such
+// as the mcp.ImageContent an MCP tool returned, in order.
+func (b ContentBlock) ResultImages() []ImageSource {
+	var blocks []ContentBlock
+	if err := json.Unmarshal(b.Content, &blocks); err != nil {
+		return nil
+	}
+	var out []ImageSource
+	for _, c := range blocks {
+		if c.Type == "image" && c.Source != nil {
+			out = append(out, *c.Source)
+		}
+	}
+	return out
+}
+
+// ImageSource is the source of an image block. The CLI sends images inline,
+// with Type "base64" and the encoded bytes in Data.
+type ImageSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+// Bytes decodes Data, returning the image exactly as the tool produced it.
+func (s ImageSource) Bytes() ([]byte, error) {
+	if s.Type != "base64" {
+		return nil, fmt.Errorf("claude: image source type %q has no inline data", s.Type)
+	}
+	b, err := base64.StdEncoding.DecodeString(s.Data)
+	if err != nil {
+		return nil, fmt.Errorf("claude: decode image: %w", err)
+	}
+	return b, nil
+}
+
+// Citation references the source of a claim in a text block. Type selects
+// which location fields are set:
+//   - "char_location": DocumentIndex, StartCharIndex, EndCharIndex (plain text documents)
+//   - "page_location": DocumentIndex, StartPageNumber, EndPageNumber (PDFs)
+//   - "content_block_location": DocumentIndex, StartBlockIndex, EndBlockIndex
+//   - "web_search_result_location": URL, Title
+//
+// End indices are exclusive.
+type Citation struct {
+	Type          string `json:"type"`
+	CitedText     string `json:"cited_text"`
+	DocumentIndex int    `json:"document_index,omitempty"`
+	DocumentTitle string `json:"document_title,omitempty"`
+
+	StartCharIndex  int `json:"start_char_index,omitempty"`
+	EndCharIndex    int `json:"end_char_index,omitempty"`
+	StartPageNumber int `json:"start_page_number,omitempty"`
+	EndPageNumber   int `json:"end_page_number,omitempty"`
+	StartBlockIndex int `json:"start_block_index,omitempty"`
+	EndBlockIndex   int `json:"end_block_index,omitempty"`
+
+	URL   string `json:"url,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+// WebSearchResult is one page returned by the server-side web search tool.
+type WebSearchResult struct {
+	Type    string `json:"type"`
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+	PageAge string `json:"page_age,omitempty"`
+}
+
+// WebSearchQuery returns the query of a server_tool_use block that invokes
+// web_search, or "" for any other block.
+func (b ContentBlock) WebSearchQuery() string {
+	if b.Type != "server_tool_use" || b.Name != "web_search" {
+		return ""
+	}
+	var in struct {
+		Query string `json:"query"`
+	}
+	_ = json.Unmarshal(b.Input, &in)
+	return in.Query
+}
+
+// WebSearchResults returns the pages of a web_search_tool_result block. It
+// returns nil for other blocks and when the search failed, in which case
+// Content holds the error object.
+func (b ContentBlock) WebSearchResults() []WebSearchResult {
+	if b.Type != "web_search_tool_result" {
+		return nil
+	}
+	var results []WebSearchResult
+	if err := json.Unmarshal(b.Content, &results); err != nil {
+		return nil
+	}
+	return results
 }
 
 // ─── Assistant message ─────────────────────────────────────────────────────────
 
 // MessagePayload is the inner `message` object inside AssistantMessage.
 type MessagePayload struct {
+	// ID is the API message ID of an assistant message. The CLI may emit one
+	// response as several assistant events sharing it.
+	ID      string         `json:"id,omitempty"`
 	Role    string         `json:"role"`
 	Content []ContentBlock `json:"content"`
+	// Usage is the token usage of the API call that produced an assistant
+	// message; nil for user messages.
+	Usage *Usage `json:"usage,omitempty"`
 }
 
 // AssistantMessage is emitted when Claude produces a complete response turn.
@@ -77,8 +259,11 @@ type AssistantMessage struct {
 	Type            MessageType    `json:"type"`
 	Message         MessagePayload `json:"message"`
 	ParentToolUseID *string        `json:"parent_tool_use_id"`
-	SessionID       string         `json:"session_id"`
-	UUID            string         `json:"uuid"`
+	// AgentID identifies the subagent that produced the message, when the CLI
+	// reports it; "" for the main agent and older CLIs.
+	AgentID   string `json:"agent_id,omitempty"`
+	SessionID string `json:"session_id"`
+	UUID      string `json:"uuid"`
 }
 
 // Text returns the concatenated text from all text content blocks.
@@ -92,24 +277,66 @@ func (m *AssistantMessage) Text() string {
 	return out
 }
 
-// Thinking returns the concatenated thinking text from all thinking content blocks.
+// Thinking returns the concatenated thinking text from all thinking content
+// blocks. Redacted thinking is skipped; see ThinkingWithRedacted.
 func (m *AssistantMessage) Thinking() string {
+	return m.ThinkingWithRedacted("")
+}
+
+// ThinkingWithRedacted is like Thinking but writes placeholder in place of
+// each redacted_thinking block, so readers can tell that some reasoning was
+// withheld.
+func (m *AssistantMessage) ThinkingWithRedacted(placeholder string) string {
 	var out string
 	for _, b := range m.Message.Content {
-		if b.Type == "thinking" {
+		switch b.Type {
+		case "thinking":
 			out += b.Thinking
+		case "redacted_thinking":
+			out += placeholder
 		}
 	}
 	return out
 }
 
+// RedactedThinking returns the encrypted Data of every redacted_thinking block,
+// in order, for passing back to the model on a later turn.
+func (m *AssistantMessage) RedactedThinking() []string {
+	var out []string
+	for _, b := range m.Message.Content {
+		if b.Type == "redacted_thinking" {
+			out = append(out, b.Data)
+		}
+	}
+	return out
+}
+
+// ─── User message ──────────────────────────────────────────────────────────────
+
+// UserMessage is a user turn echoed by the CLI. Tool results fed back to the
+// model arrive this way as tool_result content blocks.
+// Mirrors SDKUserMessage in the TypeScript SDK.
+type UserMessage struct {
+	Type            MessageType    `json:"type"`
+	Message         MessagePayload `json:"message"`
+	ParentToolUseID *string        `json:"parent_tool_use_id"`
+	// AgentID identifies the subagent the message was fed to; see
+	// AssistantMessage.AgentID.
+	AgentID   string `json:"agent_id,omitempty"`
+	SessionID string `json:"session_id"`
+	UUID      string `json:"uuid"`
+}
+
 // ─── Stream event message ──────────────────────────────────────────────────────
 
 // StreamEventDelta is the incremental content of a stream_event delta.
 type StreamEventDelta struct {
-	Type     string `json:"type"`
-	Text     string `json:"text,omitempty"`
-	Thinking string `json:"thinking,omitempty"`
+	Type      string `json:"type"`
+	Text      string `json:"text,omitempty"`
+	Thinking  string `json:"thinking,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	// PartialJSON is a fragment of a tool_use block's input (input_json_delta).
+	PartialJSON string `json:"partial_json,omitempty"`
 }
 
 // StreamEvent is the inner `event` object of a StreamEventMessage.
@@ -117,6 +344,10 @@ type StreamEvent struct {
 	Type  string            `json:"type"`
 	Delta *StreamEventDelta `json:"delta,omitempty"`
 	Index int               `json:"index,omitempty"`
+
+	// ContentBlock is the block being opened by a content_block_start event.
+	// Redacted thinking is never streamed as deltas; it arrives here whole.
+	ContentBlock *ContentBlock `json:"content_block,omitempty"`
 }
 
 // StreamEventMessage carries incremental deltas during a streaming response.
@@ -125,8 +356,11 @@ type StreamEventMessage struct {
 	Type            MessageType `json:"type"`
 	Event           StreamEvent `json:"event"`
 	ParentToolUseID *string     `json:"parent_tool_use_id"`
-	SessionID       string      `json:"session_id"`
-	UUID            string      `json:"uuid"`
+	// AgentID identifies the subagent streaming the message; see
+	// AssistantMessage.AgentID.
+	AgentID   string `json:"agent_id,omitempty"`
+	SessionID string `json:"session_id"`
+	UUID      string `json:"uuid"`
 }
 
 // ─── Usage ────────────────────────────────────────────────────────────────────
@@ -167,13 +401,24 @@ type Result struct {
 	Result        string      `json:"result"`
 	StopReason    *string     `json:"stop_reason"`
 	TotalCostUSD  float64     `json:"total_cost_usd"`
-	Usage         Usage       `json:"usage"`
-	SessionID     string      `json:"session_id"`
-	UUID          string      `json:"uuid"`
+	// EstimatedCostUSD is the cost recomputed by the SDK at the rates given to
+	// WithPricing; zero when WithPricing is not used. TotalCostUSD is the
+	// CLI's own figure at list price.
+	EstimatedCostUSD float64 `json:"-"`
+	Usage            Usage   `json:"usage"`
+	SessionID        string  `json:"session_id"`
+	UUID             string  `json:"uuid"`
+	// AgentID identifies the agent whose run this result ends, when the CLI
+	// reports it; "" for the main agent.
+	AgentID string `json:"agent_id,omitempty"`
+	// Model is the model the run was started on, as reported by the CLI's init
+	// message; set by the SDK. ModelUsages shows whether the CLI switched to
+	// WithFallbackModel during the run.
+	Model string `json:"model,omitempty"`
 	// ModelUsages holds per-model token and cost breakdowns keyed by model ID.
 	ModelUsages map[string]ModelUsage `json:"model_usages,omitempty"`
 	// Populated when IsError is true.
-	Errors []string `json:"errors,omitempty"`
+	Errors []ResultError `json:"errors,omitempty"`
 	// StructuredOutput holds parsed structured output when an OutputFormat
 	// with type "json" or "json_schema" was requested.
 	StructuredOutput any `json:"structured_output,omitempty"`
@@ -181,6 +426,79 @@ type Result struct {
 	PermissionDenials []string `json:"permission_denials,omitempty"`
 }
 
+// ResultError is one entry of Result.Errors. Older CLIs report plain strings,
+// which decode into Message alone; newer ones report objects that also carry
+// a machine-readable Type (e.g. "overloaded_error", "invalid_request_error")
+// and Code.
+type ResultError struct {
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+	Type    string `json:"type,omitempty"`
+}
+
+// UnmarshalJSON accepts either a string or an error object, including the
+// API's {"type":"error","error":{...}} envelope.
+func (e *ResultError) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*e = ResultError{Message: s}
+		return nil
+	}
+	type plain ResultError
+	var obj struct {
+		plain
+		Error *plain `json:"error"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	if obj.Error != nil {
+		*e = ResultError(*obj.Error)
+		return nil
+	}
+	*e = ResultError(obj.plain)
+	return nil
+}
+
+// String returns the message, prefixed with the type when there is one.
+func (e ResultError) String() string {
+	if e.Type == "" {
+		return e.Message
+	}
+	return e.Type + ": " + e.Message
+}
+
+// Duration returns the wall-clock duration of the run.
+func (r *Result) Duration() time.Duration {
+	return time.Duration(r.DurationMS) * time.Millisecond
+}
+
+// APIDuration returns the time spent waiting on the Anthropic API.
+func (r *Result) APIDuration() time.Duration {
+	return time.Duration(r.DurationAPIMS) * time.Millisecond
+}
+
+// Overhead returns the wall-clock time not spent waiting on the API (tool
+// execution, hooks, process overhead): Duration minus APIDuration, floored at 0.
+func (r *Result) Overhead() time.Duration {
+	if d := r.Duration() - r.APIDuration(); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Summary returns a one-line human-readable summary of the run, e.g.
+//
+//	success: 3 turns, $0.012300, 1200 in / 340 out tokens, 12.3s wall (9.1s API, 3.2s overhead)
+func (r *Result) Summary() string {
+	return fmt.Sprintf("%s: %d turns, $%.6f, %d in / %d out tokens, %s wall (%s API, %s overhead)",
+		r.Subtype, r.NumTurns, r.TotalCostUSD,
+		r.Usage.InputTokens, r.Usage.OutputTokens,
+		r.Duration().Round(100*time.Millisecond),
+		r.APIDuration().Round(100*time.Millisecond),
+		r.Overhead().Round(100*time.Millisecond))
+}
+
 // ─── System message ────────────────────────────────────────────────────────────
 
 // SystemMessage covers all "system" typed messages from the CLI.
@@ -189,7 +507,8 @@ type Result struct {
 // session/model/tools/version fields are populated.
 //
 // When Subtype == SubtypeStatus ("status"), the Status and Message fields are
-// populated with a human-readable status update.
+// populated with a human-readable status update, and StatusDetail and Progress
+// with any structured data the CLI attached to it.
 type SystemMessage struct {
 	Type    MessageType `json:"type"`
 	Subtype string      `json:"subtype"`
@@ -198,6 +517,15 @@ type SystemMessage struct {
 	Status  string `json:"status,omitempty"`
 	Message string `json:"message,omitempty"`
 
+	// StatusDetail holds every field of a status message, decoded generically,
+	// so fields added by newer CLIs are available before they get typed
+	// accessors. Nil for other subtypes.
+	StatusDetail map[string]any `json:"-"`
+
+	// Progress is the structured progress of a status message, or nil when
+	// the CLI did not report any.
+	Progress *StatusProgress `json:"-"`
+
 	// Init subtype fields — populated when Subtype == SubtypeInit.
 	SessionID         string   `json:"session_id,omitempty"`
 	CWD               string   `json:"cwd,omitempty"`
@@ -213,6 +541,58 @@ type SystemMessage struct {
 	Skills        []string `json:"skills,omitempty"`
 	Plugins       []string `json:"plugins,omitempty"`
 	SlashCommands []string `json:"slash_commands,omitempty"`
+
+	// CompactMetadata is populated when Subtype == SubtypeCompactBoundary.
+	CompactMetadata *CompactMetadata `json:"compact_metadata,omitempty"`
+}
+
+// CompactMetadata describes a context compaction that just happened.
+type CompactMetadata struct {
+	// Trigger is PreCompactTriggerManual or PreCompactTriggerAuto.
+	Trigger PreCompactTrigger `json:"trigger"`
+	// PreTokens is the context size in tokens before compaction.
+	PreTokens int `json:"pre_tokens"`
+	// PostTokens is the context size in tokens after compaction; zero when
+	// the CLI does not report it.
+	PostTokens int `json:"post_tokens,omitempty"`
+}
+
+// Compaction is the summary a compacted conversation continues from, with the
+// context sizes of the compaction that produced it. See TypeCompaction.
+type Compaction struct {
+	// Summary is the text that replaced the compacted conversation.
+	Summary string
+	// Trigger, PreTokens and PostTokens come from the compact_boundary system
+	// message before the summary; they are zero when there was none, as in a
+	// transcript read without it.
+	Trigger    PreCompactTrigger
+	PreTokens  int
+	PostTokens int
+	SessionID  string
+	UUID       string
+}
+
+// StatusProgress is the machine-readable progress carried by newer CLIs'
+// status messages.
+type StatusProgress struct {
+	// Percentage is the completion in the range 0–100, or nil when unknown.
+	Percentage *float64 `json:"percentage,omitempty"`
+	// Phase names the current stage of the operation.
+	Phase string `json:"phase,omitempty"`
+	// ToolName is the tool being run, if any.
+	ToolName string `json:"tool_name,omitempty"`
+}
+
+// Capabilities summarises what a session supports, as reported by the CLI's
+// init message. Returned by Stream.Capabilities.
+type Capabilities struct {
+	Model         string
+	Tools         []string
+	Agents        []string
+	Skills        []string
+	Plugins       []string
+	SlashCommands []string
+	Betas         []string
 }
 
 // ─── Tool progress message ────────────────────────────────────────────────────
@@ -235,25 +615,107 @@ type TaskMessage struct {
 	Message string      `json:"message,omitempty"`
 }
 
+// ─── Rate limit message ───────────────────────────────────────────────────────
+
+// RateLimitStatusRejected is the RateLimitInfo.Status of a request that was
+// refused because a limit is exhausted.
+const RateLimitStatusRejected = "rejected"
+
+// RateLimitInfo describes the state of the account's rate or usage limit.
+type RateLimitInfo struct {
+	// Status is "allowed", "allowed_warning", or RateLimitStatusRejected.
+	Status string `json:"status"`
+	// ResetsAt is when the limit resets, in Unix seconds; zero when unknown.
+	ResetsAt int64 `json:"resetsAt,omitempty"`
+	// RateLimitType names the limit, e.g. "five_hour".
+	RateLimitType string `json:"rateLimitType,omitempty"`
+	// Utilization is the fraction of the limit used, when reported.
+	Utilization float64 `json:"utilization,omitempty"`
+}
+
+// ResetTime returns ResetsAt as a time.Time, or the zero time when unknown.
+func (i RateLimitInfo) ResetTime() time.Time {
+	if i.ResetsAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(i.ResetsAt, 0)
+}
+
+// RateLimitMessage is emitted when the CLI learns about the account's rate
+// limit state. Mirrors SDKRateLimitEvent in the TypeScript SDK.
+type RateLimitMessage struct {
+	Type          MessageType   `json:"type"`
+	RateLimitInfo RateLimitInfo `json:"rate_limit_info"`
+	SessionID     string        `json:"session_id,omitempty"`
+	UUID          string        `json:"uuid,omitempty"`
+}
+
 // ─── Top-level Event ──────────────────────────────────────────────────────────
 
 // Event is the top-level value yielded from Query().
 //
 // Type is always set. The corresponding typed field is non-nil for known types:
-//   - TypeAssistant     → Assistant
-//   - TypeStreamEvent   → StreamEvent
-//   - TypeResult        → Result
-//   - TypeSystem        → System
+//   - TypeAssistant      → Assistant
+//   - TypeUser           → User (when content is an array of blocks)
+//   - TypeStreamEvent    → StreamEvent
+//   - TypeResult         → Result
+//   - TypeSystem         → System
+//   - TypeRateLimitEvent → RateLimit
+//   - TypeTurnStart      → Turn
+//   - TypeTurnEnd        → Turn
 //
-// For unknown types (e.g. TypeRateLimitEvent), only Raw is set so callers can
-// handle forward-compatibility themselves.
+// For unknown types, only Raw is set so callers can handle
+// forward-compatibility themselves.
 type Event struct {
 	Type         MessageType
 	Assistant    *AssistantMessage
+	User         *UserMessage
 	StreamEvent  *StreamEventMessage
 	Result       *Result
 	System       *SystemMessage
 	ToolProgress *ToolProgressMessage
 	Task         *TaskMessage
+	Turn         *TurnMarker
+	RateLimit    *RateLimitMessage
+	Compaction   *Compaction
 	Raw          json.RawMessage
+
+	// CorrelationID is the ID passed to Session.SendWithID for the turn that
+	// produced this event, or "" for turns started otherwise.
+	CorrelationID string
+}
+
+// AgentID returns the agent_id the CLI attached to e, or "" when it reported
+// none. Not every CLI version sets it; ParentToolUseID attributes subagent
+// messages reliably.
+func (e Event) AgentID() string {
+	switch {
+	case e.Assistant != nil:
+		return e.Assistant.AgentID
+	case e.User != nil:
+		return e.User.AgentID
+	case e.StreamEvent != nil:
+		return e.StreamEvent.AgentID
+	case e.Result != nil:
+		return e.Result.AgentID
+	}
+	return ""
+}
+
+// ParentToolUseID returns the ID of the Task tool call whose subagent produced
+// e, or "" for the main agent's events and for types that carry no parent.
+func (e Event) ParentToolUseID() string {
+	var parent *string
+	switch {
+	case e.Assistant != nil:
+		parent = e.Assistant.ParentToolUseID
+	case e.User != nil:
+		parent = e.User.ParentToolUseID
+	case e.StreamEvent != nil:
+		parent = e.StreamEvent.ParentToolUseID
+	}
+	if parent == nil {
+		return ""
+	}
+	return *parent
 }
@@ -1,8 +1,12 @@
 package claude
 
 import (
+	"context"
 	"encoding/json"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestParseLine_Assistant(t *testing.T) {
@@ -25,6 +29,28 @@ func TestParseLine_Assistant(t *testing.T) {
 	}
 }
 
+func TestParseLine_AgentID(t *testing.T) {
+	for _, line := range []string{
+		`{"type":"assistant","message":{"role":"assistant","content":[]},"parent_tool_use_id":"t1","agent_id":"a1"}`,
+		`{"type":"user","message":{"role":"user","content":[]},"parent_tool_use_id":"t1","agent_id":"a1"}`,
+		`{"type":"stream_event","event":{"type":"message_start"},"parent_tool_use_id":"t1","agent_id":"a1"}`,
+		`{"type":"result","subtype":"success","agent_id":"a1"}`,
+	} {
+		event, err := parseLine([]byte(line))
+		if err != nil {
+			t.Fatalf("parseLine: %v", err)
+		}
+		if got := event.AgentID(); got != "a1" {
+			t.Errorf("%s: expected agent ID a1, got %q", event.Type, got)
+		}
+	}
+
+	event, _ := parseLine([]byte(`{"type":"assistant","message":{"role":"assistant","content":[]},"parent_tool_use_id":null}`))
+	if event.AgentID() != "" || event.ParentToolUseID() != "" {
+		t.Fatalf("expected no attribution for a main-agent message, got %q/%q", event.AgentID(), event.ParentToolUseID())
+	}
+}
+
 func TestParseLine_Result(t *testing.T) {
 	line := `{"type":"result","subtype":"success","duration_ms":100,"is_error":false,"num_turns":1,"result":"done","total_cost_usd":0.01,"usage":{"input_tokens":10,"output_tokens":20,"cache_read_input_tokens":0,"cache_creation_input_tokens":0,"web_search_requests":3},"session_id":"s1","uuid":"u1"}`
 	event, err := parseLine([]byte(line))
@@ -42,6 +68,28 @@ func TestParseLine_Result(t *testing.T) {
 	}
 }
 
+func TestParseLine_ResultErrors(t *testing.T) {
+	line := `{"type":"result","subtype":"error_during_execution","is_error":true,"errors":[` +
+		`"plain failure",` +
+		`{"type":"overloaded_error","message":"Overloaded"},` +
+		`{"type":"error","error":{"type":"invalid_request_error","code":"bad_param","message":"bad"}}]}`
+	event, err := parseLine([]byte(line))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []ResultError{
+		{Message: "plain failure"},
+		{Type: "overloaded_error", Message: "Overloaded"},
+		{Type: "invalid_request_error", Code: "bad_param", Message: "bad"},
+	}
+	if !slices.Equal(event.Result.Errors, want) {
+		t.Fatalf("expected errors %+v, got %+v", want, event.Result.Errors)
+	}
+	if got := resultError(event.Result).Error(); !strings.Contains(got, "plain failure; overloaded_error: Overloaded") {
+		t.Fatalf("unexpected result error %q", got)
+	}
+}
+
 func TestParseLine_ResultWithModelUsages(t *testing.T) {
 	line := `{"type":"result","subtype":"success","duration_ms":100,"is_error":false,"num_turns":1,"result":"done","total_cost_usd":0.05,"usage":{"input_tokens":10,"output_tokens":20,"cache_read_input_tokens":0,"cache_creation_input_tokens":0},"model_usages":{"claude-sonnet-4-6":{"input_tokens":10,"output_tokens":20,"cache_read_input_tokens":0,"cache_creation_input_tokens":0,"cost_usd":0.05,"context_window":200000,"max_output_tokens":8192}},"session_id":"s1","uuid":"u1"}`
 	event, err := parseLine([]byte(line))
@@ -169,6 +217,30 @@ func TestParseLine_System(t *testing.T) {
 	}
 }
 
+func TestParseLine_StatusProgress(t *testing.T) {
+	line := `{"type":"system","subtype":"status","status":"running","message":"Running tests","percentage":42.5,"phase":"verify","tool_name":"Bash","eta_seconds":30}`
+	event, err := parseLine([]byte(line))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := event.System
+	if m == nil || m.Status != "running" || m.Message != "Running tests" {
+		t.Fatalf("unexpected status message: %+v", m)
+	}
+	p := m.Progress
+	if p == nil || p.Percentage == nil || *p.Percentage != 42.5 || p.Phase != "verify" || p.ToolName != "Bash" {
+		t.Fatalf("unexpected progress: %+v", p)
+	}
+	if m.StatusDetail["eta_seconds"] != float64(30) {
+		t.Fatalf("expected eta_seconds in StatusDetail, got %v", m.StatusDetail)
+	}
+
+	event, _ = parseLine([]byte(`{"type":"system","subtype":"status","status":"compacting"}`))
+	if event.System.Progress != nil {
+		t.Fatalf("expected no progress, got %+v", event.System.Progress)
+	}
+}
+
 func TestParseLine_StreamEvent(t *testing.T) {
 	line := `{"type":"stream_event","event":{"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}},"session_id":"s1","uuid":"u1"}`
 	event, err := parseLine([]byte(line))
@@ -189,6 +261,36 @@ func TestParseLine_StreamEvent(t *testing.T) {
 	}
 }
 
+func TestParseLine_RedactedThinking(t *testing.T) {
+	line := `{"type":"assistant","message":{"role":"assistant","content":[` +
+		`{"type":"thinking","thinking":"first ","signature":"sig1"},` +
+		`{"type":"redacted_thinking","data":"EmwKAhgB"},` +
+		`{"type":"thinking","thinking":"last","signature":"sig2"},` +
+		`{"type":"text","text":"done"}]}}`
+	event, err := parseLine([]byte(line))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	m := event.Assistant
+	if got := m.Thinking(); got != "first last" {
+		t.Fatalf("unexpected Thinking %q", got)
+	}
+	if got := m.ThinkingWithRedacted("[redacted]"); got != "first [redacted]last" {
+		t.Fatalf("unexpected ThinkingWithRedacted %q", got)
+	}
+	if got := m.RedactedThinking(); len(got) != 1 || got[0] != "EmwKAhgB" {
+		t.Fatalf("unexpected RedactedThinking %v", got)
+	}
+	if m.Message.Content[0].Signature != "sig1" {
+		t.Fatalf("expected signature to be decoded, got %+v", m.Message.Content[0])
+	}
+
+	event, _ = parseLine([]byte(`{"type":"stream_event","event":{"type":"content_block_start","index":1,"content_block":{"type":"redacted_thinking","data":"EmwKAhgB"}}}`))
+	if cb := event.StreamEvent.Event.ContentBlock; cb == nil || cb.Type != "redacted_thinking" || cb.Data != "EmwKAhgB" {
+		t.Fatalf("unexpected content_block_start block: %+v", cb)
+	}
+}
+
 func TestParseLine_InvalidJSON(t *testing.T) {
 	_, err := parseLine([]byte("not json"))
 	if err == nil {
@@ -218,3 +320,175 @@ func TestParseLine_NewTypesRawOnly(t *testing.T) {
 		}
 	}
 }
+
+func TestResult_SummaryAndOverhead(t *testing.T) {
+	r := &Result{
+		Subtype:       "success",
+		NumTurns:      3,
+		TotalCostUSD:  0.0123,
+		Usage:         Usage{InputTokens: 1200, OutputTokens: 340},
+		DurationMS:    12345,
+		DurationAPIMS: 9100,
+	}
+	if got := r.Overhead(); got != 3245*time.Millisecond {
+		t.Fatalf("expected overhead 3.245s, got %s", got)
+	}
+	want := "success: 3 turns, $0.012300, 1200 in / 340 out tokens, 12.3s wall (9.1s API, 3.2s overhead)"
+	if got := r.Summary(); got != want {
+		t.Fatalf("unexpected summary:\n got %q\nwant %q", got, want)
+	}
+
+	r.DurationAPIMS = 20000
+	if got := r.Overhead(); got != 0 {
+		t.Fatalf("expected overhead floored at 0, got %s", got)
+	}
+}
+
+func TestParseLine_UserToolResult(t *testing.T) {
+	line := `{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu1","content":[{"type":"text","text":"file1\nfile2"}],"is_error":false}]},"session_id":"s1"}`
+	event, err := parseLine([]byte(line))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.User == nil {
+		t.Fatal("expected User to be non-nil")
+	}
+	b := event.User.Message.Content[0]
+	if b.ToolUseID != "tu1" || b.ResultText() != "file1\nfile2" {
+		t.Fatalf("unexpected tool_result block: %+v", b)
+	}
+
+	str := ContentBlock{Type: "tool_result", Content: json.RawMessage(`"plain"`)}
+	if got := str.ResultText(); got != "plain" {
+		t.Fatalf("expected string content 'plain', got %q", got)
+	}
+}
+
+func TestParseLine_AssistantToolUse(t *testing.T) {
+	line := `{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"tu1","name":"Bash","input":{"command":"ls"}}]}}`
+	event, err := parseLine([]byte(line))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := event.Assistant.Message.Content[0]
+	if b.ID != "tu1" || b.Name != "Bash" || string(b.Input) != `{"command":"ls"}` {
+		t.Fatalf("unexpected tool_use block: %+v", b)
+	}
+}
+
+func TestParseLine_WebSearchBlocks(t *testing.T) {
+	line := `{"type":"assistant","message":{"role":"assistant","content":[` +
+		`{"type":"server_tool_use","id":"srv1","name":"web_search","input":{"query":"go generics"}},` +
+		`{"type":"web_search_tool_result","tool_use_id":"srv1","content":[{"type":"web_search_result","url":"https://go.dev/doc","title":"Go docs","encrypted_content":"x","page_age":"2 days"}]},` +
+		`{"type":"text","text":"See the docs."}]}}`
+	event, err := parseLine([]byte(line))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocks := event.Assistant.Message.Content
+	if q := blocks[0].WebSearchQuery(); q != "go generics" {
+		t.Fatalf("expected query %q, got %q", "go generics", q)
+	}
+	results := blocks[1].WebSearchResults()
+	if len(results) != 1 || results[0].URL != "https://go.dev/doc" || results[0].Title != "Go docs" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if blocks[1].ToolUseID != "srv1" {
+		t.Fatalf("expected tool_use_id srv1, got %q", blocks[1].ToolUseID)
+	}
+	if got := event.Assistant.Text(); got != "See the docs." {
+		t.Fatalf("expected Text to skip search blocks, got %q", got)
+	}
+
+	failed := ContentBlock{Type: "web_search_tool_result", Content: json.RawMessage(`{"type":"web_search_tool_result_error","error_code":"max_uses_exceeded"}`)}
+	if failed.WebSearchResults() != nil {
+		t.Fatal("expected nil results for a failed search")
+	}
+}
+
+func TestParseLine_Citations(t *testing.T) {
+	line := `{"type":"assistant","message":{"role":"assistant","content":[` +
+		`{"type":"text","text":"The sky is blue.","citations":[{"type":"char_location","cited_text":"The sky is blue.","document_index":1,"document_title":"facts","start_char_index":10,"end_char_index":26}]},` +
+		`{"type":"text","text":" Plain."}]}}`
+	event, err := parseLine([]byte(line))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blocks := event.Assistant.Message.Content
+	if len(blocks[0].Citations) != 1 {
+		t.Fatalf("expected 1 citation, got %d", len(blocks[0].Citations))
+	}
+	c := blocks[0].Citations[0]
+	if c.Type != "char_location" || c.DocumentIndex != 1 || c.StartCharIndex != 10 || c.EndCharIndex != 26 {
+		t.Fatalf("unexpected citation: %+v", c)
+	}
+	if blocks[1].Citations != nil {
+		t.Fatalf("expected no citations, got %+v", blocks[1].Citations)
+	}
+}
+
+func TestParseLine_CompactBoundary(t *testing.T) {
+	line := `{"type":"system","subtype":"compact_boundary","session_id":"s1","compact_metadata":{"trigger":"auto","pre_tokens":180000}}`
+	event, err := parseLine([]byte(line))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.System == nil || event.System.Subtype != SubtypeCompactBoundary {
+		t.Fatalf("expected compact_boundary system event, got %+v", event)
+	}
+	md := event.System.CompactMetadata
+	if md == nil || md.Trigger != PreCompactTriggerAuto || md.PreTokens != 180000 {
+		t.Fatalf("unexpected compact metadata: %+v", md)
+	}
+}
+
+func TestParseLine_CompactSummary(t *testing.T) {
+	for _, content := range []string{`"Earlier we fixed the parser."`, `[{"type":"text","text":"Earlier we fixed the parser."}]`} {
+		line := `{"type":"user","isCompactSummary":true,"message":{"role":"user","content":` + content + `},"session_id":"s1","uuid":"u1"}`
+		event, err := parseLine([]byte(line))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if event.Type != TypeCompaction || event.Compaction == nil || event.User != nil {
+			t.Fatalf("expected a compaction event, got %+v", event)
+		}
+		if c := event.Compaction; c.Summary != "Earlier we fixed the parser." || c.SessionID != "s1" || c.UUID != "u1" {
+			t.Fatalf("unexpected compaction: %+v", c)
+		}
+	}
+
+	event, _ := parseLine([]byte(`{"type":"user","message":{"role":"user","content":[{"type":"text","text":"hi"}]},"session_id":"s1"}`))
+	if event.Type != TypeUser || event.Compaction != nil {
+		t.Fatalf("ordinary user message parsed as %+v", event)
+	}
+}
+
+func TestQuery_CompactionEvent(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"system","subtype":"compact_boundary","session_id":"s1","compact_metadata":{"trigger":"auto","pre_tokens":180000,"post_tokens":12000}}'
+      echo '{"type":"user","isCompactSummary":true,"message":{"role":"user","content":"summary"},"session_id":"s1"}'
+      echo '{"type":"result","subtype":"success","result":"ok","session_id":"s1","is_error":false}'
+      exit 0 ;;
+  esac
+done
+`)
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got *Compaction
+	for e := range stream.Events() {
+		if e.Type == TypeCompaction {
+			got = e.Compaction
+		}
+	}
+	if got == nil {
+		t.Fatal("no compaction event")
+	}
+	want := Compaction{Summary: "summary", Trigger: PreCompactTriggerAuto, PreTokens: 180000, PostTokens: 12000, SessionID: "s1"}
+	if *got != want {
+		t.Fatalf("compaction = %+v, want %+v", *got, want)
+	}
+}
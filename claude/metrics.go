@@ -0,0 +1,96 @@
+package claude
+
+import (
+	"sync"
+	"time"
+)
+
+// MetricsRecorder receives measurements from agent runs. Implement it to feed a
+// metrics backend; the claude package itself has no metrics dependency. The
+// metrics/prometheus package, a separate module, implements it for
+// Prometheus:
+//
+//	claude.Run(ctx, prompt, prometheus.WithMetrics(reg))
+//
+// Methods are called from the stream's reader goroutine and must not block.
+type MetricsRecorder interface {
+	// ObserveSpawn is called once per subprocess with the time from starting
+	// the process to receiving the CLI's init message.
+	ObserveSpawn(d time.Duration)
+	// ObserveTurn is called for every result message, i.e. once per turn.
+	ObserveTurn(r *Result)
+	// ObserveToolCall is called when a tool result arrives, with the time since
+	// the matching tool_use block.
+	ObserveToolCall(name string, d time.Duration, isError bool)
+	// ObserveRun is called once when the subprocess exits, with its lifetime
+	// and a non-nil err when it failed unexpectedly.
+	ObserveRun(d time.Duration, err error)
+}
+
+// runMetrics feeds a MetricsRecorder from one Stream's events. A nil
+// *runMetrics is valid and records nothing.
+type runMetrics struct {
+	rec     MetricsRecorder
+	started time.Time
+
+	mu      sync.Mutex
+	spawned bool
+	tools   map[string]toolStart
+}
+
+type toolStart struct {
+	name string
+	at   time.Time
+}
+
+// newRunMetrics returns nil when rec is nil.
+func newRunMetrics(rec MetricsRecorder, started time.Time) *runMetrics {
+	if rec == nil {
+		return nil
+	}
+	return &runMetrics{rec: rec, started: started, tools: make(map[string]toolStart)}
+}
+
+// observe records the measurements carried by an event.
+func (m *runMetrics) observe(e Event) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	switch {
+	case e.System != nil && e.System.Subtype == SubtypeInit:
+		if !m.spawned {
+			m.spawned = true
+			m.rec.ObserveSpawn(now.Sub(m.started))
+		}
+	case e.Assistant != nil:
+		for _, b := range e.Assistant.Message.Content {
+			if b.Type == "tool_use" {
+				m.tools[b.ID] = toolStart{name: b.Name, at: now}
+			}
+		}
+	case e.User != nil:
+		for _, b := range e.User.Message.Content {
+			if b.Type != "tool_result" {
+				continue
+			}
+			if start, ok := m.tools[b.ToolUseID]; ok {
+				m.rec.ObserveToolCall(start.name, now.Sub(start.at), b.IsError)
+				delete(m.tools, b.ToolUseID)
+			}
+		}
+	case e.Result != nil:
+		m.rec.ObserveTurn(e.Result)
+	}
+}
+
+// end records the run itself.
+func (m *runMetrics) end(err error) {
+	if m == nil {
+		return
+	}
+	m.rec.ObserveRun(time.Since(m.started), err)
+}
@@ -0,0 +1,149 @@
+// Package prometheus records the claude package's run metrics with the
+// Prometheus client library, for dashboards over runs, turns, tool calls,
+// tokens, cost and subprocess spawn latency.
+//
+//	result, err := claude.Run(ctx, prompt, prometheus.WithMetrics(prom.DefaultRegisterer))
+//
+// All metrics are prefixed with claude_. The package is its own module, so
+// only programs that import it depend on the Prometheus client library:
+//
+//	go get github.com/shaharia-lab/claude-agent-sdk-go/claude/metrics/prometheus
+package prometheus
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/shaharia-lab/claude-agent-sdk-go/claude"
+)
+
+// Recorder is a claude.MetricsRecorder backed by Prometheus collectors.
+type Recorder struct {
+	spawn    prometheus.Histogram
+	turns    *prometheus.CounterVec // label: status
+	tokens   *prometheus.CounterVec // label: type
+	cost     prometheus.Counter
+	tools    *prometheus.HistogramVec // labels: tool, error
+	runs     *prometheus.CounterVec   // label: status
+	duration prometheus.Histogram
+}
+
+// WithMetrics records every run's measurements in reg. Passing the same
+// registerer to several runs shares one set of collectors. Like
+// prometheus.MustRegister, it panics if reg rejects a collector for any other
+// reason; use NewRecorder and claude.WithMetrics to handle the error instead.
+func WithMetrics(reg prometheus.Registerer) claude.Option {
+	rec, err := NewRecorder(reg)
+	if err != nil {
+		panic(err)
+	}
+	return claude.WithMetrics(rec)
+}
+
+// NewRecorder registers the collectors with reg and returns a Recorder
+// feeding them. Collectors already registered in reg by an earlier
+// NewRecorder call are reused.
+func NewRecorder(reg prometheus.Registerer) (*Recorder, error) {
+	r := &Recorder{
+		spawn: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "claude_spawn_duration_seconds",
+			Help:    "Time from starting the CLI subprocess to its init message.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+		}),
+		turns: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "claude_turns_total",
+			Help: "Result messages received, by status.",
+		}, []string{"status"}),
+		tokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "claude_tokens_total",
+			Help: "Tokens reported by result messages, by type.",
+		}, []string{"type"}),
+		cost: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "claude_cost_usd_total",
+			Help: "Cost in USD reported by result messages.",
+		}),
+		tools: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "claude_tool_call_duration_seconds",
+			Help:    "Time from a tool_use block to its tool result, by tool and whether it failed.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"tool", "error"}),
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "claude_runs_total",
+			Help: "CLI subprocesses that exited, by status.",
+		}, []string{"status"}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "claude_run_duration_seconds",
+			Help:    "Lifetime of the CLI subprocess.",
+			Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+		}),
+	}
+	var err error
+	if r.spawn, err = register(reg, r.spawn); err != nil {
+		return nil, err
+	}
+	if r.turns, err = register(reg, r.turns); err != nil {
+		return nil, err
+	}
+	if r.tokens, err = register(reg, r.tokens); err != nil {
+		return nil, err
+	}
+	if r.cost, err = register(reg, r.cost); err != nil {
+		return nil, err
+	}
+	if r.tools, err = register(reg, r.tools); err != nil {
+		return nil, err
+	}
+	if r.runs, err = register(reg, r.runs); err != nil {
+		return nil, err
+	}
+	if r.duration, err = register(reg, r.duration); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// register registers c with reg, or returns the equivalent collector reg
+// already holds.
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) (C, error) {
+	err := reg.Register(c)
+	var are prometheus.AlreadyRegisteredError
+	if errors.As(err, &are) {
+		if existing, ok := are.ExistingCollector.(C); ok {
+			return existing, nil
+		}
+	}
+	return c, err
+}
+
+// ObserveSpawn implements claude.MetricsRecorder.
+func (r *Recorder) ObserveSpawn(d time.Duration) { r.spawn.Observe(d.Seconds()) }
+
+// ObserveTurn implements claude.MetricsRecorder.
+func (r *Recorder) ObserveTurn(res *claude.Result) {
+	r.turns.WithLabelValues(status(res.IsError)).Inc()
+	r.tokens.WithLabelValues("input").Add(float64(res.Usage.InputTokens))
+	r.tokens.WithLabelValues("output").Add(float64(res.Usage.OutputTokens))
+	r.tokens.WithLabelValues("cache_read").Add(float64(res.Usage.CacheReadInputTokens))
+	r.tokens.WithLabelValues("cache_creation").Add(float64(res.Usage.CacheCreationInputTokens))
+	r.cost.Add(res.TotalCostUSD)
+}
+
+// ObserveToolCall implements claude.MetricsRecorder.
+func (r *Recorder) ObserveToolCall(name string, d time.Duration, isError bool) {
+	r.tools.WithLabelValues(name, strconv.FormatBool(isError)).Observe(d.Seconds())
+}
+
+// ObserveRun implements claude.MetricsRecorder.
+func (r *Recorder) ObserveRun(d time.Duration, err error) {
+	r.runs.WithLabelValues(status(err != nil)).Inc()
+	r.duration.Observe(d.Seconds())
+}
+
+func status(failed bool) string {
+	if failed {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,73 @@
+package prometheus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/shaharia-lab/claude-agent-sdk-go/claude"
+)
+
+func TestRecorder(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	rec, err := NewRecorder(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var _ claude.MetricsRecorder = rec
+
+	rec.ObserveSpawn(300 * time.Millisecond)
+	rec.ObserveTurn(&claude.Result{TotalCostUSD: 0.25, Usage: claude.Usage{InputTokens: 10, OutputTokens: 4}})
+	rec.ObserveTurn(&claude.Result{IsError: true, TotalCostUSD: 0.5, Usage: claude.Usage{InputTokens: 1}})
+	rec.ObserveToolCall("Bash", time.Second, true)
+	rec.ObserveRun(5*time.Second, errors.New("exit 1"))
+
+	want := `
+# HELP claude_cost_usd_total Cost in USD reported by result messages.
+# TYPE claude_cost_usd_total counter
+claude_cost_usd_total 0.75
+# HELP claude_runs_total CLI subprocesses that exited, by status.
+# TYPE claude_runs_total counter
+claude_runs_total{status="error"} 1
+# HELP claude_tokens_total Tokens reported by result messages, by type.
+# TYPE claude_tokens_total counter
+claude_tokens_total{type="cache_creation"} 0
+claude_tokens_total{type="cache_read"} 0
+claude_tokens_total{type="input"} 11
+claude_tokens_total{type="output"} 4
+# HELP claude_turns_total Result messages received, by status.
+# TYPE claude_turns_total counter
+claude_turns_total{status="error"} 1
+claude_turns_total{status="ok"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want),
+		"claude_cost_usd_total", "claude_runs_total", "claude_tokens_total", "claude_turns_total"); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(rec.tools); n != 1 {
+		t.Fatalf("tool call series = %d, want 1", n)
+	}
+}
+
+func TestNewRecorder_ReusesRegisteredCollectors(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	a, err := NewRecorder(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewRecorder(reg)
+	if err != nil {
+		t.Fatalf("second NewRecorder: %v", err)
+	}
+	a.ObserveSpawn(time.Second)
+	b.ObserveSpawn(time.Second)
+	if n := testutil.CollectAndCount(reg, "claude_spawn_duration_seconds"); n != 1 {
+		t.Fatalf("spawn series = %d, want 1", n)
+	}
+	if a.spawn != b.spawn {
+		t.Fatal("second recorder did not reuse the registered histogram")
+	}
+}
@@ -0,0 +1,55 @@
+package claude
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type fakeRecorder struct {
+	spawns []time.Duration
+	turns  []*Result
+	tools  []string
+	runs   []error
+}
+
+func (f *fakeRecorder) ObserveSpawn(d time.Duration) { f.spawns = append(f.spawns, d) }
+func (f *fakeRecorder) ObserveTurn(r *Result)        { f.turns = append(f.turns, r) }
+func (f *fakeRecorder) ObserveToolCall(name string, d time.Duration, isError bool) {
+	f.tools = append(f.tools, name)
+}
+func (f *fakeRecorder) ObserveRun(d time.Duration, err error) { f.runs = append(f.runs, err) }
+
+func TestRunMetrics(t *testing.T) {
+	rec := &fakeRecorder{}
+	m := newRunMetrics(rec, time.Now())
+
+	for _, line := range []string{
+		`{"type":"system","subtype":"init","session_id":"s1"}`,
+		`{"type":"system","subtype":"init","session_id":"s1"}`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"tu1","name":"Read","input":{}}]}}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu1","content":"ok"}]}}`,
+		`{"type":"result","subtype":"success","total_cost_usd":0.01,"session_id":"s1"}`,
+	} {
+		e, err := parseLine([]byte(line))
+		if err != nil {
+			t.Fatalf("parseLine: %v", err)
+		}
+		m.observe(e)
+	}
+	runErr := errors.New("boom")
+	m.end(runErr)
+
+	if len(rec.spawns) != 1 {
+		t.Fatalf("expected 1 spawn observation, got %d", len(rec.spawns))
+	}
+	if len(rec.turns) != 1 || rec.turns[0].TotalCostUSD != 0.01 {
+		t.Fatalf("unexpected turns: %+v", rec.turns)
+	}
+	if len(rec.tools) != 1 || rec.tools[0] != "Read" {
+		t.Fatalf("unexpected tool calls: %v", rec.tools)
+	}
+	if len(rec.runs) != 1 || rec.runs[0] != runErr {
+		t.Fatalf("unexpected runs: %v", rec.runs)
+	}
+}
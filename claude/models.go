@@ -0,0 +1,59 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ModelInfo describes a model the CLI offers, as listed by ListModels.
+type ModelInfo struct {
+	// ID is the value to pass to WithModel, e.g. "claude-sonnet-4-6" or an
+	// alias such as "opus".
+	ID string `json:"value"`
+	// DisplayName is a human-readable name for pickers.
+	DisplayName string `json:"displayName"`
+	// Description is the CLI's one-line summary of the model.
+	Description string `json:"description,omitempty"`
+	// ContextWindow is the context window in tokens when the CLI reports it,
+	// and zero otherwise; Result.ModelUsages carries it after a run.
+	ContextWindow int `json:"contextWindow,omitempty"`
+}
+
+// ListModels returns the models available to the CLI configured by opts and
+// its account, in the CLI's order. Like Ping it spawns the CLI without a
+// prompt and asks it with the supported_models control request, so no tokens
+// are used; it is bounded by DefaultPingTimeout and returns the same errors.
+// CLI versions without the request fail with an error naming it.
+func ListModels(ctx context.Context, opts ...Option) ([]ModelInfo, error) {
+	resp, err := probe(ctx, "list models", "supported_models", opts)
+	if err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("claude: supported_models: %s", resp.Error)
+	}
+	return parseModels(resp.Body)
+}
+
+// parseModels decodes a supported_models control response, whose payload is
+// either the list itself or an object with a models field.
+func parseModels(body json.RawMessage) ([]ModelInfo, error) {
+	var envelope struct {
+		Response json.RawMessage `json:"response"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("claude: supported_models: %w", err)
+	}
+	var models []ModelInfo
+	if err := json.Unmarshal(envelope.Response, &models); err == nil {
+		return models, nil
+	}
+	var wrapped struct {
+		Models []ModelInfo `json:"models"`
+	}
+	if err := json.Unmarshal(envelope.Response, &wrapped); err != nil {
+		return nil, fmt.Errorf("claude: supported_models: %w", err)
+	}
+	return wrapped.Models, nil
+}
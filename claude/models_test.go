@@ -0,0 +1,47 @@
+package claude
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestListModels(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"subtype":"supported_models"'*)
+      id=$(printf '%s' "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+      echo '{"type":"control_response","request_id":"'"$id"'","response":{"subtype":"success","response":{"models":[{"value":"default","displayName":"Default (recommended)","description":"Sonnet 4.6"},{"value":"opus","displayName":"Opus","description":"Opus 4.6","contextWindow":200000}]}}}' ;;
+  esac
+done
+`)
+	models, err := ListModels(context.Background(), WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	if len(models) != 2 || models[0].ID != "default" || models[1].DisplayName != "Opus" || models[1].ContextWindow != 200000 {
+		t.Fatalf("unexpected models: %+v", models)
+	}
+}
+
+func TestListModels_Unsupported(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"subtype":"supported_models"'*)
+      id=$(printf '%s' "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+      echo '{"type":"control_response","request_id":"'"$id"'","response":{"subtype":"error","error":"Unsupported control request subtype: supported_models"}}' ;;
+  esac
+done
+`)
+	_, err := ListModels(context.Background(), WithClaudeExecutable(exe))
+	if err == nil || !strings.Contains(err.Error(), "supported_models") {
+		t.Fatalf("expected an error naming supported_models, got %v", err)
+	}
+}
+
+func TestParseModels_List(t *testing.T) {
+	models, err := parseModels([]byte(`{"subtype":"success","response":[{"value":"haiku","displayName":"Haiku"}]}`))
+	if err != nil || len(models) != 1 || models[0].ID != "haiku" {
+		t.Fatalf("parseModels = %+v, %v", models, err)
+	}
+}
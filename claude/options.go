@@ -1,9 +1,16 @@
 package claude
 
 import (
+	"cmp"
 	"encoding/json"
 	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 )
 
 // ThinkingMode controls Claude's extended thinking behaviour.
@@ -80,6 +87,15 @@ type PermissionRuleValue struct {
 	RuleContent *string `json:"ruleContent,omitempty"`
 }
 
+// String formats the rule the way the CLI writes it, e.g. "Bash(git:*)" or
+// "Read".
+func (r PermissionRuleValue) String() string {
+	if r.RuleContent == nil {
+		return r.ToolName
+	}
+	return r.ToolName + "(" + *r.RuleContent + ")"
+}
+
 // PermissionUpdate is a single permission mutation returned by a PermissionHandler.
 // The Type field is the discriminant; fill the corresponding fields only.
 //
@@ -172,6 +188,19 @@ type McpHTTPServer struct {
 	Type    string            `json:"type"`
 	URL     string            `json:"url"`
 	Headers map[string]string `json:"headers,omitempty"`
+
+	// contexts is set for servers started by StartInProcessMCPServer.
+	contexts *mcpContexts
+}
+
+// McpSdkServer configures an MCP server that runs inside this process and is
+// reached through the CLI's stdin/stdout control channel instead of a network
+// transport. Create one with StartInMemoryMCPServer; the zero value is not usable.
+type McpSdkServer struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+
+	bridge *mcpBridge
 }
 
 // McpSSEServer configures an MCP server reachable over SSE.
@@ -269,6 +298,25 @@ type OutputFormat struct {
 	Schema map[string]any `json:"schema,omitempty"`
 }
 
+// ─── Model parameters ─────────────────────────────────────────────────────────
+
+// ModelParameters holds sampling parameters. Nil fields are left unset so the
+// CLI's defaults apply; a non-nil zero (e.g. Temperature 0) is sent as-is.
+//
+// The parameters are sent in the initialize message. Whether they are honoured
+// depends on the CLI version: the claude CLI does not document sampling
+// controls, and versions that do not recognise a field ignore it silently.
+// Extended thinking also constrains sampling (the API requires temperature 1
+// while thinking is enabled), so combine Temperature with ThinkingDisabled.
+type ModelParameters struct {
+	// Temperature controls randomness (0 = most deterministic).
+	Temperature *float64 `json:"temperature,omitempty"`
+	// TopP enables nucleus sampling.
+	TopP *float64 `json:"top_p,omitempty"`
+	// TopK samples only from the K most likely tokens.
+	TopK *int `json:"top_k,omitempty"`
+}
+
 // ─── Sandbox settings ─────────────────────────────────────────────────────────
 
 // NetworkSandboxSettings controls network access for sandboxed command execution.
@@ -306,7 +354,8 @@ type SandboxSettings struct {
 	// ExcludedCommands lists commands that always bypass the sandbox (e.g. "docker").
 	ExcludedCommands []string `json:"excludedCommands,omitempty"`
 	// AllowUnsandboxedCommands lets the model request unsandboxed execution via
-	// the dangerouslyDisableSandbox tool input flag.
+	// the dangerouslyDisableSandbox tool input flag. The CLI allows it by
+	// default, so when Enabled is set false is sent explicitly (see MarshalJSON).
 	AllowUnsandboxedCommands bool `json:"allowUnsandboxedCommands,omitempty"`
 	// Network controls network access within the sandbox.
 	Network *NetworkSandboxSettings `json:"network,omitempty"`
@@ -317,6 +366,99 @@ type SandboxSettings struct {
 	EnableWeakerNestedSandbox bool `json:"enableWeakerNestedSandbox,omitempty"`
 }
 
+// MarshalJSON always writes allowUnsandboxedCommands for an enabled sandbox.
+// The field is omitted when false otherwise, and the CLI would then apply its
+// own default, which lets the model run commands outside the sandbox.
+func (s SandboxSettings) MarshalJSON() ([]byte, error) {
+	type plain SandboxSettings
+	if !s.Enabled {
+		return json.Marshal(plain(s))
+	}
+	return json.Marshal(struct {
+		plain
+		AllowUnsandboxedCommands bool `json:"allowUnsandboxedCommands"`
+	}{plain(s), s.AllowUnsandboxedCommands})
+}
+
+// Validate reports settings that have no effect or contradict each other, such
+// as network restrictions on a disabled sandbox, which would otherwise leave
+// commands running unsandboxed without any sign of it. Query, Run, and
+// NewSession call it before spawning the CLI.
+func (s *SandboxSettings) Validate() error {
+	var problems []string
+	if !s.Enabled {
+		for _, f := range []struct {
+			set  bool
+			name string
+		}{
+			{s.AutoAllowBashIfSandboxed, "AutoAllowBashIfSandboxed"},
+			{s.AllowUnsandboxedCommands, "AllowUnsandboxedCommands"},
+			{len(s.ExcludedCommands) > 0, "ExcludedCommands"},
+			{s.Network != nil, "Network"},
+			{s.IgnoreViolations != nil, "IgnoreViolations"},
+			{s.EnableWeakerNestedSandbox, "EnableWeakerNestedSandbox"},
+		} {
+			if f.set {
+				problems = append(problems, f.name+" is set but Enabled is false, so commands run unsandboxed")
+			}
+		}
+	}
+	if n := s.Network; n != nil {
+		if n.AllowAllUnixSockets && len(n.AllowUnixSockets) > 0 {
+			problems = append(problems, "Network.AllowUnixSockets is redundant with Network.AllowAllUnixSockets")
+		}
+		for name, port := range map[string]int{"HTTPProxyPort": n.HTTPProxyPort, "SOCKSProxyPort": n.SOCKSProxyPort} {
+			if port < 0 || port > 65535 {
+				problems = append(problems, fmt.Sprintf("Network.%s %d is not a valid port", name, port))
+			}
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	slices.Sort(problems)
+	return fmt.Errorf("claude: invalid sandbox settings: %s", strings.Join(problems, "; "))
+}
+
+// dockerSocket is the Docker daemon socket opened up by SandboxAllowDocker.
+const dockerSocket = "/var/run/docker.sock"
+
+// SandboxOffline returns sandbox settings with no network access: commands run
+// sandboxed, Bash calls are auto-approved because the sandbox contains them,
+// and the model cannot ask to run a command outside the sandbox.
+func SandboxOffline() *SandboxSettings {
+	return &SandboxSettings{Enabled: true, AutoAllowBashIfSandboxed: true}
+}
+
+// SandboxAllowLocalhost is SandboxOffline plus binding to local ports, for
+// running and testing dev servers.
+func SandboxAllowLocalhost() *SandboxSettings {
+	s := SandboxOffline()
+	s.Network = &NetworkSandboxSettings{AllowLocalBinding: true}
+	return s
+}
+
+// SandboxAllowDocker is SandboxOffline plus access to the Docker daemon socket.
+// Note that reaching the daemon lets commands start containers outside the
+// sandbox.
+func SandboxAllowDocker() *SandboxSettings {
+	s := SandboxOffline()
+	s.Network = &NetworkSandboxSettings{AllowUnixSockets: []string{dockerSocket}}
+	return s
+}
+
+// SandboxProfile names a sandbox preset for WithSandboxProfile.
+type SandboxProfile string
+
+const (
+	// SandboxProfileOffline selects SandboxOffline.
+	SandboxProfileOffline SandboxProfile = "offline"
+	// SandboxProfileLocalhost selects SandboxAllowLocalhost.
+	SandboxProfileLocalhost SandboxProfile = "localhost"
+	// SandboxProfileDocker selects SandboxAllowDocker.
+	SandboxProfileDocker SandboxProfile = "docker"
+)
+
 // ─── Options ─────────────────────────────────────────────────────────────────
 
 // Options holds all configuration for a Query call.
@@ -325,10 +467,17 @@ type Options struct {
 	// Model selects the Claude model. Defaults to "claude-sonnet-4-6".
 	Model string
 
+	// ModelRouter, when set, picks the model for each Query or Run prompt.
+	ModelRouter func(prompt string) string
+
 	// SystemPrompt overrides the default system prompt.
 	// Sent via the initialize message on stdin (not as a CLI flag).
 	SystemPrompt string
 
+	// Memory is loaded into the system prompt and saved when the model updates
+	// it. See WithMemory.
+	Memory MemoryStore
+
 	// AppendSystemPrompt appends text to the existing system prompt.
 	// Sent via the initialize message on stdin.
 	AppendSystemPrompt string
@@ -346,18 +495,92 @@ type Options struct {
 	// Use with SessionID or Continue.
 	ForkSession bool
 
+	// SessionAutoReconnect makes Session re-spawn a subprocess that died between
+	// turns, resuming the last known session ID, before retrying Send.
+	SessionAutoReconnect bool
+
+	// AutoCompactTokens is the context size, in tokens, past which Session
+	// compacts the conversation into a fresh subprocess. Zero disables it.
+	AutoCompactTokens int
+
+	// AutoCompactSummarizer builds the compaction summary from the transcript.
+	// When nil the model writes it.
+	AutoCompactSummarizer func(transcript []Event) string
+
+	// PerTurnTimeout bounds each Session turn. Zero (the default) means no limit.
+	PerTurnTimeout time.Duration
+
+	// SessionGuard serialises Session turns; "" (the default) lets sends
+	// queue up. See WithConcurrentSessionGuard.
+	SessionGuard SessionGuard
+
+	// KeepAlive is the interval between liveness probes sent by a Session.
+	// Zero (the default) disables them.
+	KeepAlive time.Duration
+
+	// BatchConcurrency caps the prompts RunBatch runs at once. Zero means
+	// DefaultBatchConcurrency.
+	BatchConcurrency int
+
+	// ShutdownTimeout is how long a stopping subprocess has between SIGTERM
+	// and SIGKILL. Zero means DefaultShutdownTimeout.
+	ShutdownTimeout time.Duration
+
+	// InterruptSignals are the OS signals that interrupt the run while the
+	// stream is active. Empty (the default) installs no signal handler.
+	InterruptSignals []os.Signal
+
 	// AllowedTools restricts which Claude Code built-in tools may be used.
 	AllowedTools []string
 
 	// DisallowedTools explicitly blocks specific tools.
 	DisallowedTools []string
 
+	// MaxFileReadSize is the largest file, in bytes, the Read tool may read in
+	// full. Zero (the default) means no limit. Enforced by an internal
+	// PreToolUse hook.
+	MaxFileReadSize int
+
+	// AllowedDomains restricts WebFetch and WebSearch to these domains and their
+	// subdomains. Enforced by an internal PreToolUse hook.
+	AllowedDomains []string
+
 	// Thinking controls extended thinking mode. Defaults to ThinkingAdaptive.
 	Thinking ThinkingMode
 
 	// MaxThinkingTokens caps the thinking token budget via MAX_THINKING_TOKENS env var.
 	MaxThinkingTokens int
 
+	// MaxConcurrentTools caps how many tool calls the CLI runs in parallel, via
+	// CLAUDE_CODE_MAX_TOOL_USE_CONCURRENCY. Zero keeps the CLI default.
+	MaxConcurrentTools int
+
+	// StrictToolNames fails the run when AllowedTools or DisallowedTools name
+	// tools the CLI does not have.
+	StrictToolNames bool
+
+	// RequireAuth makes Query fail before spawning when the subprocess
+	// environment has no credentials.
+	RequireAuth bool
+
+	// MaxMessageSize is the largest assistant message, in bytes of JSON,
+	// delivered as is; OversizePolicy says what happens to larger ones. Zero
+	// means no limit beyond the 64 MiB any message is read with.
+	MaxMessageSize int
+	OversizePolicy OversizePolicy
+
+	// MaxToolResultTokens caps tool output returned to the model, via
+	// MAX_MCP_OUTPUT_TOKENS and BASH_MAX_OUTPUT_LENGTH. Zero keeps the defaults.
+	MaxToolResultTokens int
+
+	// ToolTimeout bounds each tool call. Zero keeps the CLI defaults. See
+	// WithToolTimeout.
+	ToolTimeout time.Duration
+
+	// CompactionThreshold is the context-window percentage at which the CLI
+	// auto-compacts, via CLAUDE_AUTOCOMPACT_PCT_OVERRIDE. Zero keeps the default.
+	CompactionThreshold int
+
 	// MaxTurns limits the number of agentic turns via --max-turns.
 	MaxTurns int
 
@@ -370,12 +593,31 @@ type Options struct {
 	// FallbackModel is the model to use when the primary model is unavailable.
 	FallbackModel string
 
+	// FallbackModels are the models Run retries with, in order, after
+	// FallbackModel. See WithModelFallbackChain.
+	FallbackModels []string
+
 	// MaxBudgetUSD sets the maximum cost budget in USD via --max-budget-usd.
 	MaxBudgetUSD float64
 
 	// OutputFormat configures structured output. Sent in the initialize message.
 	OutputFormat *OutputFormat
 
+	// ValidateOutput makes Run check StructuredOutput against OutputFormat's
+	// schema. See WithResponseSchemaValidation.
+	ValidateOutput bool
+
+	// Title is the session label requested in the initialize message; see
+	// WithTitle.
+	Title string
+
+	// ModelParameters holds sampling parameters sent in the initialize message.
+	ModelParameters *ModelParameters
+
+	// ResponsePrefill is text the assistant's reply is forced to begin with.
+	// See WithResponsePrefill.
+	ResponsePrefill string
+
 	// EnableFileCheckpointing enables file checkpointing via --enable-file-checkpointing.
 	EnableFileCheckpointing bool
 
@@ -400,6 +642,10 @@ type Options struct {
 	// When nil and using a non-bypass mode, all tool calls are auto-allowed.
 	PermissionHandler PermissionHandler
 
+	// InitialPermissionRules are applied when the subprocess starts. See
+	// WithInitialPermissionRules.
+	InitialPermissionRules []PermissionUpdate
+
 	// IncludePartialMessages enables streaming of partial assistant messages.
 	IncludePartialMessages bool
 
@@ -415,6 +661,10 @@ type Options struct {
 	// Sent via the initialize message.
 	Hooks map[HookEvent][]HookMatcher
 
+	// Skills lists named skills enabled for the main agent.
+	// Sent via the initialize message.
+	Skills []string
+
 	// Plugins lists local Claude Code plugins loaded for this session.
 	// Each plugin directory must contain a .claude-plugin/plugin.json manifest.
 	Plugins []SdkPluginConfig
@@ -441,6 +691,10 @@ type Options struct {
 	// This provides forward-compatibility for flags not yet modelled in Options.
 	ExtraArgs map[string]string
 
+	// RawArgs are passed verbatim, in order, after every other flag. See
+	// WithRawArgs.
+	RawArgs []string
+
 	// SystemPromptPreset configures a named preset system prompt.
 	// When set it takes precedence over SystemPrompt.
 	// Use WithSystemPromptPreset; leave nil to use SystemPrompt instead.
@@ -456,9 +710,72 @@ type Options struct {
 	// When nil, stderr is silently captured and included in errors on failure.
 	Stderr func(line string)
 
+	// CancelOnError shuts the stream down after the first error event. See
+	// WithCancelOnError.
+	CancelOnError bool
+
+	// TurnMarkers emits synthetic TypeTurnStart/TypeTurnEnd events around
+	// each agent turn.
+	TurnMarkers bool
+
+	// ContentFilter, when set, transforms assistant text before events are
+	// forwarded. See WithContentFilter.
+	ContentFilter func(text string) string
+
+	// OnToolUse is called for each tool_use block in assistant messages.
+	OnToolUse func(name string, input json.RawMessage, id string)
+
+	// OnToolResult is called for each tool_result block fed back to the model.
+	OnToolResult func(id string, content string, isErr bool)
+
+	// OnResult is called with each result message before it is delivered.
+	OnResult func(*Result)
+
+	// OnSuccess and OnError are called after OnResult with each successful
+	// and failed result respectively.
+	OnSuccess func(*Result)
+	OnError   func(*Result)
+
+	// ResultSink persists each result message before it is delivered; errors
+	// are reported as warnings. See WithResultSink and WithResultFile.
+	ResultSink func(*Result) error
+
+	// ResultTransform post-processes the result of Query and Run before it is
+	// delivered. See WithResultTransform.
+	ResultTransform func(*Result) error
+
+	// AgentEventHandler is called with each subagent event before it is delivered.
+	AgentEventHandler func(parentToolUseID string, e Event)
+
+	// RequestID is a caller-supplied correlation ID for the run. When empty a
+	// random one is generated. See WithRequestID.
+	RequestID string
+
+	// Pricing, when set, is used to fill Result.EstimatedCostUSD.
+	// See WithPricing.
+	Pricing Pricing
+
+	// MaxInputTokens caps the tokens in a Query or Run prompt; zero means no
+	// limit. Tokenizer counts them, EstimateTokens when nil. See
+	// WithMaxInputTokens.
+	MaxInputTokens int
+	Tokenizer      Tokenizer
+
+	// Tracer, when set, records a span tree for each Query/Run/Session.
+	// See WithTracer.
+	Tracer Tracer
+
+	// Metrics, when set, receives run, turn, tool, token, cost, and spawn
+	// measurements. See WithMetrics.
+	Metrics MetricsRecorder
+
 	// Env contains additional environment variables merged into the subprocess env.
 	Env map[string]string
 
+	// Entrypoint is reported to the CLI as CLAUDE_CODE_ENTRYPOINT for Anthropic
+	// telemetry. Defaults to "sdk-go".
+	Entrypoint string
+
 	// ResumeSessionAt specifies a message ID to resume the session from.
 	// Retained for forward-compatibility; not yet wired to a CLI flag.
 	ResumeSessionAt string
@@ -472,6 +789,10 @@ type Options struct {
 	// response as a map. When nil, elicitations are auto-cancelled.
 	ElicitationHandler ElicitationHandler
 
+	// MCPNotificationHandler is called for each mcp_message control_request
+	// before it is acknowledged. When nil, the messages are acknowledged silently.
+	MCPNotificationHandler func(server string, msg json.RawMessage)
+
 	// Sandbox configures command execution sandboxing.
 	// Passed to the CLI via the initialize message.
 	Sandbox *SandboxSettings
@@ -479,6 +800,29 @@ type Options struct {
 	// ClaudeExecutable is the path to the claude binary. Defaults to "claude".
 	ClaudeExecutable string
 
+	// CmdConfigurer, when set, is called with the subprocess's exec.Cmd just
+	// before it is started. See WithCmdConfigurer.
+	CmdConfigurer func(cmd *exec.Cmd)
+
+	// NpxFallback runs the CLI via npx when ClaudeExecutable cannot be found.
+	NpxFallback bool
+
+	// EventBufferSize is the capacity of the Events() channel. Defaults to 32.
+	// See WithEventBufferSize.
+	EventBufferSize int
+
+	// RateLimitRetries is how many times Run waits out a rate limit and
+	// retries. See WithRateLimitRetry.
+	RateLimitRetries int
+
+	// DryRun makes Query, Run, and NewSession return a *DryRunResult instead
+	// of spawning the CLI. See WithDryRun.
+	DryRun bool
+
+	// RawEventHook, when set, receives every stdout line of the subprocess
+	// before it is parsed. See WithRawEventHook.
+	RawEventHook func(line []byte)
+
 	// sessionMode is set internally by NewSession; not exposed as a public Option.
 	// When true, the subprocess stays alive across multiple turns (stdin is not
 	// closed after TypeResult) and the caller drives the conversation via Send().
@@ -492,6 +836,18 @@ func WithModel(model string) Option {
 	return func(o *Options) { o.Model = model }
 }
 
+// WithModelRouter sets a function that chooses the model from the prompt.
+// Query and Run call it after all options are applied and before the CLI is
+// spawned, so a non-empty return overrides WithModel regardless of option
+// order; returning "" keeps the configured model. WithFallbackModel is
+// unaffected and still applies when the routed model is unavailable.
+//
+// The router sees only the initial prompt: NewSession does not call it, and
+// later turns keep the model chosen at spawn (use Stream.SetModel to switch).
+func WithModelRouter(router func(prompt string) string) Option {
+	return func(o *Options) { o.ModelRouter = router }
+}
+
 func WithSystemPrompt(prompt string) Option {
 	return func(o *Options) { o.SystemPrompt = prompt }
 }
@@ -500,6 +856,21 @@ func WithAppendSystemPrompt(prompt string) Option {
 	return func(o *Options) { o.AppendSystemPrompt = prompt }
 }
 
+// WithMemory gives the model long-term memory that persists across runs and
+// sessions. Each time the CLI is spawned, store.Load is copied into a
+// MEMORY.md file in a temporary directory added with --add-dir, and the
+// appended system prompt shows the memory and asks the model to edit that
+// file to update it. A Stop hook passes the edited file to store.Save at the
+// end of every turn, before the turn's result is delivered, and again when
+// the process exits. FileMemoryStore keeps
+// memory in a file.
+//
+// The model edits the file with the Edit or Write tool, so those must stay
+// allowed, including for the temporary directory.
+func WithMemory(store MemoryStore) Option {
+	return func(o *Options) { o.Memory = store }
+}
+
 // WithSessionIDToResume resumes an existing session by its ID (--resume <id>).
 func WithSessionIDToResume(id string) Option {
 	return func(o *Options) { o.ResumeSessionID = id }
@@ -521,12 +892,175 @@ func WithForkSession() Option {
 	return func(o *Options) { o.ForkSession = true }
 }
 
+// WithSessionAutoReconnect makes a Session transparently re-spawn its
+// subprocess when it has died (OOM, crash) and resume the conversation via
+// --resume with the last known session ID. Reconnects are retried with
+// exponential backoff. Has no effect on Query/Run.
+func WithSessionAutoReconnect() Option {
+	return func(o *Options) { o.SessionAutoReconnect = true }
+}
+
+// WithPerTurnTimeout applies a deadline to each turn started with Session.Send.
+// When a turn runs longer than d, the CLI is asked to interrupt just that turn:
+// it ends with a TypeResult as usual, Session.TurnErr reports a
+// *TurnTimeoutError, and the session stays open for the next Send. Has no
+// effect on Query/Run; use a context deadline there.
+func WithPerTurnTimeout(d time.Duration) Option {
+	return func(o *Options) { o.PerTurnTimeout = d }
+}
+
+// WithConcurrentSessionGuard stops a Session from starting a turn while an
+// earlier one is in progress, which happens when several goroutines share a
+// session and would otherwise interleave their turns' events on Events. A turn
+// is in progress from Send until its TypeResult is delivered. With
+// SessionGuardError such a Send returns a *SessionBusyError; with
+// SessionGuardBlock it waits for the turn to end, for the subprocess to exit
+// or for the session's context to be done. A Send blocked this way waits on
+// the result, so another goroutine must be consuming Events. Has no effect on
+// Query/Run.
+func WithConcurrentSessionGuard(mode SessionGuard) Option {
+	return func(o *Options) { o.SessionGuard = mode }
+}
+
+// WithAutoCompaction makes a Session compact its conversation once the context
+// of the latest model call reaches threshold tokens. The check runs at the
+// next Send: the session obtains a summary, closes the subprocess, and starts a
+// fresh one (a new session ID) whose system prompt carries the summary, then
+// sends the message there. Range over Events() after Send as usual.
+//
+// summarizer receives the events since the session started or last compacted
+// and returns the summary. When it is nil the model is asked to summarize in
+// an extra turn on the old subprocess, whose events Send consumes. Has no
+// effect on Query/Run. The CLI's own auto-compaction (WithCompactionThreshold)
+// keeps the session ID and history; this replaces both.
+func WithAutoCompaction(threshold int, summarizer func(transcript []Event) string) Option {
+	return func(o *Options) {
+		o.AutoCompactTokens = threshold
+		o.AutoCompactSummarizer = summarizer
+	}
+}
+
+// WithInterruptOnSignal installs a signal handler for the lifetime of the
+// stream: the first of sigs interrupts the run as Stream.Interrupt does, and a
+// second one kills the subprocess immediately. With no arguments it listens
+// for SIGINT and SIGTERM. While the handler is installed those signals no
+// longer terminate the calling program; it is removed when the stream ends.
+func WithInterruptOnSignal(sigs ...os.Signal) Option {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	return func(o *Options) { o.InterruptSignals = sigs }
+}
+
+// WithBatchConcurrency sets how many prompts RunBatch runs at once, each in
+// its own subprocess. Zero or less keeps DefaultBatchConcurrency. Has no
+// effect elsewhere.
+func WithBatchConcurrency(n int) Option {
+	return func(o *Options) { o.BatchConcurrency = n }
+}
+
+// DefaultShutdownTimeout is how long the subprocess has to exit after SIGTERM
+// before it is killed, unless WithShutdownTimeout says otherwise.
+const DefaultShutdownTimeout = 5 * time.Second
+
+// WithShutdownTimeout sets how long the subprocess has to exit after SIGTERM,
+// when the stream is interrupted, closed or its context is done, before it is
+// sent SIGKILL. Raise it when the CLI needs time to flush work to disk, such
+// as file checkpoints (WithEnableFileCheckpointing). Zero or less keeps
+// DefaultShutdownTimeout.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(o *Options) { o.ShutdownTimeout = d }
+}
+
+// WithKeepAlive makes a Session probe its subprocess every interval with a
+// benign control request. If the CLI does not answer within interval the
+// session is marked dead and Session.Alive reports false until a later probe
+// succeeds. Has no effect on Query/Run.
+func WithKeepAlive(interval time.Duration) Option {
+	return func(o *Options) { o.KeepAlive = interval }
+}
+
+// WithAllowedTools adds tools to the --allowedTools list. Each call appends
+// to the existing list, skipping tools that are already present, so option
+// sets can be layered without dropping earlier entries.
 func WithAllowedTools(tools ...string) Option {
-	return func(o *Options) { o.AllowedTools = tools }
+	return func(o *Options) { o.AllowedTools = appendUnique(o.AllowedTools, tools...) }
+}
+
+// WithStrictToolNames makes unknown names in AllowedTools or DisallowedTools
+// fatal. They are always reported as a SubtypeWarning system event after init,
+// with a suggestion when only the case differs; with this option the run is
+// also stopped and Stream.Err (and Run) return an error listing them.
+func WithStrictToolNames() Option {
+	return func(o *Options) { o.StrictToolNames = true }
 }
 
+// WithRequireAuth checks, before the CLI is spawned, that its environment
+// (the parent environment plus WithEnv) has ANTHROPIC_API_KEY, another
+// credential variable such as CLAUDE_CODE_OAUTH_TOKEN or
+// CLAUDE_CODE_USE_BEDROCK, or an OAuth session from `claude /login`. Without
+// one, Query and Run return an *AuthRequiredError up front instead of the
+// CLI's failure mid-stream.
+//
+// The session is detected by its .credentials.json file in CLAUDE_CONFIG_DIR
+// or ~/.claude. On macOS the CLI keeps the login in the Keychain instead,
+// which the SDK cannot inspect, so there a missing credential only produces a
+// SubtypeWarning event after init; a CLI that is not logged in then fails with
+// its own *AuthRequiredError.
+func WithRequireAuth() Option {
+	return func(o *Options) { o.RequireAuth = true }
+}
+
+// WithMaxMessageSize limits the size of the assistant messages delivered on
+// Events to n bytes of JSON, for consumers such as UIs that cannot render one
+// huge message. A larger message is handled by policy: OversizeTruncate cuts
+// its content and ends it with OversizeMarker, OversizeDrop leaves it out, and
+// OversizeError stops the run with a *MessageTooLargeError. The policy is
+// applied after parsing and the SDK's own observers (tracing, metrics,
+// WithContentFilter), right before the message is delivered; Raw is updated
+// to match a truncated message.
+//
+// n is capped at 64 MiB: a single message larger than that cannot be read at
+// all and ends the stream with bufio.ErrTooLong before any policy applies.
+func WithMaxMessageSize(n int, policy OversizePolicy) Option {
+	return func(o *Options) {
+		o.MaxMessageSize = min(n, maxLineSize)
+		o.OversizePolicy = policy
+	}
+}
+
+// WithDisallowedTools adds tools to the --disallowedTools list. Like
+// WithAllowedTools, each call appends and skips duplicates.
 func WithDisallowedTools(tools ...string) Option {
-	return func(o *Options) { o.DisallowedTools = tools }
+	return func(o *Options) { o.DisallowedTools = appendUnique(o.DisallowedTools, tools...) }
+}
+
+// appendUnique appends the values not already in dst, preserving order.
+func appendUnique(dst []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(dst, v) {
+			dst = append(dst, v)
+		}
+	}
+	return dst
+}
+
+// WithMaxFileReadSize denies Read calls for files larger than bytes, so a
+// stray read of a huge log cannot blow the token budget. The CLI has no such
+// setting, so the SDK checks the file's size in a PreToolUse hook before the
+// read runs. Reads that pass a line limit are bounded already and allowed;
+// the denial reason tells Claude to retry with offset and limit.
+func WithMaxFileReadSize(bytes int) Option {
+	return func(o *Options) { o.MaxFileReadSize = bytes }
+}
+
+// WithAllowedDomains restricts WebFetch and WebSearch to the given domains
+// (and their subdomains). Fetches outside the allowlist, and searches that do
+// not limit allowed_domains to the allowlist, are denied via a PreToolUse hook
+// so the denial goes through the CLI's permission machinery in every
+// permission mode. Each call appends to the existing list.
+func WithAllowedDomains(domains ...string) Option {
+	return func(o *Options) { o.AllowedDomains = append(o.AllowedDomains, domains...) }
 }
 
 func WithThinking(mode ThinkingMode) Option {
@@ -537,6 +1071,58 @@ func WithMaxThinkingTokens(n int) Option {
 	return func(o *Options) { o.MaxThinkingTokens = n }
 }
 
+// WithMaxConcurrentTools caps how many tool calls from a single model response
+// the CLI executes in parallel. The CLI only runs tools concurrently when they
+// are safe to (read-only built-ins and MCP tools annotated read-only); other
+// calls already run one at a time. Use 1 to serialise everything. The limit is
+// passed via the CLAUDE_CODE_MAX_TOOL_USE_CONCURRENCY environment variable, as
+// the initialize message has no equivalent field.
+func WithMaxConcurrentTools(n int) Option {
+	return func(o *Options) { o.MaxConcurrentTools = n }
+}
+
+// charsPerToken approximates tokens to characters for CLI limits given in
+// characters.
+const charsPerToken = 4
+
+// WithMaxToolResultTokens caps how much tool output is fed back to the model.
+// The CLI does the truncation and marks where output was cut: MCP tool results
+// are limited to n tokens via MAX_MCP_OUTPUT_TOKENS, and Bash output to about
+// 4n characters via BASH_MAX_OUTPUT_LENGTH, keeping its head and tail. Built-in
+// file tools such as Read already apply their own limits. Neither the
+// initialize message nor hooks can shorten built-in tool results, which is why
+// the environment is used.
+func WithMaxToolResultTokens(n int) Option {
+	return func(o *Options) { o.MaxToolResultTokens = n }
+}
+
+// WithToolTimeout bounds each tool call to d. The initialize message has no
+// per-tool timeout, so the CLI's own limits are set instead: MCP_TOOL_TIMEOUT
+// for MCP tools and BASH_DEFAULT_TIMEOUT_MS / BASH_MAX_TIMEOUT_MS for Bash.
+// Those fail just the call, and the model sees the timeout as the tool's
+// result.
+//
+// Any other call still running toolTimeoutGrace after d, e.g. a hung WebFetch,
+// is stopped by interrupting the turn: the result that follows is an error,
+// Run returns a *ToolTimeoutError, and Session.TurnErr reports it. Task calls,
+// which run whole subagents, are exempt from this fallback. Time spent in a
+// PermissionHandler, e.g. waiting for a human to approve the call, does not
+// count: the call's deadline starts over once the handler has decided.
+func WithToolTimeout(d time.Duration) Option {
+	return func(o *Options) { o.ToolTimeout = d }
+}
+
+// WithCompactionThreshold sets the percentage (1-100) of the context window at
+// which the CLI auto-compacts the conversation, via the
+// CLAUDE_AUTOCOMPACT_PCT_OVERRIDE environment variable. The CLI's knob is
+// relative to the model's context window, not an absolute token count. Whether
+// a value above the CLI's built-in threshold is honoured depends on the CLI
+// version. Compactions are reported as SubtypeCompactBoundary system events,
+// followed by a TypeCompaction event carrying the summary.
+func WithCompactionThreshold(percent int) Option {
+	return func(o *Options) { o.CompactionThreshold = percent }
+}
+
 func WithMaxTurns(n int) Option {
 	return func(o *Options) { o.MaxTurns = n }
 }
@@ -545,7 +1131,8 @@ func WithEffort(level EffortLevel) Option {
 	return func(o *Options) { o.Effort = level }
 }
 
-// WithBetas enables one or more beta feature flags.
+// WithBetas enables one or more beta feature flags. Calls accumulate;
+// duplicates are dropped.
 func WithBetas(betas ...string) Option {
 	return func(o *Options) { o.Betas = append(o.Betas, betas...) }
 }
@@ -555,6 +1142,42 @@ func WithFallbackModel(model string) Option {
 	return func(o *Options) { o.FallbackModel = model }
 }
 
+// WithModelFallbackChain makes Run retry a run that failed because its model
+// was overloaded or unavailable with each of models in turn, until one
+// answers. A model counts as unavailable when the CLI reports an
+// overloaded_error or not_found_error, or an API error with status 529. The
+// chain follows WithFallbackModel, which the CLI already tries on its own, so
+// that model is not retried: with WithFallbackModel(sonnet) and
+// WithModelFallbackChain(haiku), a run that fails on opus and then on sonnet
+// inside the CLI is retried on haiku. Each call appends to the chain. Retries
+// start from scratch with the same prompt; the Result.Model of the returned
+// result tells which model answered. Query and Session are not affected.
+func WithModelFallbackChain(models ...string) Option {
+	return func(o *Options) { o.FallbackModels = append(o.FallbackModels, models...) }
+}
+
+// fallbackChain returns the models Run may retry with, in order, leaving out
+// the model and fallback model the first attempt already tried.
+func (o *Options) fallbackChain() []string {
+	var chain []string
+	for _, m := range appendUnique(nil, o.FallbackModels...) {
+		if m != o.Model && m != o.FallbackModel {
+			chain = append(chain, m)
+		}
+	}
+	return chain
+}
+
+// withFallbackAttempt runs the attempt on model: it overrides WithModel and
+// WithModelRouter, and drops the CLI-side fallback, already tried.
+func withFallbackAttempt(model string) Option {
+	return func(o *Options) {
+		o.Model = model
+		o.ModelRouter = nil
+		o.FallbackModel = ""
+	}
+}
+
 // WithMaxBudgetUSD sets the maximum cost budget in USD.
 func WithMaxBudgetUSD(usd float64) Option {
 	return func(o *Options) { o.MaxBudgetUSD = usd }
@@ -565,6 +1188,51 @@ func WithOutputFormat(f *OutputFormat) Option {
 	return func(o *Options) { o.OutputFormat = f }
 }
 
+// WithResponseSchemaValidation makes Run validate Result.StructuredOutput
+// against the json_schema of WithOutputFormat on the client side, and fail
+// with a *SchemaValidationError naming the offending schema path when the
+// model's output does not conform. Query and Session users can do the same by
+// calling OutputFormat.Validate on each result.
+func WithResponseSchemaValidation() Option {
+	return func(o *Options) { o.ValidateOutput = true }
+}
+
+// WithTitle asks the CLI to label the session with title, so it can be found
+// later, e.g. in the Title of ListSessions results, instead of by UUID alone.
+// The title is sent as a "title" field of the initialize message. The CLI's
+// control protocol does not document that field, so whether it is stored, and
+// whether it replaces a title the CLI generates from the conversation, depends
+// on the CLI version; check ListSessions before relying on it. Versions that
+// do not know the field ignore it.
+func WithTitle(title string) Option {
+	return func(o *Options) { o.Title = title }
+}
+
+// WithModelParameters sets sampling parameters (temperature, top_p, top_k).
+// See ModelParameters for which fields the CLI honours.
+func WithModelParameters(p ModelParameters) Option {
+	return func(o *Options) { o.ModelParameters = &p }
+}
+
+// WithResponsePrefill primes every reply to begin with text (the "prefill"
+// technique), e.g. "{" to get raw JSON. After each user message the SDK writes
+// a partial assistant message containing text, and the model continues from
+// it. The prefill itself is not repeated in the assistant text or Result, so
+// prepend it when you need the complete reply.
+//
+// Experimental: the CLI's stream-json input is documented for user messages
+// only, and whether it treats a trailing assistant message as a prefill
+// depends on the CLI version. Check the reply before relying on it.
+//
+// The API rejects a prefill while extended thinking is on, so Query, Run, and
+// NewSession fail unless WithThinking(ThinkingDisabled) is also set. Prefill
+// is ignored when a structured OutputFormat ("json" or "json_schema") is set,
+// since the CLI then produces the structured output itself; a SubtypeWarning
+// system event reports this.
+func WithResponsePrefill(text string) Option {
+	return func(o *Options) { o.ResponsePrefill = text }
+}
+
 // WithEnableFileCheckpointing enables file checkpointing.
 func WithEnableFileCheckpointing() Option {
 	return func(o *Options) { o.EnableFileCheckpointing = true }
@@ -603,7 +1271,11 @@ func WithDefaultPermissions() Option {
 	}
 }
 
-// WithPermissionPromptToolName sets the MCP tool name used for permission prompts.
+// WithPermissionPromptToolName sets the MCP tool name used for permission
+// prompts, in the form "mcp__<server>__<tool>". Query, Run and NewSession fail
+// for a name of any other form, and when the CLI's init message does not list
+// the tool a SubtypeWarning system event says so, naming the tools the server
+// does have.
 func WithPermissionPromptToolName(name string) Option {
 	return func(o *Options) { o.PermissionPromptToolName = name }
 }
@@ -613,6 +1285,27 @@ func WithPermissionHandler(h PermissionHandler) Option {
 	return func(o *Options) { o.PermissionHandler = h }
 }
 
+// WithInitialPermissionRules seeds static permission rules at startup, so
+// policy can be expressed as data instead of a PermissionHandler round trip
+// per call. A handler still runs for calls the rules do not settle.
+//
+//	git, rm := "git:*", "rm:*"
+//	claude.WithInitialPermissionRules([]claude.PermissionUpdate{
+//	    {Type: "addRules", Behavior: claude.PermissionBehaviorAllow, Rules: []claude.PermissionRuleValue{{ToolName: "Bash", RuleContent: &git}}},
+//	    {Type: "addRules", Behavior: claude.PermissionBehaviorDeny, Rules: []claude.PermissionRuleValue{{ToolName: "Bash", RuleContent: &rm}}},
+//	})
+//
+// The CLI has no startup channel for arbitrary permission updates, so the
+// updates are translated to flags: "addRules" with allow or deny behaviour
+// extends --allowedTools / --disallowedTools, "setMode" sets the permission
+// mode, and "addDirectories" adds --add-dir entries. Destination is ignored;
+// rules last for the session. Other updates (including "ask" rules) cannot be
+// applied at startup, so Query, Run, and NewSession fail without spawning the
+// CLI.
+func WithInitialPermissionRules(rules []PermissionUpdate) Option {
+	return func(o *Options) { o.InitialPermissionRules = append(o.InitialPermissionRules, rules...) }
+}
+
 func WithIncludePartialMessages() Option {
 	return func(o *Options) { o.IncludePartialMessages = true }
 }
@@ -633,6 +1326,13 @@ func WithHooks(hooks map[HookEvent][]HookMatcher) Option {
 	return func(o *Options) { o.Hooks = hooks }
 }
 
+// WithSkills enables named skills for the main agent. The names are sent in
+// the initialize message; any name not listed in the init message's skills is
+// reported as a SubtypeWarning system event. Each call appends to the list.
+func WithSkills(names ...string) Option {
+	return func(o *Options) { o.Skills = append(o.Skills, names...) }
+}
+
 // WithPlugins registers one or more local Claude Code plugins for the session.
 // Each SdkPluginConfig must have Type "local" and a path to the plugin directory.
 func WithPlugins(plugins ...SdkPluginConfig) Option {
@@ -669,6 +1369,21 @@ func WithExtraArgs(args map[string]string) Option {
 	}
 }
 
+// WithRawArgs appends args verbatim to the claude command line, after all
+// SDK-managed flags and WithExtraArgs (which are sorted by name), in the order
+// given. Each call appends. Unlike WithExtraArgs it keeps order and allows a
+// flag to repeat, e.g. WithRawArgs("--some-new-flag", "value", "--beta").
+//
+// Nothing is checked or de-duplicated. The CLI generally lets the last
+// occurrence of a single-valued flag win, so a raw flag that the SDK also
+// manages (--model, --permission-mode, ...) overrides the typed option on the
+// command line while the SDK keeps acting on its own value; and the
+// stream-json flags the SDK relies on must not be changed. Prefer a typed
+// option once one exists.
+func WithRawArgs(args ...string) Option {
+	return func(o *Options) { o.RawArgs = append(o.RawArgs, args...) }
+}
+
 // WithSystemPromptPreset sets a named preset system prompt.
 // Takes precedence over WithSystemPrompt when both are set.
 func WithSystemPromptPreset(p *SystemPromptPreset) Option {
@@ -687,6 +1402,180 @@ func WithStderr(fn func(line string)) Option {
 	return func(o *Options) { o.Stderr = fn }
 }
 
+// WithCancelOnError makes the stream shut itself down, as if Interrupt were
+// called, right after delivering the first error event: a TypeResult with
+// IsError set or a TypeSystem event with Subtype "error". Every consumer then
+// sees the Events() channel close, so there is one place to stop a pipeline on
+// failure instead of each consumer racing to call Interrupt. In a Session this
+// ends the whole session, not just the failed turn.
+func WithCancelOnError() Option {
+	return func(o *Options) { o.CancelOnError = true }
+}
+
+// WithTurnMarkers emits a synthetic TypeTurnStart event before each agent turn
+// and a TypeTurnEnd event after it, so consumers can group events by turn. A
+// turn is one model response plus the tool results fed back to it; the last
+// TypeTurnEnd precedes the TypeResult. Subagent messages stay inside the turn
+// that spawned them.
+func WithTurnMarkers() Option {
+	return func(o *Options) { o.TurnMarkers = true }
+}
+
+// WithContentFilter sets a function applied by the reader goroutine to every
+// piece of assistant text before the event is forwarded: each text content
+// block of TypeAssistant messages, each text_delta of TypeStreamEvent
+// messages, and Result.Result. Use it for redaction or profanity filtering.
+//
+// Filtering happens per delta: fn sees each streamed chunk in isolation, so a
+// pattern split across two deltas is not matched. Filter the complete
+// assistant message when whole-text matching matters. Event.Raw still carries
+// the original, unfiltered line.
+func WithContentFilter(fn func(text string) string) Option {
+	return func(o *Options) { o.ContentFilter = fn }
+}
+
+// WithOnToolUse sets an observer called with the tool name, raw input, and
+// tool use ID of every tool call the model makes. The callback runs in its own
+// goroutine (fire-and-forget), so it never blocks event delivery and calls may
+// arrive out of order relative to Events().
+func WithOnToolUse(fn func(name string, input json.RawMessage, id string)) Option {
+	return func(o *Options) { o.OnToolUse = fn }
+}
+
+// WithOnToolResult sets an observer called with the tool use ID, flattened
+// text content, and error flag of every tool result fed back to the model.
+// Like WithOnToolUse, the callback is fire-and-forget.
+func WithOnToolResult(fn func(id string, content string, isErr bool)) Option {
+	return func(o *Options) { o.OnToolResult = fn }
+}
+
+// WithOnResult sets a callback invoked with every result message: once per
+// Query or Run, and once per turn in a Session. Unlike WithOnToolUse it runs
+// synchronously on the delivery goroutine, before the result is sent on
+// Events(), so it has finished by the time Run returns or the channel closes.
+// Keep it fast; event delivery waits for it. The Result is the one consumers
+// receive and must not be modified.
+func WithOnResult(fn func(*Result)) Option {
+	return func(o *Options) { o.OnResult = fn }
+}
+
+// WithOnSuccess sets a callback invoked with every result whose IsError is
+// false. It runs like WithOnResult, right after it.
+func WithOnSuccess(fn func(*Result)) Option {
+	return func(o *Options) { o.OnSuccess = fn }
+}
+
+// WithOnError sets a callback invoked with every result whose IsError is
+// true; Subtype tells why the run failed (e.g. "error_max_turns",
+// "error_during_execution"). It runs like WithOnResult, right after it.
+// Failures without a result, such as a crashed CLI, do not reach it.
+func WithOnError(fn func(*Result)) Option {
+	return func(o *Options) { o.OnError = fn }
+}
+
+// WithResultSink sets a function that persists every result message, such as
+// an upload to object storage. It runs like WithOnResult, after it and before
+// the result is delivered. An error does not fail the run, which already has
+// its result: it is reported as a SubtypeWarning system event sent ahead of
+// the result, so a consumer can retry with the Result it receives.
+func WithResultSink(fn func(*Result) error) Option {
+	return func(o *Options) { o.ResultSink = fn }
+}
+
+// WithResultTransform sets a function that modifies the result of Query and
+// Run in place before it is delivered, such as stripping Markdown code fences
+// from Result.Result or fixing up Result.StructuredOutput, which is already
+// decoded when fn runs. It runs before WithOnResult and the other result
+// callbacks, which see the transformed result; Event.Raw keeps the CLI's
+// original. When fn returns an error the result is not delivered: Run returns
+// the error, wrapped, and so does Stream.Err. Has no effect on Session.
+func WithResultTransform(fn func(*Result) error) Option {
+	return func(o *Options) { o.ResultTransform = fn }
+}
+
+// WithResultFile writes every result message, including usage and structured
+// output, to dir/<session_id>.json as indented JSON, creating dir if needed.
+// The file is written to a temporary name and renamed into place, so
+// concurrent runs and readers never see a partial file. In a Session each
+// turn's result replaces the previous one. It sets the WithResultSink
+// function; errors are reported the same way.
+func WithResultFile(dir string) Option {
+	return WithResultSink(resultFileSink(dir))
+}
+
+// WithAgentEventHandler sets a callback for events produced by subagents (see
+// WithAgents): assistant, user and stream events whose parent_tool_use_id is
+// set. parentToolUseID is that ID, the tool_use ID of the Task call that started the
+// subagent, so it is the same for all of a subagent's events, distinct
+// between parallel subagents, and matches the Task call's tool_use and
+// tool_result blocks in the parent's events, which mark the subagent's start
+// and end. Event.ParentToolUseID returns the same ID; it is not the CLI's
+// agent_id reported by Event.AgentID.
+//
+// Like WithOnResult, fn runs on the delivery goroutine before the event is
+// sent on Events(), so calls arrive in stream order; keep it fast. The events
+// are still delivered on Events().
+func WithAgentEventHandler(fn func(parentToolUseID string, e Event)) Option {
+	return func(o *Options) { o.AgentEventHandler = fn }
+}
+
+// WithRequestID stamps the run with a caller-supplied correlation ID, e.g. the
+// ID of the upstream HTTP request. It is returned by Stream.RequestID and
+// recorded as the AttrRequestID attribute of the root span. It is unrelated to
+// the internal control-request IDs. When not set, a random ID is generated.
+func WithRequestID(id string) Option {
+	return func(o *Options) { o.RequestID = id }
+}
+
+// WithMaxInputTokens makes Query and Run fail with a *PromptTooLargeError,
+// without starting the CLI, when the prompt plus the system prompt and
+// appended system prompt come to more than n tokens. Tokens are estimated
+// locally with EstimateTokens unless WithTokenizer supplies an exact count.
+// The CLI's own system prompt, tool definitions and CLAUDE.md files are not
+// counted, so leave headroom below the model's context window. Session turns
+// are not checked.
+func WithMaxInputTokens(n int) Option {
+	return func(o *Options) { o.MaxInputTokens = n }
+}
+
+// WithTokenizer sets the token counter used by WithMaxInputTokens, such as
+// one backed by the model's tokenizer.
+func WithTokenizer(fn Tokenizer) Option {
+	return func(o *Options) { o.Tokenizer = fn }
+}
+
+// WithPricing fills Result.EstimatedCostUSD with the run's cost at the given
+// per-model rates, which override DefaultPricing for the models they name;
+// other models keep their list price. Use it when negotiated rates make the
+// CLI's TotalCostUSD differ from what is actually billed. Each call merges
+// into the existing table.
+func WithPricing(rates map[string]ModelPricing) Option {
+	return func(o *Options) {
+		if o.Pricing == nil {
+			o.Pricing = mergePricing(rates)
+			return
+		}
+		maps.Copy(o.Pricing, rates)
+	}
+}
+
+// WithTracer records each Query, Run, or Session as a tree of spans: a root
+// SpanRun, a SpanTurn per user message, a SpanTool per tool call, and a
+// SpanControlRequest around each control request handled for the CLI
+// (permission checks, hook callbacks). Model, session ID, token usage, and
+// cost are recorded as attributes. See Tracer for adapting OpenTelemetry.
+func WithTracer(t Tracer) Option {
+	return func(o *Options) { o.Tracer = t }
+}
+
+// WithMetrics feeds rec with measurements from every subprocess: spawn
+// latency, one ObserveTurn per result (tokens, cost, turns), tool call
+// durations, and the run's lifetime and outcome. The metrics/prometheus
+// module provides a Prometheus recorder; see MetricsRecorder.
+func WithMetrics(rec MetricsRecorder) Option {
+	return func(o *Options) { o.Metrics = rec }
+}
+
 // WithSettingSources controls which settings files are loaded by the subprocess.
 // Pass one or more of SettingSourceUser, SettingSourceProject, SettingSourceLocal.
 // When not called, no filesystem settings are loaded (SDK isolation mode).
@@ -711,10 +1600,113 @@ func WithSandbox(s *SandboxSettings) Option {
 	return func(o *Options) { o.Sandbox = s }
 }
 
+// WithSandboxProfile configures sandboxing from a preset; see SandboxOffline,
+// SandboxAllowLocalhost, and SandboxAllowDocker. An unknown name selects the
+// offline preset so a typo never opens up network access.
+func WithSandboxProfile(name SandboxProfile) Option {
+	return func(o *Options) {
+		switch name {
+		case SandboxProfileLocalhost:
+			o.Sandbox = SandboxAllowLocalhost()
+		case SandboxProfileDocker:
+			o.Sandbox = SandboxAllowDocker()
+		default:
+			o.Sandbox = SandboxOffline()
+		}
+	}
+}
+
+// WithEntrypoint sets the CLAUDE_CODE_ENTRYPOINT value reported to the CLI,
+// letting products that embed the SDK identify their integration distinctly.
+// Defaults to "sdk-go".
+func WithEntrypoint(name string) Option {
+	return func(o *Options) { o.Entrypoint = name }
+}
+
 func WithClaudeExecutable(path string) Option {
 	return func(o *Options) { o.ClaudeExecutable = path }
 }
 
+// WithCmdConfigurer registers fn to adjust the claude subprocess's exec.Cmd
+// just before cmd.Start, for process control the SDK does not model, e.g.
+// SysProcAttr for a dedicated process group or Pdeathsig on Linux:
+//
+//	claude.WithCmdConfigurer(func(cmd *exec.Cmd) {
+//	    cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+//	})
+//
+// The SDK has already set Path, Args, Env, Dir, and the stdin/stdout/stderr
+// pipes. Changing those, or starting the command, breaks the stream-json
+// protocol; fn should only add settings.
+func WithCmdConfigurer(fn func(cmd *exec.Cmd)) Option {
+	return func(o *Options) { o.CmdConfigurer = fn }
+}
+
+// defaultEventBufferSize is the Events() channel capacity unless
+// WithEventBufferSize changes it.
+const defaultEventBufferSize = 32
+
+// WithEventBufferSize sets how many events the Events() channel buffers
+// (default 32; 0 makes it unbuffered). When the buffer is full, delivery waits
+// for the consumer and further events queue up in memory; the CLI's control
+// requests (permission prompts, hook callbacks) are still answered right away.
+// A larger buffer absorbs bursts such as partial-message streaming at the cost
+// of memory. Negative values are ignored.
+//
+// The queue behind the buffer is unbounded and the CLI is never paused, so a
+// consumer that stops reading Events() without calling Drain or Close makes
+// memory grow with every event the run produces, partial messages included.
+func WithEventBufferSize(n int) Option {
+	return func(o *Options) {
+		if n >= 0 {
+			o.EventBufferSize = n
+		}
+	}
+}
+
+// WithRateLimitRetry makes Run wait until a rate or usage limit resets and
+// then run the prompt again from scratch, up to maxWaits times, instead of
+// returning a *RateLimitError. The reset time comes from the CLI's
+// rate_limit_event (or its "usage limit reached" message); the wait ends
+// early with ctx.Err() if ctx is cancelled. A limit without a known reset time
+// is waited out with a backoff starting at 30 seconds and doubling with each
+// wait, up to 30 minutes. Query and Session are not affected.
+func WithRateLimitRetry(maxWaits int) Option {
+	return func(o *Options) { o.RateLimitRetries = maxWaits }
+}
+
+// WithDryRun makes Query, Run, and NewSession describe the CLI invocation
+// instead of performing it: nothing is spawned, and the returned error is a
+// *DryRunResult holding the argv, environment, and stdin messages that would
+// have been used. Retrieve it with errors.As:
+//
+//	_, err := claude.Run(ctx, "hi", claude.WithModel("claude-opus-4-6"), claude.WithDryRun())
+//	var dry *claude.DryRunResult
+//	if errors.As(err, &dry) {
+//	    fmt.Println(strings.Join(dry.Args, " "))
+//	}
+func WithDryRun() Option {
+	return func(o *Options) { o.DryRun = true }
+}
+
+// WithRawEventHook registers fn to receive every non-empty line the CLI
+// writes to stdout, exactly as read and before any parsing — including control
+// messages and lines that are not valid JSON — for example to persist the wire
+// format verbatim. fn runs on the reader goroutine, so it delays event delivery
+// and must not block. The slice is reused by the reader and is only valid
+// during the call; copy it to keep it.
+func WithRawEventHook(fn func(line []byte)) Option {
+	return func(o *Options) { o.RawEventHook = fn }
+}
+
+// WithNpxFallback runs the CLI as `npx -y @anthropic-ai/claude-code` when the
+// claude binary cannot be found, for machines without a global install. The
+// first run may be slow while npx downloads the package. When the fallback is
+// used, a SubtypeWarning system event naming it follows the init message.
+func WithNpxFallback() Option {
+	return func(o *Options) { o.NpxFallback = true }
+}
+
 // WithResumeSessionAt sets a message ID to resume the session from.
 func WithResumeSessionAt(messageID string) Option {
 	return func(o *Options) { o.ResumeSessionAt = messageID }
@@ -731,6 +1723,46 @@ func WithElicitationHandler(h ElicitationHandler) Option {
 	return func(o *Options) { o.ElicitationHandler = h }
 }
 
+// WithMCPNotificationHandler sets a callback invoked with the server name and
+// raw JSON-RPC message of every mcp_message control request, such as progress
+// or logging notifications pushed by an MCP server. The handler runs on the
+// reader goroutine before the message is acknowledged, so keep it fast.
+func WithMCPNotificationHandler(fn func(server string, msg json.RawMessage)) Option {
+	return func(o *Options) { o.MCPNotificationHandler = fn }
+}
+
+// knownSessionID returns the ID of the session the CLI will use, when the
+// options determine it up front: the resumed or custom session ID. A forked
+// session gets a new ID that is only known once the CLI reports it.
+func (o *Options) knownSessionID() string {
+	if o.ForkSession {
+		return ""
+	}
+	return cmp.Or(o.ResumeSessionID, o.CustomSessionID)
+}
+
+// responsePrefill returns the prefill to send, or "" when none applies.
+func (o *Options) responsePrefill() string {
+	if o.structuredOutput() {
+		return ""
+	}
+	return o.ResponsePrefill
+}
+
+// checkResponsePrefill rejects a prefill combined with extended thinking,
+// which the API refuses.
+func checkResponsePrefill(o *Options) error {
+	if o.responsePrefill() != "" && o.Thinking != ThinkingDisabled {
+		return fmt.Errorf("claude: WithResponsePrefill requires WithThinking(ThinkingDisabled); thinking is %q", o.Thinking)
+	}
+	return nil
+}
+
+// structuredOutput reports whether a non-text OutputFormat is configured.
+func (o *Options) structuredOutput() bool {
+	return o.OutputFormat != nil && o.OutputFormat.Type != "" && o.OutputFormat.Type != "text"
+}
+
 func defaultOptions() *Options {
 	return &Options{
 		Model:                           "claude-sonnet-4-6",
@@ -738,7 +1770,54 @@ func defaultOptions() *Options {
 		PermissionMode:                  PermissionModeBypassPermissions,
 		AllowDangerouslySkipPermissions: true,
 		ClaudeExecutable:                "claude",
+		Entrypoint:                      defaultEntrypoint,
+		EventBufferSize:                 defaultEventBufferSize,
+	}
+}
+
+// initialPermissionRules is InitialPermissionRules translated to CLI flags.
+type initialPermissionRules struct {
+	allow, deny []string
+	dirs        []string
+	mode        PermissionMode
+	unsupported []string // descriptions of updates that cannot be applied
+}
+
+// initialRules translates InitialPermissionRules; see WithInitialPermissionRules.
+func (o *Options) initialRules() initialPermissionRules {
+	var r initialPermissionRules
+	for _, u := range o.InitialPermissionRules {
+		switch {
+		case u.Type == "addRules" && u.Behavior == PermissionBehaviorAllow:
+			for _, rule := range u.Rules {
+				r.allow = append(r.allow, rule.String())
+			}
+		case u.Type == "addRules" && u.Behavior == PermissionBehaviorDeny:
+			for _, rule := range u.Rules {
+				r.deny = append(r.deny, rule.String())
+			}
+		case u.Type == "setMode":
+			r.mode = u.Mode
+		case u.Type == "addDirectories":
+			r.dirs = append(r.dirs, u.Directories...)
+		default:
+			desc := u.Type
+			if u.Behavior != "" {
+				desc += " (" + string(u.Behavior) + ")"
+			}
+			r.unsupported = append(r.unsupported, desc)
+		}
 	}
+	return r
+}
+
+// checkInitialPermissionRules rejects InitialPermissionRules that have no
+// startup flag, rather than starting a session without them.
+func checkInitialPermissionRules(o *Options) error {
+	if u := o.initialRules().unsupported; len(u) > 0 {
+		return fmt.Errorf("claude: initial permission updates cannot be applied at startup: %s", strings.Join(u, ", "))
+	}
+	return nil
 }
 
 // buildArgs constructs the CLI argument slice for the claude binary.
@@ -791,16 +1870,18 @@ func (o *Options) buildArgs() []string {
 		args = append(args, "--fork-session")
 	}
 
-	if len(o.AllowedTools) > 0 {
-		args = append(args, "--allowedTools", strings.Join(o.AllowedTools, ","))
+	rules := o.initialRules()
+
+	if allowed := append(slices.Clone(o.AllowedTools), rules.allow...); len(allowed) > 0 {
+		args = append(args, "--allowedTools", strings.Join(allowed, ","))
 	}
 
-	if len(o.DisallowedTools) > 0 {
-		args = append(args, "--disallowedTools", strings.Join(o.DisallowedTools, ","))
+	if disallowed := append(slices.Clone(o.DisallowedTools), rules.deny...); len(disallowed) > 0 {
+		args = append(args, "--disallowedTools", strings.Join(disallowed, ","))
 	}
 
-	if o.PermissionMode != "" {
-		args = append(args, "--permission-mode", string(o.PermissionMode))
+	if mode := cmp.Or(rules.mode, o.PermissionMode); mode != "" {
+		args = append(args, "--permission-mode", string(mode))
 	}
 
 	if o.AllowDangerouslySkipPermissions {
@@ -811,8 +1892,10 @@ func (o *Options) buildArgs() []string {
 		args = append(args, "--include-partial-messages")
 	}
 
-	if len(o.Betas) > 0 {
-		args = append(args, "--betas", strings.Join(o.Betas, ","))
+	// Betas are sorted and de-duplicated so composing option layers that
+	// enable the same beta twice stays valid and the flag is deterministic.
+	if betas := slices.Compact(slices.Sorted(slices.Values(o.Betas))); len(betas) > 0 {
+		args = append(args, "--betas", strings.Join(betas, ","))
 	}
 
 	if o.FallbackModel != "" {
@@ -843,7 +1926,7 @@ func (o *Options) buildArgs() []string {
 	}
 
 	// AdditionalDirectories: each directory gets its own --add-dir flag.
-	for _, dir := range o.AdditionalDirectories {
+	for _, dir := range append(slices.Clone(o.AdditionalDirectories), rules.dirs...) {
 		if dir != "" {
 			args = append(args, "--add-dir", dir)
 		}
@@ -881,8 +1964,10 @@ func (o *Options) buildArgs() []string {
 
 	// ExtraArgs: arbitrary extra flags for forward-compatibility.
 	// Boolean flags (empty value) are appended as a single element; flags with
-	// a value are appended as two elements (flag, value).
-	for flag, val := range o.ExtraArgs {
+	// a value are appended as two elements (flag, value). They are sorted so
+	// the command line does not depend on map order.
+	for _, flag := range slices.Sorted(maps.Keys(o.ExtraArgs)) {
+		val := o.ExtraArgs[flag]
 		if flag == "" {
 			continue
 		}
@@ -892,6 +1977,7 @@ func (o *Options) buildArgs() []string {
 			args = append(args, flag, val)
 		}
 	}
+	args = append(args, o.RawArgs...)
 
 	// Note: SandboxSettings is passed via the initialize message (not CLI flags).
 	// Note: ResumeSessionAt is omitted — the --resume-at flag does not exist in
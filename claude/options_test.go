@@ -2,6 +2,8 @@ package claude
 
 import (
 	"encoding/json"
+	"errors"
+	"reflect"
 	"slices"
 	"strings"
 	"testing"
@@ -322,6 +324,20 @@ func TestBuildArgs_ExtraArgsBoolFlag(t *testing.T) {
 	}
 }
 
+func TestBuildArgs_RawArgs(t *testing.T) {
+	opts := defaultOptions()
+	WithModel("claude-sonnet-4-6")(opts)
+	WithExtraArgs(map[string]string{"--b-flag": "", "--a-flag": "x"})(opts)
+	WithRawArgs("--some-new-flag", "value")(opts)
+	WithRawArgs("--add-dir", "/a", "--add-dir", "/b")(opts)
+
+	args := opts.buildArgs()
+	want := []string{"--a-flag", "x", "--b-flag", "--some-new-flag", "value", "--add-dir", "/a", "--add-dir", "/b"}
+	if tail := args[len(args)-len(want):]; !slices.Equal(tail, want) {
+		t.Fatalf("expected args to end with %v, got %v", want, args)
+	}
+}
+
 func TestWithOptions(t *testing.T) {
 	opts := defaultOptions()
 
@@ -375,3 +391,191 @@ func TestDefaultOptions(t *testing.T) {
 		t.Fatalf("expected default executable 'claude', got %s", opts.ClaudeExecutable)
 	}
 }
+
+func TestBuildArgs_InitialPermissionRules(t *testing.T) {
+	git, rm := "git:*", "rm:*"
+	opts := defaultOptions()
+	WithAllowedTools("Read")(opts)
+	WithInitialPermissionRules([]PermissionUpdate{
+		{Type: "addRules", Behavior: PermissionBehaviorAllow, Rules: []PermissionRuleValue{{ToolName: "Bash", RuleContent: &git}}},
+		{Type: "addRules", Behavior: PermissionBehaviorDeny, Rules: []PermissionRuleValue{{ToolName: "Bash", RuleContent: &rm}, {ToolName: "WebFetch"}}},
+		{Type: "setMode", Mode: PermissionModeAcceptEdits},
+		{Type: "addDirectories", Directories: []string{"/data"}},
+		{Type: "addRules", Behavior: PermissionBehaviorAsk, Rules: []PermissionRuleValue{{ToolName: "Write"}}},
+	})(opts)
+
+	args := opts.buildArgs()
+	for _, want := range [][2]string{
+		{"--allowedTools", "Read,Bash(git:*)"},
+		{"--disallowedTools", "Bash(rm:*),WebFetch"},
+		{"--permission-mode", string(PermissionModeAcceptEdits)},
+		{"--add-dir", "/data"},
+	} {
+		if !containsFlag(args, want[0], want[1]) {
+			t.Errorf("expected %s %s in %v", want[0], want[1], args)
+		}
+	}
+
+	if err := checkInitialPermissionRules(opts); err == nil || !strings.Contains(err.Error(), "addRules (ask)") {
+		t.Fatalf("expected the ask rule to be rejected, got %v", err)
+	}
+	_, err := Query(t.Context(), "hi", WithClaudeExecutable("/nonexistent/claude"), WithInitialPermissionRules(opts.InitialPermissionRules))
+	if err == nil || !strings.Contains(err.Error(), "addRules (ask)") {
+		t.Fatalf("expected Query to fail before spawning, got %v", err)
+	}
+}
+
+func TestBuildArgs_BetasSortedAndDeduplicated(t *testing.T) {
+	opts := defaultOptions()
+	WithBetas("y", "x")(opts)
+	WithBetas("x")(opts)
+	args := opts.buildArgs()
+	if !containsFlag(args, "--betas", "x,y") {
+		t.Fatalf("expected --betas x,y, got %v", args)
+	}
+	if len(opts.Betas) != 3 {
+		t.Fatalf("expected buildArgs not to modify Betas, got %v", opts.Betas)
+	}
+}
+
+func TestWithAllowedTools_Accumulates(t *testing.T) {
+	opts := defaultOptions()
+	WithAllowedTools("Read", "Glob")(opts)
+	WithAllowedTools("Glob", "Bash")(opts)
+	WithDisallowedTools("Write")(opts)
+	WithDisallowedTools("Write", "Edit")(opts)
+
+	if got := strings.Join(opts.AllowedTools, ","); got != "Read,Glob,Bash" {
+		t.Fatalf("unexpected AllowedTools %q", got)
+	}
+	if got := strings.Join(opts.DisallowedTools, ","); got != "Write,Edit" {
+		t.Fatalf("unexpected DisallowedTools %q", got)
+	}
+}
+
+func TestWithSandboxProfile(t *testing.T) {
+	tests := []struct {
+		profile SandboxProfile
+		want    *NetworkSandboxSettings
+	}{
+		{SandboxProfileOffline, nil},
+		{SandboxProfileLocalhost, &NetworkSandboxSettings{AllowLocalBinding: true}},
+		{SandboxProfileDocker, &NetworkSandboxSettings{AllowUnixSockets: []string{"/var/run/docker.sock"}}},
+		{"no-such-profile", nil},
+	}
+	for _, tt := range tests {
+		opts := defaultOptions()
+		WithSandboxProfile(tt.profile)(opts)
+		s := opts.Sandbox
+		if s == nil || !s.Enabled || !s.AutoAllowBashIfSandboxed || s.AllowUnsandboxedCommands {
+			t.Fatalf("%s: unexpected sandbox %+v", tt.profile, s)
+		}
+		if b, _ := json.Marshal(s); !strings.Contains(string(b), `"allowUnsandboxedCommands":false`) {
+			t.Fatalf("%s: the CLI would apply its default for allowUnsandboxedCommands: %s", tt.profile, b)
+		}
+		if !reflect.DeepEqual(s.Network, tt.want) {
+			t.Fatalf("%s: expected network %+v, got %+v", tt.profile, tt.want, s.Network)
+		}
+	}
+}
+
+func TestSandboxSettings_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		s    SandboxSettings
+		want string
+	}{
+		{SandboxSettings{Enabled: true}, `{"enabled":true,"allowUnsandboxedCommands":false}`},
+		{SandboxSettings{Enabled: true, AllowUnsandboxedCommands: true}, `{"enabled":true,"allowUnsandboxedCommands":true}`},
+		{SandboxSettings{}, `{}`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(&tt.s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("Marshal(%+v) = %s, want %s", tt.s, b, tt.want)
+		}
+	}
+}
+
+func TestSandboxSettings_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       SandboxSettings
+		wantErr string
+	}{
+		{"preset", *SandboxAllowDocker(), ""},
+		{"disabled and empty", SandboxSettings{}, ""},
+		{"network while disabled", SandboxSettings{Network: &NetworkSandboxSettings{AllowLocalBinding: true}}, "Network is set but Enabled is false"},
+		{"unsandboxed while disabled", SandboxSettings{AllowUnsandboxedCommands: true}, "AllowUnsandboxedCommands is set but Enabled is false"},
+		{"redundant sockets", SandboxSettings{Enabled: true, Network: &NetworkSandboxSettings{AllowAllUnixSockets: true, AllowUnixSockets: []string{"/tmp/x.sock"}}}, "redundant"},
+		{"bad port", SandboxSettings{Enabled: true, Network: &NetworkSandboxSettings{HTTPProxyPort: 70000}}, "HTTPProxyPort 70000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.s.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestQuery_InvalidSandbox(t *testing.T) {
+	_, err := Query(t.Context(), "hi", WithClaudeExecutable("/does/not/exist"),
+		WithSandbox(&SandboxSettings{Network: &NetworkSandboxSettings{AllowLocalBinding: true}}))
+	if err == nil || !strings.Contains(err.Error(), "invalid sandbox settings") {
+		t.Fatalf("expected sandbox validation error, got %v", err)
+	}
+}
+
+func TestWithEventBufferSize(t *testing.T) {
+	exe := writeFakeCLI(t, `cat >/dev/null`)
+	for _, tt := range []struct {
+		opts []Option
+		want int
+	}{
+		{nil, defaultEventBufferSize},
+		{[]Option{WithEventBufferSize(256)}, 256},
+		{[]Option{WithEventBufferSize(0)}, 0},
+		{[]Option{WithEventBufferSize(-1)}, defaultEventBufferSize},
+	} {
+		stream, err := Query(t.Context(), "", append(tt.opts, WithClaudeExecutable(exe))...)
+		if err != nil {
+			t.Fatalf("Query: %v", err)
+		}
+		if got := cap(stream.events); got != tt.want {
+			t.Errorf("expected buffer size %d, got %d", tt.want, got)
+		}
+		stream.Drain()
+	}
+}
+
+func TestWithModelRouter(t *testing.T) {
+	router := WithModelRouter(func(prompt string) string {
+		if strings.HasPrefix(prompt, "easy:") {
+			return "claude-haiku-4-5"
+		}
+		return ""
+	})
+	for prompt, want := range map[string]string{
+		"easy: 2+2":       "claude-haiku-4-5",
+		"prove the lemma": "claude-opus-4-6",
+	} {
+		_, err := Run(t.Context(), prompt, router, WithModel("claude-opus-4-6"), WithDryRun())
+		var dry *DryRunResult
+		if !errors.As(err, &dry) {
+			t.Fatalf("expected *DryRunResult, got %T: %v", err, err)
+		}
+		if !containsFlag(dry.Args, "--model", want) {
+			t.Errorf("%q: expected --model %s in args %v", prompt, want, dry.Args)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package claude
+
+import (
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// OversizePolicy selects what WithMaxMessageSize does with an assistant
+// message that exceeds the limit.
+type OversizePolicy string
+
+const (
+	// OversizeTruncate cuts the message's content to fit and ends it with a
+	// text block holding OversizeMarker.
+	OversizeTruncate OversizePolicy = "truncate"
+	// OversizeDrop leaves the message out of Events.
+	OversizeDrop OversizePolicy = "drop"
+	// OversizeError stops the run; Stream.Err and Run return a
+	// *MessageTooLargeError.
+	OversizeError OversizePolicy = "error"
+)
+
+// OversizeMarker is the note OversizeTruncate puts where content was cut.
+const OversizeMarker = "[message too large]"
+
+// limitMessageSize applies opts.OversizePolicy to e when it is an assistant
+// message larger than opts.MaxMessageSize. It reports whether e should still
+// be delivered, and returns an error for OversizeError.
+func limitMessageSize(e *Event, opts *Options) (bool, error) {
+	if opts.MaxMessageSize <= 0 || e.Assistant == nil || len(e.Raw) <= opts.MaxMessageSize {
+		return true, nil
+	}
+	switch opts.OversizePolicy {
+	case OversizeDrop:
+		return false, nil
+	case OversizeError:
+		return false, &MessageTooLargeError{Size: len(e.Raw), Limit: opts.MaxMessageSize}
+	}
+	truncateMessage(e, opts.MaxMessageSize)
+	return true, nil
+}
+
+// truncateMessage keeps the leading content of e.Assistant that fits in about
+// limit bytes of JSON, cutting the block that crosses the limit when it is
+// text and dropping it otherwise, then appends OversizeMarker. Thinking blocks
+// are never cut, since their signature would no longer match. e.Raw is
+// re-encoded from the result.
+func truncateMessage(e *Event, limit int) {
+	content := e.Assistant.Message.Content
+	marker := ContentBlock{Type: "text", Text: OversizeMarker}
+
+	// Everything but the content (envelope, usage, IDs) is kept, so the budget
+	// is what remains once the message holds only the marker.
+	e.Assistant.Message.Content = []ContentBlock{marker}
+	base, _ := json.Marshal(e.Assistant)
+	budget := limit - len(base)
+
+	var kept []ContentBlock
+	for _, b := range content {
+		raw, _ := json.Marshal(b)
+		size := len(raw) + 1 // and a comma
+		if size <= budget {
+			kept = append(kept, b)
+			budget -= size
+			continue
+		}
+		if b.Type == "text" {
+			// Escaping can make the JSON longer than the text; cut until it fits.
+			for b.Text != "" && size > budget {
+				b.Text = cutUTF8(b.Text, len(b.Text)-(size-budget))
+				raw, _ = json.Marshal(b)
+				size = len(raw) + 1
+			}
+			if b.Text != "" {
+				kept = append(kept, b)
+			}
+		}
+		break
+	}
+	e.Assistant.Message.Content = append(kept, marker)
+	if raw, err := json.Marshal(e.Assistant); err == nil {
+		e.Raw = raw
+	}
+}
+
+// cutUTF8 returns the longest prefix of s of at most n bytes that does not
+// split a rune.
+func cutUTF8(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if n >= len(s) {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,98 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// bigAssistantLine returns an assistant message with a short text block, a
+// text block of n bytes and a tool_use block.
+func bigAssistantLine(n int) string {
+	return fmt.Sprintf(`{"type":"assistant","message":{"id":"m1","role":"assistant","content":[{"type":"text","text":"intro "},{"type":"text","text":"%s"},{"type":"tool_use","id":"t1","name":"Read","input":{}}]},"session_id":"s1","uuid":"u1"}`,
+		strings.Repeat("é", n/2))
+}
+
+func TestLimitMessageSize_Truncate(t *testing.T) {
+	e, err := parseLine([]byte(bigAssistantLine(10000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := &Options{MaxMessageSize: 1000, OversizePolicy: OversizeTruncate}
+	if keep, err := limitMessageSize(&e, opts); !keep || err != nil {
+		t.Fatalf("limitMessageSize = %v, %v", keep, err)
+	}
+	if len(e.Raw) > 1000 {
+		t.Fatalf("truncated message is %d bytes, want <= 1000", len(e.Raw))
+	}
+	content := e.Assistant.Message.Content
+	if len(content) != 3 || content[0].Text != "intro " || content[2].Text != OversizeMarker {
+		t.Fatalf("unexpected content: %+v", content)
+	}
+	if body := content[1].Text; body == "" || !strings.HasPrefix(strings.Repeat("é", 5000), body) {
+		t.Fatalf("cut text is not a whole-rune prefix: %q", body)
+	}
+	reparsed, err := parseLine(e.Raw)
+	if err != nil || reparsed.Assistant.Text() != e.Assistant.Text() {
+		t.Fatalf("Raw does not match the truncated message: %v", err)
+	}
+
+	small, _ := parseLine([]byte(bigAssistantLine(10)))
+	raw := string(small.Raw)
+	if keep, _ := limitMessageSize(&small, opts); !keep || string(small.Raw) != raw {
+		t.Fatal("expected a message under the limit to be left alone")
+	}
+}
+
+func TestWithMaxMessageSize_CappedAtLineLimit(t *testing.T) {
+	o := &Options{}
+	WithMaxMessageSize(1<<30, OversizeError)(o)
+	if o.MaxMessageSize != maxLineSize {
+		t.Fatalf("MaxMessageSize = %d, want it capped at %d", o.MaxMessageSize, maxLineSize)
+	}
+}
+
+func TestQuery_MaxMessageSize(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      printf '%s\n' '`+bigAssistantLine(10000)+`'
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"done"}]},"session_id":"s1"}'
+      echo '{"type":"result","subtype":"success","result":"done","session_id":"s1","is_error":false}'
+      exit 0 ;;
+  esac
+done
+`)
+
+	t.Run("drop", func(t *testing.T) {
+		stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe), WithMaxMessageSize(1000, OversizeDrop))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var texts []string
+		for e := range stream.Events() {
+			if e.Assistant != nil {
+				texts = append(texts, e.Assistant.Text())
+			}
+		}
+		if err := stream.Err(); err != nil {
+			t.Fatalf("stream error: %v", err)
+		}
+		if len(texts) != 1 || texts[0] != "done" {
+			t.Fatalf("expected only the small message, got %d messages", len(texts))
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithMaxMessageSize(1000, OversizeError))
+		var tooLarge *MessageTooLargeError
+		if !errors.As(err, &tooLarge) {
+			t.Fatalf("expected *MessageTooLargeError, got %T: %v", err, err)
+		}
+		if tooLarge.Limit != 1000 || tooLarge.Size <= 1000 {
+			t.Fatalf("unexpected error: %+v", tooLarge)
+		}
+	})
+}
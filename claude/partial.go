@@ -0,0 +1,158 @@
+package claude
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// structuredOutputTool is the tool the CLI has the model call to produce
+// json_schema structured output; its input is the output.
+const structuredOutputTool = "StructuredOutput"
+
+// PartialStructured returns a channel of best-effort snapshots of the
+// structured output while the model is still writing it. Each snapshot is
+// valid JSON containing only the parts completed so far — finished array
+// elements and object members — with the open containers closed, so a table
+// can be rendered row by row. The final snapshot is the complete
+// StructuredOutput of the result.
+//
+// Snapshots are built from input_json_delta stream events, so
+// WithIncludePartialMessages and a json_schema OutputFormat are required.
+// The channel holds only the latest snapshot: a slow reader skips
+// intermediate ones but never blocks the stream. It is closed when the stream
+// ends. Call PartialStructured before Events() is first consumed.
+func (s *Stream) PartialStructured() <-chan json.RawMessage {
+	s.partialOnce.Do(func() {
+		s.partial.Store(&partialStructured{ch: make(chan json.RawMessage, 1), index: -1})
+	})
+	return s.partial.Load().ch
+}
+
+// closePartial closes the PartialStructured channel once the stream has ended,
+// creating it first so that later calls get a closed channel.
+func (s *Stream) closePartial() {
+	s.PartialStructured()
+	close(s.partial.Load().ch)
+}
+
+// partialStructured tracks the StructuredOutput tool input being streamed.
+type partialStructured struct {
+	ch    chan json.RawMessage
+	index int // content block index of the StructuredOutput tool_use, or -1
+	json  partialJSON
+}
+
+// observe updates the snapshot from e. It runs on the delivery goroutine.
+func (p *partialStructured) observe(e Event) {
+	switch {
+	case e.StreamEvent != nil:
+		ev := e.StreamEvent.Event
+		switch ev.Type {
+		case "content_block_start":
+			if cb := ev.ContentBlock; cb != nil && cb.Type == "tool_use" && cb.Name == structuredOutputTool {
+				p.index = ev.Index
+				p.json = partialJSON{}
+			}
+		case "content_block_delta":
+			if ev.Index == p.index && ev.Delta != nil && ev.Delta.Type == "input_json_delta" {
+				if snap, ok := p.json.write(ev.Delta.PartialJSON); ok {
+					p.publish(snap)
+				}
+			}
+		case "content_block_stop":
+			if ev.Index == p.index {
+				p.index = -1
+			}
+		}
+	case e.Result != nil && e.Result.StructuredOutput != nil:
+		if b, err := json.Marshal(e.Result.StructuredOutput); err == nil {
+			p.publish(b)
+		}
+	}
+}
+
+// publish replaces any unread snapshot with snap.
+func (p *partialStructured) publish(snap []byte) {
+	select {
+	case p.ch <- snap:
+	default:
+		select {
+		case <-p.ch:
+		default:
+		}
+		p.ch <- snap
+	}
+}
+
+// partialJSON incrementally scans a JSON text and remembers the last point at
+// which everything before it forms complete values, together with the
+// containers still open there.
+type partialJSON struct {
+	buf      strings.Builder
+	stack    []byte // open containers: '{' or '['
+	inString bool
+	escaped  bool
+
+	safeLen   int    // length of buf at the last safe point
+	safeStack []byte // stack at the last safe point
+	emitted   int    // safeLen of the last snapshot returned
+}
+
+// write appends chunk and returns a new snapshot when the safe point moved.
+func (j *partialJSON) write(chunk string) ([]byte, bool) {
+	for i := 0; i < len(chunk); i++ {
+		c := chunk[i]
+		j.buf.WriteByte(c)
+		if j.inString {
+			switch {
+			case j.escaped:
+				j.escaped = false
+			case c == '\\':
+				j.escaped = true
+			case c == '"':
+				j.inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			j.inString = true
+		case '{', '[':
+			j.stack = append(j.stack, c)
+			if len(j.stack) == 1 {
+				// Nested containers only count once closed, so snapshots
+				// never hold empty placeholder rows.
+				j.markSafe(j.buf.Len())
+			}
+		case '}', ']':
+			if len(j.stack) > 0 {
+				j.stack = j.stack[:len(j.stack)-1]
+			}
+			j.markSafe(j.buf.Len())
+		case ',':
+			// The element or member before the comma is complete.
+			j.markSafe(j.buf.Len() - 1)
+		}
+	}
+	if j.safeLen == j.emitted {
+		return nil, false
+	}
+	j.emitted = j.safeLen
+	snap := []byte(j.buf.String()[:j.safeLen])
+	for i := len(j.safeStack) - 1; i >= 0; i-- {
+		if j.safeStack[i] == '{' {
+			snap = append(snap, '}')
+		} else {
+			snap = append(snap, ']')
+		}
+	}
+	if !json.Valid(snap) {
+		return nil, false
+	}
+	return snap, true
+}
+
+func (j *partialJSON) markSafe(n int) {
+	j.safeLen = n
+	j.safeStack = append(j.safeStack[:0], j.stack...)
+}
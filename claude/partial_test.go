@@ -0,0 +1,81 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPartialJSON(t *testing.T) {
+	var j partialJSON
+	var got []string
+	for _, chunk := range []string{`{"ro`, `ws":[{"id":1,"na`, `me":"a, b"}`, `,{"id":2`, `}]}`} {
+		if snap, ok := j.write(chunk); ok {
+			got = append(got, string(snap))
+		}
+	}
+	want := []string{
+		`{}`,
+		`{"rows":[{"id":1}]}`,
+		`{"rows":[{"id":1,"name":"a, b"}]}`,
+		`{"rows":[{"id":1,"name":"a, b"},{"id":2}]}`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected snapshots:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestStreamPartialStructured(t *testing.T) {
+	lines := []string{
+		`{"type":"stream_event","event":{"type":"content_block_start","index":0,"content_block":{"type":"tool_use","id":"tu1","name":"StructuredOutput","input":{}}}}`,
+	}
+	for _, chunk := range []string{`{"rows":[{"id":1}`, `,{"id":2}`, `]}`} {
+		b, _ := json.Marshal(chunk)
+		lines = append(lines, fmt.Sprintf(`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"input_json_delta","partial_json":%s}}}`, b))
+	}
+	lines = append(lines, `{"type":"result","subtype":"success","structured_output":{"rows":[{"id":1},{"id":2}]}}`)
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	if err := os.WriteFile(out, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	exe := writeFakeCLI(t, fmt.Sprintf(`while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      cat %q
+      exit 0 ;;
+  esac
+done
+`, out))
+
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe), WithIncludePartialMessages())
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	partials := stream.PartialStructured()
+	done := make(chan []string)
+	go func() {
+		var snaps []string
+		for snap := range partials {
+			snaps = append(snaps, string(snap))
+		}
+		done <- snaps
+	}()
+	for range stream.Events() {
+	}
+	snaps := <-done
+	if len(snaps) == 0 {
+		t.Fatal("expected at least one snapshot")
+	}
+	for _, s := range snaps {
+		if !json.Valid([]byte(s)) {
+			t.Fatalf("snapshot is not valid JSON: %s", s)
+		}
+	}
+	if last := snaps[len(snaps)-1]; last != `{"rows":[{"id":1},{"id":2}]}` {
+		t.Fatalf("expected the final snapshot to be the full output, got %s", last)
+	}
+}
@@ -0,0 +1,65 @@
+package claude
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// splitMCPToolName splits an "mcp__<server>__<tool>" name into its server and
+// tool. ok is false for any other name.
+func splitMCPToolName(name string) (server, tool string, ok bool) {
+	rest, ok := strings.CutPrefix(name, "mcp__")
+	if !ok {
+		return "", "", false
+	}
+	server, tool, ok = strings.Cut(rest, "__")
+	return server, tool, ok && server != "" && tool != ""
+}
+
+// checkPermissionPromptTool rejects a PermissionPromptToolName that cannot name
+// an MCP tool, before the CLI is started.
+func checkPermissionPromptTool(opts *Options) error {
+	name := opts.PermissionPromptToolName
+	if name == "" || name == "stdio" {
+		return nil
+	}
+	if _, _, ok := splitMCPToolName(name); !ok {
+		return fmt.Errorf("claude: permission prompt tool %q is not an MCP tool name of the form mcp__<server>__<tool>", name)
+	}
+	return nil
+}
+
+// permissionPromptToolWarning explains why PermissionPromptToolName matches
+// none of the tools the CLI reported, or returns "" when it matches or the CLI
+// listed no tools. The server named in it may be configured outside the SDK,
+// in settings or .mcp.json, so only the CLI's list is authoritative.
+func permissionPromptToolWarning(opts *Options, tools []string) string {
+	name := opts.PermissionPromptToolName
+	if len(tools) == 0 || slices.Contains(tools, name) {
+		return ""
+	}
+	server, _, ok := splitMCPToolName(name)
+	if !ok {
+		return ""
+	}
+	msg := fmt.Sprintf("permission prompt tool %q is not among the CLI's tools, so permission prompts will not reach it", name)
+	if i := slices.IndexFunc(tools, func(t string) bool { return strings.EqualFold(t, name) }); i >= 0 {
+		return msg + fmt.Sprintf(" (did you mean %q?)", tools[i])
+	}
+	var serverTools []string
+	for _, t := range tools {
+		if strings.HasPrefix(t, "mcp__"+server+"__") {
+			serverTools = append(serverTools, t)
+		}
+	}
+	switch {
+	case len(serverTools) > 0:
+		msg += fmt.Sprintf("; MCP server %q has %s", server, strings.Join(serverTools, ", "))
+	case opts.McpServers[server] == nil:
+		msg += fmt.Sprintf("; no MCP server %q is configured with WithMcpServers", server)
+	default:
+		msg += fmt.Sprintf("; MCP server %q reported no tools, it may have failed to start", server)
+	}
+	return msg
+}
@@ -0,0 +1,86 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultPingTimeout bounds Ping when ctx has no earlier deadline.
+const DefaultPingTimeout = 15 * time.Second
+
+// Ping checks that the CLI configured by opts starts and speaks the SDK's
+// control protocol, without sending a prompt: it spawns the CLI as NewSession
+// does, waits for the reply to a read-only control request, and closes it. No
+// tokens are used and no request is made to the API, so Ping suits readiness
+// probes. It returns nil when the CLI replied, and otherwise:
+//   - *CLINotFoundError: the executable could not be found
+//   - *AuthRequiredError: credentials are missing, with WithRequireAuth
+//   - *ProcessError: the CLI exited first, e.g. because it is too old to
+//     know the stream-json flags (Stderr says which)
+//   - an error wrapping context.DeadlineExceeded: the CLI did not reply within
+//     DefaultPingTimeout or ctx's deadline
+//
+// Because the API is not contacted, a revoked API key is not detected; use
+// WithRequireAuth to at least require one to be configured.
+func Ping(ctx context.Context, opts ...Option) error {
+	_, err := probe(ctx, "ping", keepAliveSubtype, opts)
+	return err
+}
+
+// probe spawns the CLI without a prompt, sends one control request and
+// returns the reply once the CLI is closed. Errors are those of Ping,
+// prefixed with op; an error reply is returned as a response with Success
+// false.
+func probe(ctx context.Context, op, subtype string, opts []Option) (controlResponse, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+	ctx, cancel := context.WithTimeout(ctx, DefaultPingTimeout)
+	defer cancel()
+
+	stream, err := spawnSession(ctx, o)
+	if err != nil {
+		return controlResponse{}, err
+	}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for range stream.Events() {
+		}
+	}()
+	var resp controlResponse
+	reply := make(chan error, 1)
+	go func() {
+		var err error
+		resp, err = stream.control(ctx, subtype, nil)
+		reply <- err
+	}()
+
+	select {
+	case err = <-reply:
+	case <-drained:
+		err = fmt.Errorf("claude: %s: CLI exited without replying", op)
+	}
+	if err == nil {
+		stream.Close()
+		<-drained
+		return resp, nil
+	}
+	// A failed write means the CLI is exiting; let it, so that Err reports why
+	// rather than the suppressed error of a closed stream.
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		<-drained
+	}
+	if streamErr := stream.Err(); streamErr != nil && !errors.Is(streamErr, context.DeadlineExceeded) {
+		return controlResponse{}, streamErr
+	}
+	if ctx.Err() != nil {
+		return controlResponse{}, fmt.Errorf("claude: %s: no reply from the CLI: %w", op, ctx.Err())
+	}
+	return controlResponse{}, err
+}
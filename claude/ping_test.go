@@ -0,0 +1,49 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPing(t *testing.T) {
+	responsive := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"subtype":"mcp_status"'*)
+      id=$(printf '%s' "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+      echo '{"type":"control_response","request_id":"'"$id"'","response":{"subtype":"success"}}' ;;
+    *'"type":"user"'*)
+      echo 'unexpected prompt' >&2
+      exit 1 ;;
+  esac
+done
+`)
+	if err := Ping(context.Background(), WithClaudeExecutable(responsive)); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	tooOld := writeFakeCLI(t, `echo "error: unknown option '--input-format'" >&2
+exit 1
+`)
+	err := Ping(context.Background(), WithClaudeExecutable(tooOld))
+	var procErr *ProcessError
+	if !errors.As(err, &procErr) || procErr.Stderr == "" {
+		t.Fatalf("expected *ProcessError with stderr, got %T: %v", err, err)
+	}
+
+	err = Ping(context.Background(), WithClaudeExecutable(filepath.Join(t.TempDir(), "missing")))
+	var notFound *CLINotFoundError
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected *CLINotFoundError, got %T: %v", err, err)
+	}
+
+	hung := writeFakeCLI(t, `while IFS= read -r line; do :; done
+`)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := Ping(ctx, WithClaudeExecutable(hung)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected a deadline error, got %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPoolClosed is returned by WarmPool.Run after Close.
+var ErrPoolClosed = errors.New("claude: warm pool closed")
+
+// WarmPool keeps CLI subprocesses started and initialized ahead of time so that
+// Run does not pay the CLI's startup latency. Each subprocess serves exactly
+// one Run and is then closed and replaced in the background: the CLI has no
+// way to clear a conversation, so reusing a process would leak one caller's
+// history into the next. Every Run therefore starts a new session.
+//
+// A member that dies while idle is discarded and replaced. When no warm member
+// is available, because of concurrent Runs or a failed replacement, Run
+// spawns a subprocess itself rather than wait.
+//
+// A WarmPool is safe for concurrent use. Close it to stop the idle processes.
+type WarmPool struct {
+	opts     []Option
+	resolved *Options // opts applied, for settings Run itself honours
+
+	ctx    context.Context // lifetime of the pool's subprocesses
+	cancel context.CancelFunc
+	idle   chan *Stream
+
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup // replacements in flight
+}
+
+// NewWarmPool starts size subprocesses configured with opts and returns once
+// they are spawned. Options are applied as for NewSession, so per-prompt
+// options of Run (WithModelRouter, WithRateLimitRetry,
+// WithModelFallbackChain) and session continuation (WithResume, WithContinue)
+// have no useful effect.
+func NewWarmPool(size int, opts ...Option) (*WarmPool, error) {
+	if size < 1 {
+		size = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &WarmPool{opts: opts, ctx: ctx, cancel: cancel, idle: make(chan *Stream, size)}
+	p.resolved = p.options()
+	for range size {
+		stream, err := p.spawn()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.idle <- stream
+	}
+	return p, nil
+}
+
+// options applies the pool's options to a fresh Options.
+func (p *WarmPool) options() *Options {
+	o := defaultOptions()
+	for _, opt := range p.opts {
+		opt(o)
+	}
+	return o
+}
+
+// spawn starts one pool member.
+func (p *WarmPool) spawn() (*Stream, error) {
+	return spawnSession(p.ctx, p.options())
+}
+
+// replenish starts a replacement member in the background.
+func (p *WarmPool) replenish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		stream, err := p.spawn()
+		if err != nil {
+			return
+		}
+		select {
+		case p.idle <- stream:
+		default:
+			_ = stream.Close()
+		}
+	}()
+}
+
+// take returns a live idle member, or a freshly spawned one when none is idle.
+func (p *WarmPool) take() (*Stream, error) {
+	for {
+		if p.ctx.Err() != nil {
+			return nil, ErrPoolClosed
+		}
+		select {
+		case stream := <-p.idle:
+			p.replenish()
+			if stream.exited() || stream.closeRequested() {
+				continue
+			}
+			return stream, nil
+		default:
+			return p.spawn()
+		}
+	}
+}
+
+// Run sends prompt to a warm subprocess and returns the final Result, like the
+// package-level Run. Cancelling ctx interrupts the run.
+func (p *WarmPool) Run(ctx context.Context, prompt string) (*Result, error) {
+	stream, err := p.take()
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	stop := context.AfterFunc(ctx, stream.interrupt)
+	defer stop()
+
+	if err := stream.SendUserMessage(prompt); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	result, err := awaitResult(stream)
+	if ctx.Err() != nil && err != nil {
+		return nil, ctx.Err()
+	}
+	if o := p.resolved; err == nil && o.ValidateOutput && o.structuredOutput() {
+		return result, o.OutputFormat.Validate(result.StructuredOutput)
+	}
+	return result, err
+}
+
+// Close stops the idle subprocesses. Runs in progress are interrupted. Close
+// is idempotent.
+func (p *WarmPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	p.cancel()
+	p.wg.Wait()
+	for {
+		select {
+		case stream := <-p.idle:
+			_ = stream.Close()
+		default:
+			return nil
+		}
+	}
+}
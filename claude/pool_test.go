@@ -0,0 +1,70 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestWarmPool(t *testing.T) {
+	// Each subprocess answers prompts with its PID.
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo "{\"type\":\"result\",\"subtype\":\"success\",\"result\":\"$$\"}" ;;
+  esac
+done
+`)
+	pool, err := NewWarmPool(2, WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("NewWarmPool: %v", err)
+	}
+	defer pool.Close()
+
+	// A member that died while idle is replaced rather than handed out.
+	dead := <-pool.idle
+	_ = dead.Interrupt()
+	<-dead.done
+	pool.idle <- dead
+
+	seen := map[string]bool{}
+	for i := range 3 {
+		result, err := pool.Run(context.Background(), fmt.Sprintf("prompt %d", i))
+		if err != nil {
+			t.Fatalf("Run %d: %v", i, err)
+		}
+		if seen[result.Result] {
+			t.Fatalf("subprocess %s served more than one Run", result.Result)
+		}
+		seen[result.Result] = true
+	}
+
+	if err := pool.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if _, err := pool.Run(context.Background(), "late"); !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("expected ErrPoolClosed after Close, got %v", err)
+	}
+}
+
+func TestWarmPool_RunContextCancel(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*) sleep 10 ;;
+  esac
+done
+`)
+	pool, err := NewWarmPool(1, WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("NewWarmPool: %v", err)
+	}
+	defer pool.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := pool.Run(ctx, "hi"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the run's deadline error, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package claude
+
+import (
+	"maps"
+	"strings"
+)
+
+// ModelPricing holds a model's per-token rates in USD per million tokens, and
+// the per-request rate for server-side web searches.
+type ModelPricing struct {
+	InputPerMTok      float64
+	OutputPerMTok     float64
+	CacheReadPerMTok  float64
+	CacheWritePerMTok float64
+	WebSearchPerCall  float64
+}
+
+// Pricing maps model IDs to their rates. A key also matches any model ID it
+// prefixes, so "claude-sonnet-4-5" prices "claude-sonnet-4-5-20250929"; the
+// longest matching key wins.
+type Pricing map[string]ModelPricing
+
+// DefaultPricing holds Anthropic's list prices. They may lag behind price
+// changes; use WithPricing or your own Pricing for billing-grade figures.
+var DefaultPricing = Pricing{
+	"claude-opus-4-6":   {InputPerMTok: 5, OutputPerMTok: 25, CacheReadPerMTok: 0.5, CacheWritePerMTok: 6.25, WebSearchPerCall: 0.01},
+	"claude-opus-4-5":   {InputPerMTok: 5, OutputPerMTok: 25, CacheReadPerMTok: 0.5, CacheWritePerMTok: 6.25, WebSearchPerCall: 0.01},
+	"claude-opus-4":     {InputPerMTok: 15, OutputPerMTok: 75, CacheReadPerMTok: 1.5, CacheWritePerMTok: 18.75, WebSearchPerCall: 0.01},
+	"claude-sonnet-4":   {InputPerMTok: 3, OutputPerMTok: 15, CacheReadPerMTok: 0.3, CacheWritePerMTok: 3.75, WebSearchPerCall: 0.01},
+	"claude-haiku-4-5":  {InputPerMTok: 1, OutputPerMTok: 5, CacheReadPerMTok: 0.1, CacheWritePerMTok: 1.25, WebSearchPerCall: 0.01},
+	"claude-3-5-haiku":  {InputPerMTok: 0.8, OutputPerMTok: 4, CacheReadPerMTok: 0.08, CacheWritePerMTok: 1, WebSearchPerCall: 0.01},
+	"claude-3-7-sonnet": {InputPerMTok: 3, OutputPerMTok: 15, CacheReadPerMTok: 0.3, CacheWritePerMTok: 3.75, WebSearchPerCall: 0.01},
+}
+
+// Lookup returns the rates for model, matching keys by longest prefix.
+func (p Pricing) Lookup(model string) (ModelPricing, bool) {
+	var best string
+	found := false
+	for key := range p {
+		if strings.HasPrefix(model, key) && (!found || len(key) > len(best)) {
+			best, found = key, true
+		}
+	}
+	return p[best], found
+}
+
+// EstimateCost returns the cost in USD of u at model's rates, or 0 when the
+// model is not in p.
+func (p Pricing) EstimateCost(model string, u Usage) float64 {
+	rates, ok := p.Lookup(model)
+	if !ok {
+		return 0
+	}
+	return (float64(u.InputTokens)*rates.InputPerMTok+
+		float64(u.OutputTokens)*rates.OutputPerMTok+
+		float64(u.CacheReadInputTokens)*rates.CacheReadPerMTok+
+		float64(u.CacheCreationInputTokens)*rates.CacheWritePerMTok)/1e6 +
+		float64(u.WebSearchRequests)*rates.WebSearchPerCall
+}
+
+// EstimateCost returns the cost in USD of u at model's list price from
+// DefaultPricing, or 0 when the model is unknown.
+func EstimateCost(model string, u Usage) float64 {
+	return DefaultPricing.EstimateCost(model, u)
+}
+
+// resultCost prices r: per model from ModelUsages when the CLI reported them,
+// otherwise r.Usage at model's rates.
+func (p Pricing) resultCost(r *Result, model string) float64 {
+	if len(r.ModelUsages) == 0 {
+		return p.EstimateCost(model, r.Usage)
+	}
+	var total float64
+	for m, mu := range r.ModelUsages {
+		total += p.EstimateCost(m, Usage{
+			InputTokens:              mu.InputTokens,
+			OutputTokens:             mu.OutputTokens,
+			CacheReadInputTokens:     mu.CacheReadInputTokens,
+			CacheCreationInputTokens: mu.CacheCreationInputTokens,
+		})
+	}
+	return total
+}
+
+// mergePricing returns DefaultPricing with overrides applied on top.
+func mergePricing(overrides map[string]ModelPricing) Pricing {
+	p := maps.Clone(DefaultPricing)
+	maps.Copy(p, overrides)
+	return p
+}
@@ -0,0 +1,44 @@
+package claude
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func TestEstimateCost(t *testing.T) {
+	u := Usage{InputTokens: 1_000_000, OutputTokens: 100_000, CacheReadInputTokens: 2_000_000, WebSearchRequests: 3}
+	// 3 + 1.5 + 0.6 + 0.03
+	if got := EstimateCost("claude-sonnet-4-5-20250929", u); math.Abs(got-5.13) > 1e-9 {
+		t.Fatalf("unexpected cost %v", got)
+	}
+	if got := EstimateCost("unknown-model", u); got != 0 {
+		t.Fatalf("expected 0 for an unknown model, got %v", got)
+	}
+	if p, _ := DefaultPricing.Lookup("claude-opus-4-5-20251101"); p.InputPerMTok != 5 {
+		t.Fatalf("expected the longest prefix to win, got %+v", p)
+	}
+}
+
+func TestWithPricing_EstimatedCost(t *testing.T) {
+	exe := writeFakeCLI(t, `echo '{"type":"system","subtype":"init","session_id":"s1","model":"claude-sonnet-4-6"}'
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"ok","total_cost_usd":0.018,"usage":{"input_tokens":1000,"output_tokens":1000}}'
+      exit 0 ;;
+  esac
+done
+`)
+	result, err := Run(context.Background(), "hi", WithClaudeExecutable(exe),
+		WithPricing(map[string]ModelPricing{"claude-sonnet-4-6": {InputPerMTok: 2, OutputPerMTok: 10}}))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if math.Abs(result.EstimatedCostUSD-0.012) > 1e-9 {
+		t.Fatalf("expected estimated cost 0.012, got %v", result.EstimatedCostUSD)
+	}
+	if result.TotalCostUSD != 0.018 {
+		t.Fatalf("expected CLI cost to be kept, got %v", result.TotalCostUSD)
+	}
+}
@@ -6,10 +6,13 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -32,15 +35,65 @@ type controlResponse struct {
 //
 // Graceful shutdown (mirrors TS SDK close() behaviour):
 //   - On ctx cancellation or Stream.Interrupt(): stdin is closed, SIGTERM is sent.
-//   - If the process has not exited after 5 s: SIGKILL is sent.
+//   - If the process has not exited after opts.ShutdownTimeout (5 s by
+//     default): SIGKILL is sent.
+//   - On Unix the subprocess runs in its own process group and both signals go
+//     to the whole group, so MCP stdio servers and Bash commands it spawned
+//     are stopped too.
 //
 // The Stream.Events() channel is closed when a TypeResult message is received,
 // the subprocess exits, or ctx is cancelled. Callers should always range until
 // the channel closes.
 func spawnAndStream(ctx context.Context, opts *Options, prompt string) (*Stream, error) {
-	args := opts.buildArgs()
+	if opts.Sandbox != nil {
+		if err := opts.Sandbox.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkPermissionPromptTool(opts); err != nil {
+		return nil, err
+	}
+	if err := checkResponsePrefill(opts); err != nil {
+		return nil, err
+	}
+	if err := checkInitialPermissionRules(opts); err != nil {
+		return nil, err
+	}
+	if !opts.sessionMode {
+		if err := checkInputTokens(opts, prompt); err != nil {
+			return nil, err
+		}
+	}
+	if opts.DryRun {
+		return nil, dryRun(opts, prompt)
+	}
+	var authWarning string
+	if opts.RequireAuth {
+		if err := checkAuth(buildEnv(opts)); err != nil {
+			if !keychainLogin {
+				return nil, err
+			}
+			authWarning = keychainAuthWarning
+		}
+	}
+	executable, prefix, err := resolveCommand(opts)
+	if err != nil {
+		return nil, err
+	}
+	opts, memory, err := withMemory(opts)
+	if err != nil {
+		return nil, err
+	}
+	spawned := false // set once the delivery goroutine owns memory
+	defer func() {
+		if !spawned {
+			memory.release()
+		}
+	}()
+	opts, mcpBinding := withMCPRun(opts)
+	args := append(prefix, opts.buildArgs()...)
 
-	cmd := exec.Command(opts.ClaudeExecutable, args...)
+	cmd := exec.Command(executable, args...)
 	cmd.Env = buildEnv(opts)
 	if opts.CWD != "" {
 		cmd.Dir = opts.CWD
@@ -65,9 +118,16 @@ func spawnAndStream(ctx context.Context, opts *Options, prompt string) (*Stream,
 		cmd.Stderr = &stderrBuf
 	}
 
+	setProcessGroup(cmd)
+	if opts.CmdConfigurer != nil {
+		opts.CmdConfigurer(cmd)
+	}
+
+	started := time.Now()
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("claude: start %q: %w", opts.ClaudeExecutable, err)
 	}
+	mcpBinding.bind(ctx)
 
 	// write serialises v as a JSON line and sends it to stdin.
 	// It is safe to call from multiple goroutines.
@@ -85,35 +145,64 @@ func spawnAndStream(ctx context.Context, opts *Options, prompt string) (*Stream,
 	}
 
 	// Build hooks config and registry from options.
-	hooksConfig, hookReg := buildHooksForInitialize(opts.Hooks)
+	hooksConfig, hookReg := buildHooksForInitialize(sdkHooks(opts))
 
 	// Send the initialize message. System prompt, MCP servers, agents, and hooks
 	// are passed here (not as CLI flags) so they work in bidirectional mode.
 	if err := write(initializeMsg(opts, hooksConfig)); err != nil {
-		_ = cmd.Process.Kill()
-		return nil, fmt.Errorf("claude: initialize: %w", err)
+		err = startupWriteError(cmd, &stderrBuf, fmt.Errorf("claude: initialize: %w", err))
+		mcpBinding.release()
+		return nil, err
+	}
+
+	requestID := opts.RequestID
+	if requestID == "" {
+		requestID = newUUID()
+	}
+
+	// Start the root span before the first turn (no-op without a Tracer).
+	tracer := newRunTracer(ctx, opts.Tracer, requestID, opts.Model)
+	metrics := newRunMetrics(opts.Metrics, started)
+	toolTimes := toolTimer{}
+	var turns *turnTracker
+	if opts.TurnMarkers {
+		turns = &turnTracker{}
 	}
 
 	// Send the user message (the prompt), unless we're in session mode
 	// (the caller will send the first message via Session.Send).
 	if !opts.sessionMode && prompt != "" {
-		if err := write(userMsg(prompt)); err != nil {
-			_ = cmd.Process.Kill()
-			return nil, fmt.Errorf("claude: user message: %w", err)
+		tracer.startTurn()
+		if err := writeUserTurn(write, prompt, opts.responsePrefill(), opts.knownSessionID()); err != nil {
+			err = startupWriteError(cmd, &stderrBuf, fmt.Errorf("claude: user message: %w", err))
+			tracer.end(err)
+			mcpBinding.release()
+			return nil, err
 		}
 	}
 
-	// Create the Stream struct. The goroutines below close over it.
-	stream := &Stream{
-		events:  make(chan Event, 32),
-		write:   write,
-		ctx:     ctx,
-		pending: make(map[string]chan controlResponse),
-	}
+	// procDone is closed by the reader goroutine after cmd.Wait() returns.
+	procDone := make(chan struct{})
 
 	// interruptOnce / interruptCh enable Stream.Interrupt() to trigger graceful shutdown.
 	var interruptOnce sync.Once
 	interruptCh := make(chan struct{})
+
+	// Create the Stream struct. The goroutines below close over it.
+	stream := &Stream{
+		events:      make(chan Event, opts.EventBufferSize),
+		write:       write,
+		ctx:         ctx,
+		requestID:   requestID,
+		prefill:     opts.responsePrefill(),
+		seedID:      opts.knownSessionID(),
+		pending:     make(map[string]chan controlResponse),
+		done:        procDone,
+		interruptCh: interruptCh,
+		tracer:      tracer,
+		initCh:      make(chan struct{}),
+		softStopCh:  make(chan struct{}),
+	}
 	stream.interrupt = func() {
 		interruptOnce.Do(func() { close(interruptCh) })
 	}
@@ -125,13 +214,26 @@ func spawnAndStream(ctx context.Context, opts *Options, prompt string) (*Stream,
 		stdin.Close()
 	}
 
-	// procDone is closed by the reader goroutine after cmd.Wait() returns.
-	procDone := make(chan struct{})
+	var softStopOnce sync.Once
+	stream.softStop = func() {
+		softStopOnce.Do(func() {
+			close(stream.softStopCh)
+			closeStdin()
+		})
+	}
+
+	if len(opts.InterruptSignals) > 0 {
+		watchSignals(opts.InterruptSignals, stream, cmd.Process, procDone)
+	}
 
 	// Graceful shutdown goroutine — mirrors TypeScript SDK close():
 	//   this.processStdin.end()
 	//   this.process.kill("SIGTERM")
 	//   setTimeout(() => this.process.kill("SIGKILL"), 5000)
+	shutdownTimeout := opts.ShutdownTimeout
+	if shutdownTimeout <= 0 {
+		shutdownTimeout = DefaultShutdownTimeout
+	}
 	go func() {
 		select {
 		case <-ctx.Done():
@@ -141,34 +243,48 @@ func spawnAndStream(ctx context.Context, opts *Options, prompt string) (*Stream,
 			return
 		}
 		closeStdin()
-		_ = cmd.Process.Signal(syscall.SIGTERM)
+		signalProcessGroup(cmd.Process, syscall.SIGTERM)
 		select {
-		case <-time.After(5 * time.Second):
-			_ = cmd.Process.Kill()
+		case <-time.After(shutdownTimeout):
+			signalProcessGroup(cmd.Process, syscall.SIGKILL)
 		case <-procDone:
 		}
 	}()
 
-	// Reader goroutine: reads stdout line by line, handles control messages from
-	// claude, and forwards all other events to stream.events.
+	// Reader goroutine: reads stdout line by line and handles control messages
+	// from claude as soon as they arrive. All other events are queued for the
+	// delivery goroutine below, so a consumer that is slow to read Events()
+	// never delays permission prompts, hook callbacks, or control responses.
+	queue := newEventQueue()
+	var watchdog *toolWatchdog
+	if opts.ToolTimeout > 0 {
+		watchdog = newToolWatchdog(stream, opts.ToolTimeout)
+	}
+	readerDone := make(chan struct{})
+	var scanErr error
 	go func() {
-		defer close(stream.events)
-		defer close(procDone)
+		defer close(readerDone)
+		defer queue.close()
 
 		scanner := bufio.NewScanner(stdout)
-		// 4 MB buffer — assistant messages with long content can be large.
-		scanner.Buffer(make([]byte, 4*1024*1024), 4*1024*1024)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
 
-		gotResult := false
 		for scanner.Scan() {
 			line := scanner.Bytes()
 			if len(line) == 0 {
 				continue
 			}
+			if opts.RawEventHook != nil {
+				opts.RawEventHook(line)
+			}
 
 			// Peek at the message type for fast routing.
 			var typeCheck struct {
-				Type string `json:"type"`
+				Type    string `json:"type"`
+				Request struct {
+					Subtype   string `json:"subtype"`
+					ToolUseID string `json:"tool_use_id"`
+				} `json:"request"`
 			}
 			if err := json.Unmarshal(line, &typeCheck); err != nil {
 				continue // skip non-JSON lines
@@ -178,13 +294,26 @@ func spawnAndStream(ctx context.Context, opts *Options, prompt string) (*Stream,
 			case "control_request":
 				// control_request messages (can_use_tool, hook_callback, etc.) require
 				// a response on stdin and must not be forwarded to the caller.
+				endSpan := tracer.controlRequest(line)
+				// Time spent deciding whether a tool may run does not count
+				// against WithToolTimeout.
+				held := watchdog != nil && typeCheck.Request.Subtype == "can_use_tool"
+				if held {
+					watchdog.hold(typeCheck.Request.ToolUseID)
+				}
 				handleControlRequest(line, write, opts, hookReg)
+				if held {
+					watchdog.release(typeCheck.Request.ToolUseID)
+				}
+				endSpan()
 				continue
 
 			case "control_response":
 				// control_response messages are replies to our set_model /
 				// set_permission_mode / etc. requests. Route to the pending map.
-				routeControlResponse(line, stream)
+				if w := routeControlResponse(line, stream); w != "" {
+					queue.push(warningEvent(w))
+				}
 				continue
 			}
 
@@ -192,13 +321,152 @@ func spawnAndStream(ctx context.Context, opts *Options, prompt string) (*Stream,
 			if err != nil {
 				continue // skip malformed lines
 			}
+			queue.push(event)
+		}
+		scanErr = scanner.Err()
+	}()
+
+	// Delivery goroutine: observes each queued event and forwards it to
+	// stream.events, blocking while the consumer is behind. It owns memory
+	// from here on.
+	spawned = true
+	go func() {
+		defer close(stream.events)
+		defer close(procDone)
+		defer stream.closePartial()
+		defer stream.closeThinking()
+		defer mcpBinding.release()
+		defer memory.release()
+		if watchdog != nil {
+			defer watchdog.stop()
+		}
+
+		// runErr is why the stream ended abnormally; nil for a clean end.
+		var runErr error
+		gotResult := false
+		defer func() {
+			if reason := stream.InterruptReason(); reason != "" && runErr == nil && !gotResult {
+				runErr = &InterruptedError{Reason: reason}
+			}
+			stream.setErr(runErr)
+			tracer.end(runErr)
+			metrics.end(runErr)
+		}()
+
+		for {
+			event, ok := queue.pop()
+			if !ok {
+				break
+			}
+			stream.recordSessionID(event)
+			if event.Type == TypeResult {
+				stream.endTurn()
+				// The Stop hook has usually saved already; this makes sure the
+				// memory is saved before the caller sees the result.
+				memory.commit()
+			}
+			if event.Result != nil {
+				event.Result.Model = opts.Model
+				if stream.initMsg != nil {
+					event.Result.Model = stream.initMsg.Model
+				}
+				if opts.Pricing != nil {
+					event.Result.EstimatedCostUSD = opts.Pricing.resultCost(event.Result, event.Result.Model)
+				}
+			}
+			toolTimes.observe(event)
+			if watchdog != nil {
+				watchdog.observe(event)
+			}
+			stream.attachCompactMetadata(&event)
+			if opts.AutoCompactTokens > 0 {
+				stream.observeCompaction(event, opts.AutoCompactSummarizer != nil)
+			}
+			if p := stream.partial.Load(); p != nil {
+				p.observe(event)
+			}
+			if t := stream.thinking.Load(); t != nil {
+				t.observe(event)
+			}
+			observeTools(event, opts)
+			tracer.observe(event)
+			metrics.observe(event)
+			if opts.ContentFilter != nil {
+				filterContent(&event, opts.ContentFilter)
+			}
+			if keep, err := limitMessageSize(&event, opts); err != nil {
+				runErr = err
+				stream.interrupt()
+				break
+			} else if !keep {
+				continue
+			}
+			firstInit := event.System != nil && event.System.Subtype == SubtypeInit &&
+				stream.recordInit(event.System)
+			event.CorrelationID = stream.correlate(event)
+			if event.Result != nil && opts.ResultTransform != nil && !opts.sessionMode {
+				if err := opts.ResultTransform(event.Result); err != nil {
+					runErr = &resultTransformError{err: err}
+					gotResult = true
+					closeStdin()
+					break
+				}
+			}
+			if event.Result != nil && opts.OnResult != nil {
+				opts.OnResult(event.Result)
+			}
+			if event.Result != nil && !event.Result.IsError && opts.OnSuccess != nil {
+				opts.OnSuccess(event.Result)
+			}
+			if event.Result != nil && event.Result.IsError && opts.OnError != nil {
+				opts.OnError(event.Result)
+			}
+			if event.Result != nil && opts.ResultSink != nil {
+				if err := opts.ResultSink(event.Result); err != nil {
+					sendEvent(ctx, stream.events, warningEvent(err.Error()))
+				}
+			}
+			if id := event.ParentToolUseID(); id != "" && opts.AgentEventHandler != nil {
+				opts.AgentEventHandler(id, event)
+			}
+			if turns != nil {
+				for _, m := range turns.markers(event) {
+					m.CorrelationID = event.CorrelationID
+					sendEvent(ctx, stream.events, m)
+				}
+			}
 
 			select {
 			case stream.events <- event:
 			case <-ctx.Done():
+				runErr = ctx.Err()
 				return
 			}
 
+			if opts.CancelOnError && isErrorEvent(event) {
+				// Graceful shutdown: stdin closed, SIGTERM, SIGKILL after shutdownTimeout.
+				stream.interrupt()
+			}
+
+			if firstInit {
+				warnings := initWarnings(opts, event.System)
+				if len(prefix) > 0 {
+					warnings = append([]string{fmt.Sprintf("%q not found; running the CLI via npx %s", opts.ClaudeExecutable, npxPackage)}, warnings...)
+				}
+				if authWarning != "" {
+					warnings = append([]string{authWarning}, warnings...)
+				}
+				for _, w := range warnings {
+					sendEvent(ctx, stream.events, warningEvent(w))
+				}
+				if unknown := unknownTools(opts, event.System.Tools); opts.StrictToolNames && len(unknown) > 0 {
+					msg := "unknown tools: " + strings.Join(unknown, ", ")
+					runErr = errors.New("claude: " + msg)
+					sendEvent(ctx, stream.events, errorEvent(msg))
+					stream.interrupt()
+				}
+			}
+
 			if event.Type == TypeResult {
 				if opts.sessionMode {
 					// Emit TypeResult to signal "turn done" but keep stdin open
@@ -212,26 +480,32 @@ func spawnAndStream(ctx context.Context, opts *Options, prompt string) (*Stream,
 			}
 		}
 
-		if err := scanner.Err(); err != nil {
-			sendEvent(ctx, stream.events, errorEvent(fmt.Sprintf("stdout read error: %v", err)))
+		if gotResult {
+			// The CLI exits once stdin is closed. Reap it without waiting for
+			// stdout EOF, which a lingering grandchild holding the pipe could
+			// delay; Wait closes the pipe, ending the reader.
+			stream.exitErr = cmd.Wait()
+			<-readerDone
+			return
+		}
+		<-readerDone
+		if scanErr != nil {
+			runErr = fmt.Errorf("claude: stdout read: %w", scanErr)
+			sendEvent(ctx, stream.events, errorEvent(fmt.Sprintf("stdout read error: %v", scanErr)))
 		}
 
 		// Surface stderr on unexpected exit (bad flag, auth error, crash, etc.).
-		if err := cmd.Wait(); err != nil && !gotResult {
-			// In session mode suppress the error when Close()/Interrupt() was called
-			// (expected shutdown) or the context was cancelled.
-			interrupted := false
-			select {
-			case <-interruptCh:
-				interrupted = true
-			default:
-			}
-			if !interrupted && ctx.Err() == nil {
-				stderr := strings.TrimSpace(stderrBuf.String())
-				msg := err.Error()
-				if stderr != "" {
-					msg = stderr
-				}
+		err := cmd.Wait()
+		stream.exitErr = err
+		if err != nil && !gotResult && runErr == nil {
+			// In session mode suppress the error when Close()/Interrupt()/SoftStop()
+			// was called (expected shutdown) or the context was cancelled.
+			switch {
+			case ctx.Err() != nil:
+				runErr = ctx.Err()
+			case !stream.closeRequested():
+				var msg string
+				runErr, msg = processError(err, &stderrBuf)
 				sendEvent(ctx, stream.events, errorEvent(msg))
 			}
 		}
@@ -240,6 +514,57 @@ func spawnAndStream(ctx context.Context, opts *Options, prompt string) (*Stream,
 	return stream, nil
 }
 
+// startupExitWait is how long a CLI whose stdin broke during startup has to
+// exit before it is killed.
+const startupExitWait = 2 * time.Second
+
+// startupWriteError handles a failed write of the initialize request or the
+// prompt. The write usually fails because the CLI exited without reading
+// stdin, e.g. a version that rejects a flag, so the process is given
+// startupExitWait to exit and the *ProcessError describing its exit is
+// returned. writeErr is returned when it exits cleanly or has to be killed.
+func startupWriteError(cmd *exec.Cmd, stderrBuf *bytes.Buffer, writeErr error) error {
+	waited := make(chan error, 1)
+	go func() { waited <- cmd.Wait() }()
+	var err error
+	select {
+	case err = <-waited:
+	case <-time.After(startupExitWait):
+		signalProcessGroup(cmd.Process, syscall.SIGKILL)
+		<-waited
+		return writeErr
+	}
+	// Stop anything the CLI left running in its group.
+	signalProcessGroup(cmd.Process, syscall.SIGKILL)
+	if err == nil {
+		return writeErr
+	}
+	procErr, _ := processError(err, stderrBuf)
+	return procErr
+}
+
+// processError builds the error for a subprocess that exited with err: a
+// *ProcessError carrying its stderr, wrapped in an *AuthRequiredError when
+// stderr reports missing credentials. msg is the text for the error event.
+func processError(err error, stderrBuf *bytes.Buffer) (_ error, msg string) {
+	stderr := strings.TrimSpace(stderrBuf.String())
+	msg = err.Error()
+	if stderr != "" {
+		msg = stderr
+	}
+	exitCode := -1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+	procErr := &ProcessError{ExitCode: exitCode, Stderr: stderr, Message: err.Error()}
+	if authErr := authError(msg); authErr != nil {
+		authErr.Err = procErr
+		return authErr, msg
+	}
+	return procErr, msg
+}
+
 // handleControlRequest inspects a raw JSON line from claude's stdout to see if
 // it is a control_request. If so it writes the appropriate control_response to
 // stdin. Returns false and does nothing for non-control_request messages.
@@ -263,6 +588,10 @@ func handleControlRequest(line []byte, write func(any) error, opts *Options, hoo
 			CallbackID string    `json:"callback_id,omitempty"`
 			HookEvent  HookEvent `json:"hook_event,omitempty"`
 
+			// mcp_message fields
+			ServerName string          `json:"server_name,omitempty"`
+			Message    json.RawMessage `json:"message,omitempty"`
+
 			// set_model / set_permission_mode / set_max_thinking_tokens
 			Model             string `json:"model,omitempty"`
 			PermissionMode    string `json:"permission_mode,omitempty"`
@@ -286,29 +615,12 @@ func handleControlRequest(line []byte, write func(any) error, opts *Options, hoo
 			}
 			result = opts.PermissionHandler(envelope.Request.ToolName, envelope.Request.Input, permCtx)
 		}
-		allowed := result.Behavior != "deny"
-		resp := map[string]any{
-			"allowed":   allowed,
-			"toolUseID": envelope.Request.ToolUseID,
-		}
-		if result.UpdatedInput != nil {
-			resp["updatedInput"] = result.UpdatedInput
-		}
-		if len(result.UpdatedPermissions) > 0 {
-			resp["updatedPermissions"] = result.UpdatedPermissions
-		}
-		if result.Message != "" {
-			resp["message"] = result.Message
-		}
-		if result.Interrupt {
-			resp["interrupt"] = true
-		}
 		_ = write(map[string]any{
 			"type": "control_response",
 			"response": map[string]any{
 				"subtype":    "success",
 				"request_id": envelope.RequestID,
-				"response":   resp,
+				"response":   permissionResponse(result, envelope.Request.ToolUseID),
 			},
 		})
 
@@ -358,8 +670,28 @@ func handleControlRequest(line []byte, write func(any) error, opts *Options, hoo
 			},
 		})
 
+	case "mcp_message":
+		// Messages for an in-memory server are relayed to it, off the reader
+		// goroutine so that slow or parallel tool calls don't stall the stream.
+		if srv, ok := opts.McpServers[envelope.Request.ServerName].(McpSdkServer); ok && srv.bridge != nil {
+			go relayMCPMessage(srv.bridge, envelope.RequestID, envelope.Request.Message, write)
+			return
+		}
+		// Other MCP servers push notifications (progress, logging) through the
+		// CLI. Surface them to the handler, then acknowledge like any notification.
+		if opts.MCPNotificationHandler != nil {
+			opts.MCPNotificationHandler(envelope.Request.ServerName, envelope.Request.Message)
+		}
+		_ = write(map[string]any{
+			"type": "control_response",
+			"response": map[string]any{
+				"subtype":    "success",
+				"request_id": envelope.RequestID,
+			},
+		})
+
 	default:
-		// set_model, set_permission_mode, set_max_thinking_tokens, mcp_message:
+		// set_model, set_permission_mode, set_max_thinking_tokens:
 		// These are read-only notifications from the CLI. Acknowledge silently.
 		_ = write(map[string]any{
 			"type": "control_response",
@@ -371,27 +703,81 @@ func handleControlRequest(line []byte, write func(any) error, opts *Options, hoo
 	}
 }
 
+// permissionResponse is the body of the control_response answering a
+// can_use_tool request with result.
+func permissionResponse(result PermissionResult, toolUseID string) map[string]any {
+	resp := map[string]any{
+		"allowed":   result.Behavior != "deny",
+		"toolUseID": toolUseID,
+	}
+	if result.UpdatedInput != nil {
+		resp["updatedInput"] = result.UpdatedInput
+	}
+	if len(result.UpdatedPermissions) > 0 {
+		resp["updatedPermissions"] = result.UpdatedPermissions
+	}
+	if result.Message != "" {
+		resp["message"] = result.Message
+	}
+	if result.Interrupt {
+		resp["interrupt"] = true
+	}
+	return resp
+}
+
+// relayMCPMessage passes an mcp_message to an in-memory MCP server and
+// answers the control request with the server's JSON-RPC response, or with an
+// error after DefaultMCPCallTimeout.
+func relayMCPMessage(b *mcpBridge, requestID string, msg json.RawMessage, write func(any) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultMCPCallTimeout)
+	defer cancel()
+	resp, err := b.call(ctx, msg)
+	if err != nil {
+		_ = write(map[string]any{
+			"type": "control_response",
+			"response": map[string]any{
+				"subtype":    "error",
+				"request_id": requestID,
+				"error":      err.Error(),
+			},
+		})
+		return
+	}
+	if resp == nil {
+		// Notifications have no response; the CLI still expects a JSON-RPC body.
+		resp = json.RawMessage(`{"jsonrpc":"2.0","result":{}}`)
+	}
+	_ = write(map[string]any{
+		"type": "control_response",
+		"response": map[string]any{
+			"subtype":    "success",
+			"request_id": requestID,
+			"response":   map[string]any{"mcp_response": resp},
+		},
+	})
+}
+
 // routeControlResponse routes a control_response message (a reply from claude to
 // one of our set_model / set_permission_mode / etc. requests) to the waiting caller.
-func routeControlResponse(line []byte, s *Stream) {
+// An error reply that no caller is waiting for, such as the CLI rejecting the
+// initialize request or answering after its caller gave up, is returned as a
+// warning message instead; other unmatched replies return "".
+func routeControlResponse(line []byte, s *Stream) string {
 	var envelope struct {
 		Type      string          `json:"type"`
 		RequestID string          `json:"request_id"`
 		Response  json.RawMessage `json:"response"`
 	}
 	if err := json.Unmarshal(line, &envelope); err != nil {
-		return
-	}
-
-	reqID := envelope.RequestID
-	if reqID == "" {
-		return
+		return ""
 	}
 
-	// Extract subtype and error from the response body.
+	// Extract subtype and error from the response body. The CLI may put the
+	// request ID there rather than in the envelope.
 	var respMeta struct {
-		Subtype string `json:"subtype"`
-		Error   string `json:"error,omitempty"`
+		Subtype   string `json:"subtype"`
+		RequestID string `json:"request_id,omitempty"`
+		Error     string `json:"error,omitempty"`
 	}
 	if err := json.Unmarshal(envelope.Response, &respMeta); err != nil {
 		// Treat unparseable response as an error so callers don't
@@ -400,6 +786,11 @@ func routeControlResponse(line []byte, s *Stream) {
 		respMeta.Error = fmt.Sprintf("malformed control_response: %v", err)
 	}
 
+	reqID := envelope.RequestID
+	if reqID == "" {
+		reqID = respMeta.RequestID
+	}
+
 	s.pendingMu.Lock()
 	ch, ok := s.pending[reqID]
 	if ok {
@@ -416,7 +807,15 @@ func routeControlResponse(line []byte, s *Stream) {
 		}:
 		default:
 		}
+		return ""
+	}
+	if respMeta.Subtype != "error" {
+		return ""
 	}
+	if reqID == "" {
+		return "the CLI rejected a control request: " + respMeta.Error
+	}
+	return fmt.Sprintf("the CLI rejected control request %s: %s", reqID, respMeta.Error)
 }
 
 // ─── Stdin message helpers ────────────────────────────────────────────────────
@@ -466,6 +865,18 @@ func initializeMsg(opts *Options, hooksConfig map[string]any) any {
 		req["sandbox"] = opts.Sandbox
 	}
 
+	if len(opts.Skills) > 0 {
+		req["skills"] = opts.Skills
+	}
+
+	if opts.ModelParameters != nil {
+		req["modelParameters"] = opts.ModelParameters
+	}
+
+	if opts.Title != "" {
+		req["title"] = opts.Title
+	}
+
 	return map[string]any{
 		"type":       "control_request",
 		"request_id": newUUID(),
@@ -473,8 +884,9 @@ func initializeMsg(opts *Options, hooksConfig map[string]any) any {
 	}
 }
 
-// userMsg builds the user message sent to stdin.
-func userMsg(prompt string) any {
+// userMsg builds the user message sent to stdin, stamped with the active
+// session ID ("" before one is known).
+func userMsg(prompt, sessionID string) any {
 	return map[string]any{
 		"type": "user",
 		"message": map[string]any{
@@ -482,8 +894,34 @@ func userMsg(prompt string) any {
 			"content": prompt,
 		},
 		"parent_tool_use_id": nil,
-		"session_id":         "",
+		"session_id":         sessionID,
+	}
+}
+
+// prefillMsg builds the partial assistant message used by WithResponsePrefill.
+func prefillMsg(text, sessionID string) any {
+	return map[string]any{
+		"type": "assistant",
+		"message": map[string]any{
+			"role": "assistant",
+			"content": []map[string]any{
+				{"type": "text", "text": text},
+			},
+		},
+		"parent_tool_use_id": nil,
+		"session_id":         sessionID,
+	}
+}
+
+// writeUserTurn writes a user message, followed by the prefill when non-empty.
+func writeUserTurn(write func(any) error, prompt, prefill, sessionID string) error {
+	if err := write(userMsg(prompt, sessionID)); err != nil {
+		return err
 	}
+	if prefill != "" {
+		return write(prefillMsg(prefill, sessionID))
+	}
+	return nil
 }
 
 // ─── Stderr line writer ───────────────────────────────────────────────────────
@@ -516,9 +954,13 @@ func (w *stderrLineWriter) Write(p []byte) (int, error) {
 //   - Strips CLAUDECODE so the subprocess can launch even inside an existing session
 //     (mirrors `delete process.env.CLAUDECODE` in agent.ts).
 //   - Strips CLAUDE_CODE_ENTRYPOINT so we can set our own.
-//   - Sets CLAUDE_CODE_ENTRYPOINT=sdk-go for Anthropic telemetry.
+//   - Sets CLAUDE_CODE_ENTRYPOINT to opts.Entrypoint (default sdk-go) for Anthropic telemetry.
+//   - Sets CLAUDE_AGENT_SDK_VERSION=SDKVersion for Anthropic telemetry.
 //   - Sets MAX_THINKING_TOKENS=0 when ThinkingDisabled (documented way to disable thinking).
-//   - Merges opts.Env (user-supplied extra vars, applied last so they win).
+//   - Sets CLAUDE_AUTOCOMPACT_PCT_OVERRIDE when CompactionThreshold is set.
+//   - Sets CLAUDE_CODE_MAX_TOOL_USE_CONCURRENCY when MaxConcurrentTools is set.
+//   - Merges opts.Env (user-supplied extra vars). A managed var that also appears
+//     in opts.Env is not set, so the user's value is the only entry.
 func buildEnv(opts *Options) []string {
 	parent := os.Environ()
 	out := make([]string, 0, len(parent)+3+len(opts.Env))
@@ -528,6 +970,13 @@ func buildEnv(opts *Options) []string {
 			strings.HasPrefix(e, "CLAUDE_CODE_ENTRYPOINT="),
 			strings.HasPrefix(e, "CLAUDE_AGENT_SDK_VERSION="),
 			strings.HasPrefix(e, "MAX_THINKING_TOKENS="),
+			opts.CompactionThreshold > 0 && strings.HasPrefix(e, "CLAUDE_AUTOCOMPACT_PCT_OVERRIDE="),
+			opts.MaxConcurrentTools > 0 && strings.HasPrefix(e, "CLAUDE_CODE_MAX_TOOL_USE_CONCURRENCY="),
+			opts.MaxToolResultTokens > 0 && strings.HasPrefix(e, "MAX_MCP_OUTPUT_TOKENS="),
+			opts.MaxToolResultTokens > 0 && strings.HasPrefix(e, "BASH_MAX_OUTPUT_LENGTH="),
+			opts.ToolTimeout > 0 && strings.HasPrefix(e, "MCP_TOOL_TIMEOUT="),
+			opts.ToolTimeout > 0 && strings.HasPrefix(e, "BASH_DEFAULT_TIMEOUT_MS="),
+			opts.ToolTimeout > 0 && strings.HasPrefix(e, "BASH_MAX_TIMEOUT_MS="),
 			opts.CWD != "" && strings.HasPrefix(e, "PWD="):
 			continue
 		}
@@ -539,18 +988,44 @@ func buildEnv(opts *Options) []string {
 		}
 		out = append(out, e)
 	}
-	out = append(out, "CLAUDE_CODE_ENTRYPOINT=sdk-go")
-	out = append(out, "CLAUDE_AGENT_SDK_VERSION="+SDKVersion)
+	// set adds a managed var unless the user supplied their own value.
+	set := func(k, v string) {
+		if _, overridden := opts.Env[k]; !overridden {
+			out = append(out, k+"="+v)
+		}
+	}
+	entrypoint := opts.Entrypoint
+	if entrypoint == "" {
+		entrypoint = defaultEntrypoint
+	}
+	set("CLAUDE_CODE_ENTRYPOINT", entrypoint)
+	set("CLAUDE_AGENT_SDK_VERSION", SDKVersion)
 	if opts.Thinking == ThinkingDisabled {
-		out = append(out, "MAX_THINKING_TOKENS=0")
+		set("MAX_THINKING_TOKENS", "0")
 	} else if opts.MaxThinkingTokens > 0 {
-		out = append(out, fmt.Sprintf("MAX_THINKING_TOKENS=%d", opts.MaxThinkingTokens))
+		set("MAX_THINKING_TOKENS", fmt.Sprintf("%d", opts.MaxThinkingTokens))
+	}
+	if opts.MaxConcurrentTools > 0 {
+		set("CLAUDE_CODE_MAX_TOOL_USE_CONCURRENCY", fmt.Sprintf("%d", opts.MaxConcurrentTools))
+	}
+	if opts.MaxToolResultTokens > 0 {
+		set("MAX_MCP_OUTPUT_TOKENS", fmt.Sprintf("%d", opts.MaxToolResultTokens))
+		set("BASH_MAX_OUTPUT_LENGTH", fmt.Sprintf("%d", opts.MaxToolResultTokens*charsPerToken))
+	}
+	if opts.ToolTimeout > 0 {
+		ms := fmt.Sprintf("%d", opts.ToolTimeout.Milliseconds())
+		set("MCP_TOOL_TIMEOUT", ms)
+		set("BASH_DEFAULT_TIMEOUT_MS", ms)
+		set("BASH_MAX_TIMEOUT_MS", ms)
+	}
+	if opts.CompactionThreshold > 0 {
+		set("CLAUDE_AUTOCOMPACT_PCT_OVERRIDE", fmt.Sprintf("%d", opts.CompactionThreshold))
 	}
 	// Set PWD when CWD is configured (matches Python SDK behaviour).
 	if opts.CWD != "" {
-		out = append(out, "PWD="+opts.CWD)
+		set("PWD", opts.CWD)
 	}
-	// Merge user-supplied env vars (last so they take precedence).
+	// Merge user-supplied env vars.
 	for k, v := range opts.Env {
 		out = append(out, k+"="+v)
 	}
@@ -579,6 +1054,16 @@ func parseLine(line []byte) (Event, error) {
 		if err := json.Unmarshal(line, &m); err == nil {
 			event.Assistant = &m
 		}
+	case TypeUser:
+		if c := parseCompaction(line); c != nil {
+			event.Type = TypeCompaction
+			event.Compaction = c
+			break
+		}
+		var m UserMessage
+		if err := json.Unmarshal(line, &m); err == nil {
+			event.User = &m
+		}
 	case TypeStreamEvent:
 		var m StreamEventMessage
 		if err := json.Unmarshal(line, &m); err == nil {
@@ -592,6 +1077,9 @@ func parseLine(line []byte) (Event, error) {
 	case TypeSystem:
 		var m SystemMessage
 		if err := json.Unmarshal(line, &m); err == nil {
+			if m.Subtype == SubtypeStatus {
+				decodeStatus(line, &m)
+			}
 			event.System = &m
 		}
 	case TypeToolProgress:
@@ -604,14 +1092,58 @@ func parseLine(line []byte) (Event, error) {
 		if err := json.Unmarshal(line, &m); err == nil {
 			event.Task = &m
 		}
-		// TypeRateLimitEvent and future types: Raw only.
+	case TypeRateLimitEvent:
+		var m RateLimitMessage
+		if err := json.Unmarshal(line, &m); err == nil {
+			event.RateLimit = &m
+		}
+		// Future types: Raw only.
 	}
 
 	return event, nil
 }
 
+// sdkHooks returns the user's hooks plus the ones the SDK installs to enforce
+// options such as WithAllowedDomains and WithMaxFileReadSize.
+func sdkHooks(opts *Options) map[HookEvent][]HookMatcher {
+	hooks := opts.Hooks
+	if len(opts.AllowedDomains) > 0 {
+		hooks = withAllowedDomainsHook(hooks, opts.AllowedDomains)
+	}
+	if opts.MaxFileReadSize > 0 {
+		hooks = withMaxFileReadSizeHook(hooks, opts.MaxFileReadSize)
+	}
+	return hooks
+}
+
+// decodeStatus fills the structured fields of a status message from its line.
+func decodeStatus(line []byte, m *SystemMessage) {
+	_ = json.Unmarshal(line, &m.StatusDetail)
+	var p StatusProgress
+	if json.Unmarshal(line, &p) == nil && p != (StatusProgress{}) {
+		m.Progress = &p
+	}
+}
+
 // ─── Helpers ─────────────────────────────────────────────────────────────────
 
+// sessionIDOf returns the session ID carried by e, or "" if it has none.
+func sessionIDOf(e Event) string {
+	switch {
+	case e.System != nil:
+		return e.System.SessionID
+	case e.Assistant != nil:
+		return e.Assistant.SessionID
+	case e.User != nil:
+		return e.User.SessionID
+	case e.Result != nil:
+		return e.Result.SessionID
+	case e.StreamEvent != nil:
+		return e.StreamEvent.SessionID
+	}
+	return ""
+}
+
 // errorEvent builds a synthetic TypeSystem/error event for process-level failures.
 func errorEvent(msg string) Event {
 	return Event{
@@ -624,6 +1156,151 @@ func errorEvent(msg string) Event {
 	}
 }
 
+// toolTimer measures tool execution time as the interval between a tool_use
+// block and its matching tool_result, keyed by tool use ID.
+type toolTimer map[string]time.Time
+
+// observe records tool_use blocks and sets DurationMS on tool_result blocks.
+func (t toolTimer) observe(e Event) {
+	now := time.Now()
+	if e.Assistant != nil {
+		for _, b := range e.Assistant.Message.Content {
+			if b.Type == "tool_use" {
+				t[b.ID] = now
+			}
+		}
+	}
+	if e.User != nil {
+		for i, b := range e.User.Message.Content {
+			if start, ok := t[b.ToolUseID]; ok && b.Type == "tool_result" {
+				e.User.Message.Content[i].DurationMS = now.Sub(start).Milliseconds()
+				delete(t, b.ToolUseID)
+			}
+		}
+	}
+}
+
+// observeTools invokes the OnToolUse / OnToolResult callbacks for the tool_use
+// and tool_result blocks carried by e. Each callback runs in its own goroutine
+// so a slow observer never blocks the reader.
+func observeTools(e Event, opts *Options) {
+	if opts.OnToolUse != nil && e.Assistant != nil {
+		for _, b := range e.Assistant.Message.Content {
+			if b.Type == "tool_use" {
+				go opts.OnToolUse(b.Name, b.Input, b.ID)
+			}
+		}
+	}
+	if opts.OnToolResult != nil && e.User != nil {
+		for _, b := range e.User.Message.Content {
+			if b.Type == "tool_result" {
+				go opts.OnToolResult(b.ToolUseID, b.ResultText(), b.IsError)
+			}
+		}
+	}
+}
+
+// filterContent applies fn to the assistant text carried by e.
+func filterContent(e *Event, fn func(string) string) {
+	switch {
+	case e.Assistant != nil:
+		for i, b := range e.Assistant.Message.Content {
+			if b.Type == "text" {
+				e.Assistant.Message.Content[i].Text = fn(b.Text)
+			}
+		}
+	case e.StreamEvent != nil:
+		if d := e.StreamEvent.Event.Delta; d != nil && d.Type == "text_delta" {
+			d.Text = fn(d.Text)
+		}
+	case e.Result != nil:
+		if e.Result.Result != "" {
+			e.Result.Result = fn(e.Result.Result)
+		}
+	}
+}
+
+// isErrorEvent reports whether e is an error result or an error system event.
+func isErrorEvent(e Event) bool {
+	return (e.Result != nil && e.Result.IsError) ||
+		(e.System != nil && e.System.Subtype == "error")
+}
+
+// warningEvent builds a synthetic TypeSystem/warning event for non-fatal problems.
+func warningEvent(msg string) Event {
+	return Event{
+		Type: TypeSystem,
+		System: &SystemMessage{
+			Type:    TypeSystem,
+			Subtype: SubtypeWarning,
+			Message: msg,
+		},
+	}
+}
+
+// initWarnings compares the options against what the CLI reported in its init
+// message and returns a message for each mismatch.
+func initWarnings(opts *Options, init *SystemMessage) []string {
+	var warnings []string
+	if unknown := missingFrom(opts.Skills, init.Skills); len(unknown) > 0 {
+		warnings = append(warnings, fmt.Sprintf("unknown skills: %s", strings.Join(unknown, ", ")))
+	}
+	if unknown := unknownTools(opts, init.Tools); len(unknown) > 0 {
+		warnings = append(warnings, "unknown tools: "+strings.Join(unknown, ", "))
+	}
+	if w := permissionPromptToolWarning(opts, init.Tools); w != "" {
+		warnings = append(warnings, w)
+	}
+	if opts.ResponsePrefill != "" && opts.structuredOutput() {
+		warnings = append(warnings, fmt.Sprintf("response prefill ignored: OutputFormat %q is set", opts.OutputFormat.Type))
+	}
+	return warnings
+}
+
+// unknownTools returns the AllowedTools and DisallowedTools entries that match
+// none of the tools the CLI reported, each with a suggestion when only the
+// case differs. Permission rules such as "Bash(git:*)" are checked by tool name,
+// "mcp__server" matches any tool of that server, and a trailing "*" matches by
+// prefix. Nothing is reported when the CLI did not list its tools.
+func unknownTools(opts *Options, tools []string) []string {
+	if len(tools) == 0 {
+		return nil
+	}
+	known := func(name string) bool {
+		if prefix, ok := strings.CutSuffix(name, "*"); ok {
+			return slices.ContainsFunc(tools, func(t string) bool { return strings.HasPrefix(t, prefix) })
+		}
+		return slices.ContainsFunc(tools, func(t string) bool {
+			return t == name || strings.HasPrefix(t, name+"__")
+		})
+	}
+	var unknown []string
+	for _, entry := range slices.Concat(opts.AllowedTools, opts.DisallowedTools) {
+		name, _, _ := strings.Cut(entry, "(")
+		name = strings.TrimSpace(name)
+		if known(name) {
+			continue
+		}
+		msg := strconv.Quote(entry)
+		if i := slices.IndexFunc(tools, func(t string) bool { return strings.EqualFold(t, name) }); i >= 0 {
+			msg += fmt.Sprintf(" (did you mean %q?)", tools[i])
+		}
+		unknown = append(unknown, msg)
+	}
+	return unknown
+}
+
+// missingFrom returns the elements of want that are not in have.
+func missingFrom(want, have []string) []string {
+	var missing []string
+	for _, w := range want {
+		if !slices.Contains(have, w) {
+			missing = append(missing, w)
+		}
+	}
+	return missing
+}
+
 // sendEvent delivers an event to ch, dropping it if ctx is already done.
 func sendEvent(ctx context.Context, ch chan<- Event, e Event) {
 	select {
@@ -1,11 +1,19 @@
 package claude
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestBuildEnv_PWD(t *testing.T) {
@@ -74,6 +82,24 @@ func TestBuildEnv_SDKVersion(t *testing.T) {
 	}
 }
 
+func TestBuildEnv_ManagedVarOverride(t *testing.T) {
+	opts := defaultOptions()
+	opts.Env = map[string]string{"CLAUDE_AGENT_SDK_VERSION": "custom"}
+	env := buildEnv(opts)
+	count := 0
+	for _, e := range env {
+		if strings.HasPrefix(e, "CLAUDE_AGENT_SDK_VERSION=") {
+			count++
+			if e != "CLAUDE_AGENT_SDK_VERSION=custom" {
+				t.Fatalf("unexpected SDK version entry: %s", e)
+			}
+		}
+	}
+	if count != 1 {
+		t.Fatalf("expected exactly 1 CLAUDE_AGENT_SDK_VERSION entry, got %d", count)
+	}
+}
+
 func TestBuildEnv_Entrypoint(t *testing.T) {
 	opts := defaultOptions()
 	env := buildEnv(opts)
@@ -88,6 +114,24 @@ func TestBuildEnv_Entrypoint(t *testing.T) {
 	}
 }
 
+func TestBuildEnv_CustomEntrypoint(t *testing.T) {
+	opts := defaultOptions()
+	WithEntrypoint("acme-assistant")(opts)
+	env := buildEnv(opts)
+	count := 0
+	for _, e := range env {
+		if strings.HasPrefix(e, "CLAUDE_CODE_ENTRYPOINT=") {
+			count++
+			if e != "CLAUDE_CODE_ENTRYPOINT=acme-assistant" {
+				t.Fatalf("unexpected entrypoint entry: %s", e)
+			}
+		}
+	}
+	if count != 1 {
+		t.Fatalf("expected exactly 1 CLAUDE_CODE_ENTRYPOINT entry, got %d", count)
+	}
+}
+
 func TestBuildEnv_ThinkingDisabled(t *testing.T) {
 	opts := defaultOptions()
 	opts.Thinking = ThinkingDisabled
@@ -118,6 +162,49 @@ func TestBuildEnv_MaxThinkingTokens(t *testing.T) {
 	}
 }
 
+func TestBuildEnv_CompactionThreshold(t *testing.T) {
+	opts := defaultOptions()
+	WithCompactionThreshold(90)(opts)
+	env := buildEnv(opts)
+	found := false
+	for _, e := range env {
+		if e == "CLAUDE_AUTOCOMPACT_PCT_OVERRIDE=90" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected CLAUDE_AUTOCOMPACT_PCT_OVERRIDE=90 in environment")
+	}
+}
+
+func TestBuildEnv_MaxConcurrentTools(t *testing.T) {
+	opts := defaultOptions()
+	WithMaxConcurrentTools(2)(opts)
+	env := buildEnv(opts)
+	found := false
+	for _, e := range env {
+		if e == "CLAUDE_CODE_MAX_TOOL_USE_CONCURRENCY=2" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("expected CLAUDE_CODE_MAX_TOOL_USE_CONCURRENCY=2 in environment")
+	}
+}
+
+func TestBuildEnv_MaxToolResultTokens(t *testing.T) {
+	t.Setenv("BASH_MAX_OUTPUT_LENGTH", "999999")
+	opts := defaultOptions()
+	WithMaxToolResultTokens(5000)(opts)
+	env := buildEnv(opts)
+	if !slices.Contains(env, "MAX_MCP_OUTPUT_TOKENS=5000") || !slices.Contains(env, "BASH_MAX_OUTPUT_LENGTH=20000") {
+		t.Fatalf("expected tool output limits in environment, got %v", env)
+	}
+	if slices.Contains(env, "BASH_MAX_OUTPUT_LENGTH=999999") {
+		t.Fatal("expected the inherited BASH_MAX_OUTPUT_LENGTH to be replaced")
+	}
+}
+
 func TestBuildEnv_UserEnvOverride(t *testing.T) {
 	opts := defaultOptions()
 	opts.Env = map[string]string{"MY_VAR": "my_value"}
@@ -246,7 +333,58 @@ func TestRouteControlResponse_UnknownRequestID(t *testing.T) {
 
 	// No pending request registered for this ID — should not panic.
 	line := []byte(`{"type":"control_response","request_id":"unknown","response":{"subtype":"success"}}`)
-	routeControlResponse(line, s) // should not panic
+	if w := routeControlResponse(line, s); w != "" {
+		t.Fatalf("expected no warning for an unmatched success, got %q", w)
+	}
+
+	line = []byte(`{"type":"control_response","request_id":"unknown","response":{"subtype":"error","error":"unknown field sandbox"}}`)
+	if w := routeControlResponse(line, s); w != "the CLI rejected control request unknown: unknown field sandbox" {
+		t.Fatalf("unexpected warning for an unmatched error: %q", w)
+	}
+}
+
+func TestRouteControlResponse_NestedRequestID(t *testing.T) {
+	s := &Stream{
+		events:  make(chan Event, 1),
+		pending: make(map[string]chan controlResponse),
+	}
+	ch := make(chan controlResponse, 1)
+	s.pending["req-nested"] = ch
+
+	line := []byte(`{"type":"control_response","response":{"subtype":"error","request_id":"req-nested","error":"nope"}}`)
+	if w := routeControlResponse(line, s); w != "" {
+		t.Fatalf("expected the error to go to the waiting caller, got warning %q", w)
+	}
+	if resp := <-ch; resp.Success || resp.Error != "nope" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestQuery_RejectedInitializeWarning(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"subtype":"initialize"'*)
+      id=$(printf '%s' "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+      printf '%s\n' '{"type":"control_response","request_id":"'"$id"'","response":{"subtype":"error","error":"unknown field: sandbox"}}' ;;
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"ok","session_id":"s1","is_error":false}'
+      exit 0 ;;
+  esac
+done
+`)
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warnings []string
+	for e := range stream.Events() {
+		if e.System != nil && e.System.Subtype == SubtypeWarning {
+			warnings = append(warnings, e.System.Message)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "unknown field: sandbox") {
+		t.Fatalf("expected a warning for the rejected initialize, got %v", warnings)
+	}
 }
 
 func TestHandleControlRequest_Elicitation_WithHandler(t *testing.T) {
@@ -312,3 +450,441 @@ func TestHandleControlRequest_Elicitation_NilHandler(t *testing.T) {
 		t.Fatalf("expected cancel=true, got %v", inner["cancel"])
 	}
 }
+
+func TestInitializeMsg_Skills(t *testing.T) {
+	opts := defaultOptions()
+	WithSkills("pdf", "xlsx")(opts)
+
+	b, err := json.Marshal(initializeMsg(opts, map[string]any{}))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var m struct {
+		Request struct {
+			Skills []string `json:"skills"`
+		} `json:"request"`
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if strings.Join(m.Request.Skills, ",") != "pdf,xlsx" {
+		t.Fatalf("expected skills [pdf xlsx], got %v", m.Request.Skills)
+	}
+}
+
+func TestInitWarnings_UnknownSkills(t *testing.T) {
+	opts := defaultOptions()
+	opts.Skills = []string{"pdf", "missing"}
+
+	warnings := initWarnings(opts, &SystemMessage{Subtype: SubtypeInit, Skills: []string{"pdf"}})
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "missing") {
+		t.Fatalf("expected one warning naming 'missing', got %v", warnings)
+	}
+
+	opts.Skills = []string{"pdf"}
+	if warnings := initWarnings(opts, &SystemMessage{Skills: []string{"pdf"}}); len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %v", warnings)
+	}
+}
+
+func TestInitWarnings_UnknownTools(t *testing.T) {
+	opts := defaultOptions()
+	WithAllowedTools("Reed", "bash(git:*)", "Bash(go test:*)", "mcp__db", "mcp__fs__*")(opts)
+	WithDisallowedTools("WebFetch", "Nope")(opts)
+	tools := []string{"Read", "Bash", "WebFetch", "mcp__db__query", "mcp__fs__read"}
+
+	warnings := initWarnings(opts, &SystemMessage{Subtype: SubtypeInit, Tools: tools})
+	want := `unknown tools: "Reed", "bash(git:*)" (did you mean "Bash"?), "Nope"`
+	if len(warnings) != 1 || warnings[0] != want {
+		t.Fatalf("expected %q, got %v", want, warnings)
+	}
+
+	// Without a tool list there is nothing to check against.
+	if warnings := initWarnings(opts, &SystemMessage{Subtype: SubtypeInit}); len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %v", warnings)
+	}
+}
+
+func TestQuery_StrictToolNames(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"system","subtype":"init","session_id":"s1","tools":["Read","Bash"]}'
+      sleep 5
+      exit 0 ;;
+  esac
+done
+`)
+	start := time.Now()
+	_, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithAllowedTools("Reed"), WithStrictToolNames())
+	if err == nil || !strings.Contains(err.Error(), `unknown tools: "Reed"`) {
+		t.Fatalf("expected an unknown tools error, got %v", err)
+	}
+	if time.Since(start) > 4*time.Second {
+		t.Fatal("expected the run to stop without waiting for the CLI")
+	}
+}
+
+func TestStreamCapabilities(t *testing.T) {
+	s := &Stream{
+		ctx:    context.Background(),
+		done:   make(chan struct{}),
+		initCh: make(chan struct{}),
+	}
+	go s.recordInit(&SystemMessage{
+		Subtype:       SubtypeInit,
+		Model:         "claude-sonnet-4-6",
+		Tools:         []string{"Bash", "Read"},
+		Skills:        []string{"pdf"},
+		SlashCommands: []string{"deploy"},
+	})
+
+	caps, err := s.Capabilities()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if caps.Model != "claude-sonnet-4-6" || len(caps.Tools) != 2 || caps.Skills[0] != "pdf" || caps.SlashCommands[0] != "deploy" {
+		t.Fatalf("unexpected capabilities: %+v", caps)
+	}
+	if s.recordInit(&SystemMessage{Model: "other"}) {
+		t.Fatal("expected second init to be ignored")
+	}
+}
+
+func TestStreamCapabilities_EndedBeforeInit(t *testing.T) {
+	s := &Stream{
+		ctx:    context.Background(),
+		done:   make(chan struct{}),
+		initCh: make(chan struct{}),
+	}
+	close(s.done)
+
+	if _, err := s.Capabilities(); err == nil {
+		t.Fatal("expected error when stream ends before init")
+	}
+}
+
+func TestFilterContent(t *testing.T) {
+	redact := func(s string) string { return strings.ReplaceAll(s, "secret", "[REDACTED]") }
+
+	lines := []string{
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"thinking","thinking":"secret plan"},{"type":"text","text":"the secret is out"}]}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","delta":{"type":"text_delta","text":"secret"}}}`,
+		`{"type":"result","subtype":"success","result":"no secret here"}`,
+	}
+	var events []Event
+	for _, l := range lines {
+		e, err := parseLine([]byte(l))
+		if err != nil {
+			t.Fatalf("parseLine: %v", err)
+		}
+		filterContent(&e, redact)
+		events = append(events, e)
+	}
+
+	if got := events[0].Assistant.Text(); got != "the [REDACTED] is out" {
+		t.Fatalf("unexpected assistant text %q", got)
+	}
+	if got := events[0].Assistant.Thinking(); got != "secret plan" {
+		t.Fatalf("expected thinking to be left alone, got %q", got)
+	}
+	if got := events[1].StreamEvent.Event.Delta.Text; got != "[REDACTED]" {
+		t.Fatalf("unexpected delta text %q", got)
+	}
+	if got := events[2].Result.Result; got != "no [REDACTED] here" {
+		t.Fatalf("unexpected result text %q", got)
+	}
+}
+
+func TestObserveTools(t *testing.T) {
+	uses := make(chan string, 1)
+	results := make(chan string, 1)
+	opts := defaultOptions()
+	WithOnToolUse(func(name string, input json.RawMessage, id string) { uses <- name + ":" + id })(opts)
+	WithOnToolResult(func(id, content string, isErr bool) { results <- fmt.Sprintf("%s:%s:%v", id, content, isErr) })(opts)
+
+	use, _ := parseLine([]byte(`{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"tu1","name":"Bash","input":{}}]}}`))
+	res, _ := parseLine([]byte(`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu1","content":"boom","is_error":true}]}}`))
+	observeTools(use, opts)
+	observeTools(res, opts)
+
+	if got := <-uses; got != "Bash:tu1" {
+		t.Fatalf("unexpected tool use %q", got)
+	}
+	if got := <-results; got != "tu1:boom:true" {
+		t.Fatalf("unexpected tool result %q", got)
+	}
+}
+
+func TestHandleControlRequest_MCPMessage(t *testing.T) {
+	var written []any
+	write := func(v any) error {
+		written = append(written, v)
+		return nil
+	}
+
+	var gotServer, gotMsg string
+	opts := defaultOptions()
+	opts.MCPNotificationHandler = func(server string, msg json.RawMessage) {
+		gotServer, gotMsg = server, string(msg)
+	}
+
+	line := []byte(`{"type":"control_request","request_id":"r3","request":{"subtype":"mcp_message","server_name":"my-tools","message":{"jsonrpc":"2.0","method":"notifications/progress","params":{"progress":5}}}}`)
+	handleControlRequest(line, write, opts, hookRegistry{})
+
+	if gotServer != "my-tools" {
+		t.Fatalf("expected server my-tools, got %q", gotServer)
+	}
+	if !strings.Contains(gotMsg, "notifications/progress") {
+		t.Fatalf("expected progress notification, got %s", gotMsg)
+	}
+	if len(written) != 1 {
+		t.Fatalf("expected 1 ack, got %d writes", len(written))
+	}
+}
+
+func TestWriteUserTurn_Prefill(t *testing.T) {
+	var written []string
+	write := func(v any) error {
+		b, _ := json.Marshal(v)
+		written = append(written, string(b))
+		return nil
+	}
+
+	if err := writeUserTurn(write, "give me json", "{", ""); err != nil {
+		t.Fatalf("writeUserTurn: %v", err)
+	}
+	if len(written) != 2 {
+		t.Fatalf("expected user message and prefill, got %d writes", len(written))
+	}
+	if !strings.Contains(written[1], `"type":"assistant"`) || !strings.Contains(written[1], `"text":"{"`) {
+		t.Fatalf("unexpected prefill message: %s", written[1])
+	}
+
+	written = nil
+	_ = writeUserTurn(write, "plain", "", "")
+	if len(written) != 1 {
+		t.Fatalf("expected only the user message without prefill, got %d writes", len(written))
+	}
+}
+
+func TestResponsePrefill_IgnoredWithStructuredOutput(t *testing.T) {
+	opts := defaultOptions()
+	WithResponsePrefill("{")(opts)
+	if opts.responsePrefill() != "{" {
+		t.Fatal("expected prefill without OutputFormat")
+	}
+
+	WithOutputFormat(&OutputFormat{Type: "json_schema"})(opts)
+	if opts.responsePrefill() != "" {
+		t.Fatal("expected prefill to be ignored with json_schema output")
+	}
+	if warnings := initWarnings(opts, &SystemMessage{}); len(warnings) != 1 {
+		t.Fatalf("expected a prefill warning, got %v", warnings)
+	}
+}
+
+func TestResponsePrefill_RequiresThinkingDisabled(t *testing.T) {
+	_, err := Query(t.Context(), "hi", WithResponsePrefill("{"), WithClaudeExecutable("/nonexistent/claude"))
+	if err == nil || !strings.Contains(err.Error(), "ThinkingDisabled") {
+		t.Fatalf("expected prefill with adaptive thinking to be rejected, got %v", err)
+	}
+
+	opts := defaultOptions()
+	WithResponsePrefill("{")(opts)
+	WithThinking(ThinkingDisabled)(opts)
+	if err := checkResponsePrefill(opts); err != nil {
+		t.Fatalf("unexpected error with thinking disabled: %v", err)
+	}
+	WithThinking(ThinkingAdaptive)(opts)
+	WithOutputFormat(&OutputFormat{Type: "json_schema"})(opts)
+	if err := checkResponsePrefill(opts); err != nil {
+		t.Fatalf("an ignored prefill should not be rejected: %v", err)
+	}
+}
+
+func TestInitializeMsg_ModelParameters(t *testing.T) {
+	zero := 0.0
+	opts := defaultOptions()
+	WithModelParameters(ModelParameters{Temperature: &zero})(opts)
+
+	b, err := json.Marshal(initializeMsg(opts, map[string]any{}))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(b), `"modelParameters":{"temperature":0}`) {
+		t.Fatalf("expected temperature 0 without top_p/top_k, got %s", b)
+	}
+
+	b, _ = json.Marshal(initializeMsg(defaultOptions(), map[string]any{}))
+	if strings.Contains(string(b), "modelParameters") {
+		t.Fatalf("expected no modelParameters by default, got %s", b)
+	}
+}
+
+func TestSpawn_CmdConfigurer(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"'"$CONFIGURED"'"}'
+      exit 0 ;;
+  esac
+done
+`)
+	r, err := Run(context.Background(), "hi",
+		WithClaudeExecutable(exe),
+		WithCmdConfigurer(func(cmd *exec.Cmd) {
+			cmd.Env = append(cmd.Env, "CONFIGURED=yes")
+		}),
+	)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if r.Result != "yes" {
+		t.Fatalf("expected configurer to run before start, got result %q", r.Result)
+	}
+}
+
+func TestToolTimer(t *testing.T) {
+	timer := toolTimer{}
+	use, _ := parseLine([]byte(`{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"tu1","name":"Bash","input":{}}]}}`))
+	res, _ := parseLine([]byte(`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu1","content":"ok"}]}}`))
+
+	timer.observe(use)
+	time.Sleep(20 * time.Millisecond)
+	timer.observe(res)
+
+	if d := res.User.Message.Content[0].DurationMS; d < 20 {
+		t.Fatalf("expected DurationMS >= 20, got %d", d)
+	}
+	if len(timer) != 0 {
+		t.Fatalf("expected the finished tool to be forgotten, got %v", timer)
+	}
+}
+
+func TestInitializeMsg_Title(t *testing.T) {
+	opts := defaultOptions()
+	WithTitle("Refactor parser")(opts)
+	b, err := json.Marshal(initializeMsg(opts, map[string]any{}))
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(b), `"title":"Refactor parser"`) {
+		t.Fatalf("expected title in initialize message, got %s", b)
+	}
+}
+
+// TestQuery_LargeImageToolResult checks that a tool_result carrying a
+// screenshot-sized image, well over the old 4 MB line limit, is read intact.
+func TestQuery_LargeImageToolResult(t *testing.T) {
+	png := make([]byte, 6*1024*1024)
+	for i := range png {
+		png[i] = byte(i * 31)
+	}
+	content, _ := json.Marshal([]map[string]any{
+		{"type": "text", "text": "diff"},
+		{"type": "image", "source": map[string]any{
+			"type": "base64", "media_type": "image/png", "data": base64.StdEncoding.EncodeToString(png),
+		}},
+	})
+	user := fmt.Sprintf(`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":%s}]},"session_id":"s1"}`, content)
+	lines := user + "\n" + `{"type":"result","subtype":"success","session_id":"s1","is_error":false}` + "\n"
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	if err := os.WriteFile(out, []byte(lines), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	exe := writeFakeCLI(t, "read -r line\ncat "+out+"\n")
+
+	stream, err := Query(context.Background(), "diff the screenshots", WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var images []ImageSource
+	for e := range stream.Events() {
+		if e.User == nil {
+			continue
+		}
+		for _, b := range e.User.Message.Content {
+			if b.Type == "tool_result" {
+				images = append(images, b.ResultImages()...)
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("stream error: %v", err)
+	}
+	if len(images) != 1 || images[0].MediaType != "image/png" {
+		t.Fatalf("unexpected images: %d", len(images))
+	}
+	got, err := images[0].Bytes()
+	if err != nil {
+		t.Fatalf("Bytes: %v", err)
+	}
+	if !bytes.Equal(got, png) {
+		t.Fatal("image bytes changed in transit")
+	}
+}
+
+func TestInitWarnings_PermissionPromptTool(t *testing.T) {
+	tools := []string{"Read", "mcp__perm__approve", "mcp__perm__deny"}
+	tests := []struct {
+		name    string
+		servers map[string]any
+		want    string
+	}{
+		{"mcp__perm__approve", nil, ""},
+		{"mcp__perm__aprove", nil, `; MCP server "perm" has mcp__perm__approve, mcp__perm__deny`},
+		{"mcp__perm__Approve", nil, `(did you mean "mcp__perm__approve"?)`},
+		{"mcp__auth__approve", nil, `; no MCP server "auth" is configured`},
+		{"mcp__auth__approve", map[string]any{"auth": McpHTTPServer{Type: "http"}}, `; MCP server "auth" reported no tools`},
+	}
+	for _, tt := range tests {
+		opts := defaultOptions()
+		WithPermissionPromptToolName(tt.name)(opts)
+		WithMcpServers(tt.servers)(opts)
+		warnings := initWarnings(opts, &SystemMessage{Subtype: SubtypeInit, Tools: tools})
+		switch {
+		case tt.want == "" && len(warnings) != 0:
+			t.Errorf("%s: expected no warnings, got %v", tt.name, warnings)
+		case tt.want != "" && (len(warnings) != 1 || !strings.Contains(warnings[0], tt.want)):
+			t.Errorf("%s: expected a warning containing %q, got %v", tt.name, tt.want, warnings)
+		}
+	}
+}
+
+func TestQuery_MalformedPermissionPromptTool(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "spawned")
+	exe := writeFakeCLI(t, "touch "+marker+"\nexit 1\n")
+	_, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithPermissionPromptToolName("approve"))
+	if err == nil || !strings.Contains(err.Error(), "mcp__<server>__<tool>") {
+		t.Fatalf("expected a tool name error, got %v", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatal("CLI was spawned with a malformed permission prompt tool")
+	}
+}
+
+func TestStartupWriteError(t *testing.T) {
+	writeErr := errors.New("claude: initialize: write |1: broken pipe")
+	start := func(script string) (*exec.Cmd, *bytes.Buffer) {
+		cmd := exec.Command("sh", "-c", script)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		return cmd, &stderr
+	}
+
+	cmd, stderr := start(`echo "error: unknown option '--input-format'" >&2; exit 1`)
+	err := startupWriteError(cmd, stderr, writeErr)
+	var procErr *ProcessError
+	if !errors.As(err, &procErr) || procErr.ExitCode != 1 || !strings.Contains(procErr.Stderr, "unknown option") {
+		t.Fatalf("expected *ProcessError with stderr, got %T: %v", err, err)
+	}
+
+	cmd, stderr = start(`exit 0`)
+	if err := startupWriteError(cmd, stderr, writeErr); err != writeErr {
+		t.Fatalf("clean exit: got %v, want the write error", err)
+	}
+}
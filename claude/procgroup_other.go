@@ -0,0 +1,22 @@
+//go:build !unix
+
+package claude
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup is a no-op where process groups are not available.
+func setProcessGroup(*exec.Cmd) {}
+
+// signalProcessGroup signals p alone where process groups are not available.
+// Windows cannot deliver SIGTERM, so anything but SIGKILL is a no-op there.
+func signalProcessGroup(p *os.Process, sig syscall.Signal) {
+	if sig == syscall.SIGKILL {
+		_ = p.Kill()
+		return
+	}
+	_ = p.Signal(sig)
+}
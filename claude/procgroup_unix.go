@@ -0,0 +1,27 @@
+//go:build unix
+
+package claude
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the subprocess in its own process group so that
+// shutdown signals also reach the processes it spawns (MCP stdio servers, Bash
+// commands), instead of orphaning them.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// signalProcessGroup sends sig to p's process group, falling back to p alone
+// when p does not lead a group (e.g. a CmdConfigurer replaced SysProcAttr).
+func signalProcessGroup(p *os.Process, sig syscall.Signal) {
+	if err := syscall.Kill(-p.Pid, sig); err != nil {
+		_ = p.Signal(sig)
+	}
+}
@@ -0,0 +1,76 @@
+//go:build unix
+
+package claude
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterrupt_KillsProcessGroup(t *testing.T) {
+	// The fake CLI starts a long-lived child, as an MCP stdio server would, and
+	// records its PID.
+	exe := writeFakeCLI(t, `sleep 30 &
+echo $! > "$CHILD_PID_FILE"
+while IFS= read -r line; do :; done
+`)
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+
+	session, err := NewSession(context.Background(),
+		WithClaudeExecutable(exe),
+		WithEnv(map[string]string{"CHILD_PID_FILE": pidFile}),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+
+	var pid int
+	deadline := time.Now().Add(5 * time.Second)
+	for pid == 0 && time.Now().Before(deadline) {
+		if b, err := os.ReadFile(pidFile); err == nil {
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pid == 0 {
+		t.Fatal("fake CLI did not report its child PID")
+	}
+
+	_ = session.Close()
+	drainTurn(t, session.Events())
+
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(pid, 0); err != nil {
+			return // child is gone
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_ = syscall.Kill(pid, syscall.SIGKILL)
+	t.Fatal("expected the CLI's child process to be stopped with it")
+}
+
+func TestWithShutdownTimeout(t *testing.T) {
+	// The fake CLI ignores SIGTERM and outlives stdin, so only SIGKILL stops it.
+	exe := writeFakeCLI(t, `trap '' TERM
+echo '{"type":"system","subtype":"status","session_id":"s1"}'
+while IFS= read -r line; do :; done
+while :; do sleep 0.05; done
+`)
+	session, err := NewSession(context.Background(), WithClaudeExecutable(exe), WithShutdownTimeout(200*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	<-session.Events() // the trap is installed
+	start := time.Now()
+	_ = session.Close()
+	drainTurn(t, session.Events())
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 2*time.Second {
+		t.Fatalf("subprocess stopped after %s, want about 200ms", elapsed)
+	}
+}
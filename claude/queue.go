@@ -0,0 +1,52 @@
+package claude
+
+import "sync"
+
+// eventQueue is an unbounded FIFO between the goroutine reading the CLI's
+// stdout and the one delivering events to Events(). It lets the reader keep
+// answering control requests while the consumer is not reading.
+type eventQueue struct {
+	mu     sync.Mutex
+	cond   sync.Cond
+	items  []Event
+	closed bool
+}
+
+func newEventQueue() *eventQueue {
+	q := &eventQueue{}
+	q.cond.L = &q.mu
+	return q
+}
+
+// push appends e; it never blocks on the consumer.
+func (q *eventQueue) push(e Event) {
+	q.mu.Lock()
+	q.items = append(q.items, e)
+	q.mu.Unlock()
+	q.cond.Signal()
+}
+
+// close marks the end of the input; pop drains what is left, then reports false.
+func (q *eventQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
+
+// pop removes and returns the oldest event, waiting for one if the queue is
+// empty. It returns false once the queue is closed and drained.
+func (q *eventQueue) pop() (Event, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.items) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.items) == 0 {
+		return Event{}, false
+	}
+	e := q.items[0]
+	q.items[0] = Event{}
+	q.items = q.items[1:]
+	return e, true
+}
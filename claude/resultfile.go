@@ -0,0 +1,53 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// resultFileSink returns the sink installed by WithResultFile.
+func resultFileSink(dir string) func(*Result) error {
+	return func(r *Result) error {
+		if r.SessionID == "" || strings.ContainsAny(r.SessionID, `/\`) || r.SessionID == "." || r.SessionID == ".." {
+			return fmt.Errorf("claude: result file: unusable session ID %q", r.SessionID)
+		}
+		return writeFileAtomic(filepath.Join(dir, r.SessionID+".json"), r)
+	}
+}
+
+// writeFileAtomic writes v as indented JSON to path through a temporary file
+// in the same directory, so readers see either the old file or the complete
+// new one.
+func writeFileAtomic(path string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("claude: result file: %w", err)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("claude: result file: %w", err)
+	}
+	f, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("claude: result file: %w", err)
+	}
+	defer os.Remove(f.Name()) // no-op once renamed
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("claude: result file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("claude: result file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("claude: result file: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("claude: result file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const resultFileCLI = `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"ok","session_id":"sess-1","is_error":false,"usage":{"input_tokens":12,"output_tokens":3},"structured_output":{"rows":[1,2]}}'
+      exit 0 ;;
+  esac
+done
+`
+
+func TestWithResultFile(t *testing.T) {
+	exe := writeFakeCLI(t, resultFileCLI)
+	dir := filepath.Join(t.TempDir(), "results")
+
+	res, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithResultFile(dir))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "sess-1.json"))
+	if err != nil {
+		t.Fatalf("read result file: %v", err)
+	}
+	var saved Result
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatalf("decode result file: %v", err)
+	}
+	if saved.Result != res.Result || saved.Usage.InputTokens != 12 || saved.StructuredOutput == nil {
+		t.Fatalf("unexpected saved result: %s", b)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("expected only the result file, found %d entries", len(entries))
+	}
+}
+
+func TestWithResultSink_Error(t *testing.T) {
+	exe := writeFakeCLI(t, resultFileCLI)
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe),
+		WithResultSink(func(*Result) error { return errors.New("bucket unavailable") }))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var warned, gotResult bool
+	for e := range stream.Events() {
+		if e.System != nil && e.System.Subtype == SubtypeWarning && strings.Contains(e.System.Message, "bucket unavailable") {
+			warned = !gotResult
+		}
+		gotResult = gotResult || e.Result != nil
+	}
+	if !warned || !gotResult {
+		t.Fatalf("expected a warning before the result (warned=%v, result=%v)", warned, gotResult)
+	}
+}
+
+func TestWithResultTransform(t *testing.T) {
+	exe := writeFakeCLI(t, resultFileCLI)
+	var seen string
+	upper := func(r *Result) error {
+		r.Result = strings.ToUpper(r.Result)
+		r.StructuredOutput = map[string]any{"rows": 2}
+		return nil
+	}
+	res, err := Run(context.Background(), "hi", WithClaudeExecutable(exe),
+		WithResultTransform(upper), WithOnResult(func(r *Result) { seen = r.Result }))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Result != "OK" || seen != "OK" || res.StructuredOutput.(map[string]any)["rows"] != 2 {
+		t.Fatalf("transform not applied: %+v (OnResult saw %q)", res, seen)
+	}
+
+	errBad := errors.New("no JSON in result")
+	fail := func(*Result) error { return errBad }
+	if _, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithResultTransform(fail)); !errors.Is(err, errBad) {
+		t.Fatalf("Run error = %v, want %v", err, errBad)
+	}
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe), WithResultTransform(fail))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for e := range stream.Events() {
+		if e.Type == TypeResult {
+			t.Fatal("result delivered despite the transform error")
+		}
+	}
+	if !errors.Is(stream.Err(), errBad) {
+		t.Fatalf("Stream.Err = %v, want %v", stream.Err(), errBad)
+	}
+}
@@ -0,0 +1,71 @@
+package claude
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// SchemaValidationError is returned when structured output does not conform
+// to the OutputFormat schema. Validation stops at the first violation.
+type SchemaValidationError struct {
+	// Path is the JSON pointer, within the schema, of the keyword that failed,
+	// e.g. "/properties/rows/items/properties/id"; "/" for the root schema.
+	Path string
+	// Reason describes the violation, e.g. `type: "7" has type "string", want "integer"`.
+	Reason string
+	// Err is the validator's full error.
+	Err error
+}
+
+func (e *SchemaValidationError) Error() string {
+	return fmt.Sprintf("claude: structured output does not match schema at %s: %s", e.Path, e.Reason)
+}
+
+func (e *SchemaValidationError) Unwrap() error { return e.Err }
+
+// Validate checks output, a decoded JSON value such as Result.StructuredOutput,
+// against f.Schema. It returns a *SchemaValidationError when output does not
+// conform, another error when the schema itself is invalid, and nil when f has
+// no schema.
+func (f *OutputFormat) Validate(output any) error {
+	if f == nil || f.Schema == nil {
+		return nil
+	}
+	raw, err := json.Marshal(f.Schema)
+	if err != nil {
+		return fmt.Errorf("claude: output schema: %w", err)
+	}
+	var schema jsonschema.Schema
+	if err := json.Unmarshal(raw, &schema); err != nil {
+		return fmt.Errorf("claude: output schema: %w", err)
+	}
+	resolved, err := schema.Resolve(nil)
+	if err != nil {
+		return fmt.Errorf("claude: output schema: %w", err)
+	}
+	if err := resolved.Validate(output); err != nil {
+		path, reason := splitValidationError(err.Error())
+		return &SchemaValidationError{Path: path, Reason: reason, Err: err}
+	}
+	return nil
+}
+
+// splitValidationError turns the validator's nested "validating <path>: ..."
+// message into the innermost schema path and the reason that follows it.
+func splitValidationError(msg string) (path, reason string) {
+	path, reason = "/", msg
+	for strings.HasPrefix(reason, "validating ") {
+		loc, rest, ok := strings.Cut(strings.TrimPrefix(reason, "validating "), ": ")
+		if !ok {
+			break
+		}
+		if loc != "root" {
+			path = loc
+		}
+		reason = rest
+	}
+	return path, reason
+}
@@ -0,0 +1,79 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+var rowsFormat = &OutputFormat{
+	Type: "json_schema",
+	Schema: map[string]any{
+		"type":     "object",
+		"required": []any{"rows"},
+		"properties": map[string]any{
+			"rows": map[string]any{
+				"type": "array",
+				"items": map[string]any{
+					"type":       "object",
+					"properties": map[string]any{"id": map[string]any{"type": "integer"}},
+				},
+			},
+		},
+	},
+}
+
+func TestOutputFormat_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		wantPath string
+	}{
+		{"conforming", `{"rows":[{"id":1},{"id":2}]}`, ""},
+		{"wrong item type", `{"rows":[{"id":1},{"id":"2"}]}`, "/properties/rows/items/properties/id"},
+		{"missing required", `{}`, "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output any
+			if err := json.Unmarshal([]byte(tt.output), &output); err != nil {
+				t.Fatal(err)
+			}
+			err := rowsFormat.Validate(output)
+			if tt.wantPath == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var schemaErr *SchemaValidationError
+			if !errors.As(err, &schemaErr) || schemaErr.Path != tt.wantPath || schemaErr.Reason == "" {
+				t.Fatalf("expected *SchemaValidationError at %s, got %#v", tt.wantPath, err)
+			}
+		})
+	}
+}
+
+func TestRun_ResponseSchemaValidation(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"","structured_output":{"rows":[{"id":"one"}]}}'
+      exit 0 ;;
+  esac
+done
+`)
+	ctx := context.Background()
+	if _, err := Run(ctx, "hi", WithClaudeExecutable(exe), WithOutputFormat(rowsFormat)); err != nil {
+		t.Fatalf("expected no validation without the option, got %v", err)
+	}
+	result, err := Run(ctx, "hi", WithClaudeExecutable(exe), WithOutputFormat(rowsFormat), WithResponseSchemaValidation())
+	var schemaErr *SchemaValidationError
+	if !errors.As(err, &schemaErr) {
+		t.Fatalf("expected *SchemaValidationError, got %T: %v", err, err)
+	}
+	if result == nil {
+		t.Fatal("expected the result to be returned alongside the error")
+	}
+}
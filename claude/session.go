@@ -3,6 +3,17 @@ package claude
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reconnect backoff used by WithSessionAutoReconnect: the first retry waits
+// reconnectBaseDelay and each subsequent retry doubles the delay.
+var (
+	reconnectMaxAttempts = 5
+	reconnectBaseDelay   = 250 * time.Millisecond
 )
 
 // Session maintains a persistent Claude subprocess for multi-turn conversations.
@@ -27,7 +38,19 @@ import (
 //	    if event.Type == claude.TypeResult    { break }
 //	}
 type Session struct {
+	ctx  context.Context
+	opts *Options
+
+	mu     sync.Mutex
 	stream *Stream
+
+	// summary seeds the system prompt after WithAutoCompaction compacted the
+	// conversation. Guarded by mu.
+	summary string
+
+	// stop is closed by Close to end the keep-alive loop.
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 // NewSession creates a new persistent Claude session. The subprocess is started
@@ -41,82 +64,290 @@ func NewSession(ctx context.Context, opts ...Option) (*Session, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Session{stream: stream}, nil
+	s := &Session{ctx: ctx, opts: o, stream: stream, stop: make(chan struct{})}
+	if o.KeepAlive > 0 {
+		go s.keepAlive(o.KeepAlive)
+	}
+	return s, nil
+}
+
+// keepAlive pings the current subprocess every interval until the session is
+// closed or its context is cancelled.
+func (s *Session) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.stop:
+			return
+		case <-s.ctx.Done():
+			return
+		}
+		if stream := s.current(); !stream.exited() && !stream.closeRequested() {
+			stream.ping(interval)
+		}
+	}
+}
+
+// Alive reports whether the subprocess is still running and accepting
+// messages. With WithKeepAlive it also reports false when the most recent
+// liveness probe went unanswered, which catches a hung process as well as a
+// dead one between turns.
+func (s *Session) Alive() bool {
+	stream := s.current()
+	return !stream.exited() && !stream.closeRequested() && !stream.unresponsive.Load()
 }
 
 // Send sends a user message and starts a new turn.
 // Call this before ranging over Events() for each turn.
+//
+// If the subprocess has exited, Send returns a *SessionClosedError whose
+// Crashed field distinguishes a crash from a clean Close. With
+// WithSessionAutoReconnect, a subprocess that crashed since the previous turn
+// is instead re-spawned (resuming the last known session ID) and the message
+// is retried on the new subprocess. Call Events() again after Send so you
+// range over the new subprocess's channel.
 func (s *Session) Send(msg string) error {
-	return s.stream.SendUserMessage(msg)
+	return s.SendWithID(msg, "")
+}
+
+// SendWithID is like Send but tags the turn with id: every event it produces,
+// up to and including its TypeResult, carries id in Event.CorrelationID. Use it
+// to match results to requests when several sends are in flight. The ID stays
+// in the SDK; it is not sent to the CLI. WithConcurrentSessionGuard rules out
+// sends in flight at once.
+func (s *Session) SendWithID(msg, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.awaitIdle(); err != nil {
+		return err
+	}
+
+	if s.stream.exited() || s.stream.closeRequested() {
+		if !s.shouldReconnect() {
+			return s.stream.closedError()
+		}
+		if err := s.reconnect(); err != nil {
+			return err
+		}
+	}
+	if err := s.compactIfNeeded(); err != nil {
+		return err
+	}
+
+	err := s.sendTurn(msg, id)
+	if err == nil {
+		return nil
+	}
+	if s.stream.closeRequested() {
+		return s.stream.closedError()
+	}
+
+	// The write may have raced with the subprocess dying; wait for the reader
+	// goroutine to observe the exit before deciding what to do.
+	select {
+	case <-s.stream.done:
+	case <-s.ctx.Done():
+		return err
+	}
+	if !s.shouldReconnect() {
+		return s.stream.closedError()
+	}
+	if err := s.reconnect(); err != nil {
+		return err
+	}
+	return s.sendTurn(msg, id)
+}
+
+// sendTurn writes msg and arms the per-turn deadline. Callers must hold s.mu.
+func (s *Session) sendTurn(msg, id string) error {
+	if err := s.stream.sendCorrelatedTurn(msg, id); err != nil {
+		return err
+	}
+	if s.opts.PerTurnTimeout > 0 {
+		s.stream.startTurnTimer(s.opts.PerTurnTimeout)
+	} else {
+		s.stream.clearTurnErr()
+	}
+	return nil
 }
 
+// TurnErr returns a *TurnTimeoutError when the most recent turn was
+// interrupted by WithPerTurnTimeout, a *ToolTimeoutError when it was
+// interrupted by WithToolTimeout, and nil otherwise. Check it after the
+// turn's TypeResult arrives; it is reset by the next Send.
+func (s *Session) TurnErr() error {
+	return s.current().lastTurnErr()
+}
+
+// RunSlashCommand starts a new turn that invokes the named slash command (e.g.
+// "deploy" or "/deploy") with the given arguments. The command is sent as a
+// "/name args" user message, which the CLI expands instead of passing it to the
+// model as plain text. Range over Events() for the turn as with Send.
+func (s *Session) RunSlashCommand(name, args string) error {
+	msg, err := slashCommand(name, args)
+	if err != nil {
+		return err
+	}
+	return s.Send(msg)
+}
+
+// slashCommand formats a slash command invocation as a user message.
+func slashCommand(name, args string) (string, error) {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "/")
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return "", fmt.Errorf("claude: invalid slash command name %q", name)
+	}
+	if args = strings.TrimSpace(args); args != "" {
+		return "/" + name + " " + args, nil
+	}
+	return "/" + name, nil
+}
+
+// shouldReconnect reports whether the current subprocess died on its own and
+// auto-reconnect is enabled. Callers must hold s.mu.
+func (s *Session) shouldReconnect() bool {
+	return s.opts.SessionAutoReconnect && s.stream.exited() && !s.stream.closeRequested()
+}
+
+// reconnect re-spawns the subprocess, resuming the last known session ID, with
+// exponential backoff between attempts. Callers must hold s.mu.
+func (s *Session) reconnect() error {
+	opts := s.spawnOptions()
+	if id := s.stream.SessionID(); id != "" {
+		opts.ResumeSessionID = id
+		opts.CustomSessionID = ""
+		opts.Continue = false
+		opts.ForkSession = false
+	}
+
+	delay := reconnectBaseDelay
+	var err error
+	for attempt := 0; attempt < reconnectMaxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(delay):
+				delay *= 2
+			case <-s.ctx.Done():
+				return s.ctx.Err()
+			}
+		}
+		var stream *Stream
+		if stream, err = spawnSession(s.ctx, opts); err == nil {
+			s.stream = stream
+			return nil
+		}
+	}
+	return fmt.Errorf("claude: session reconnect: %w", err)
+}
+
+// current returns the active stream.
+func (s *Session) current() *Stream {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stream
+}
+
+// RequestID returns the session's correlation ID. It is stable across
+// auto-reconnects.
+func (s *Session) RequestID() string { return s.current().RequestID() }
+
+// SessionID returns the most recent session ID reported by the CLI.
+func (s *Session) SessionID() string { return s.current().SessionID() }
+
 // Events returns the persistent event channel. Range over it until TypeResult
 // to consume one turn's events, then call Send for the next turn.
 // The channel is closed when the session ends (subprocess exits or Close is called).
 func (s *Session) Events() <-chan Event {
-	return s.stream.Events()
+	return s.current().Events()
+}
+
+// SoftStop lets the in-flight turn finish, then ends the session. See
+// Stream.SoftStop; use Close to stop immediately.
+func (s *Session) SoftStop() error {
+	return s.current().SoftStop()
 }
 
 // Close gracefully shuts down the session.
 func (s *Session) Close() error {
-	return s.stream.Close()
+	s.stopOnce.Do(func() { close(s.stop) })
+	return s.current().Close()
 }
 
 // SetModel asks the claude CLI to switch to a different model mid-session.
-func (s *Session) SetModel(model string) error { return s.stream.SetModel(model) }
+func (s *Session) SetModel(model string) error { return s.current().SetModel(model) }
 
 // SetPermissionMode asks the claude CLI to change the permission mode mid-session.
 func (s *Session) SetPermissionMode(mode PermissionMode) error {
-	return s.stream.SetPermissionMode(mode)
+	return s.current().SetPermissionMode(mode)
 }
 
 // SetMaxThinkingTokens asks the claude CLI to update the max thinking token budget.
-func (s *Session) SetMaxThinkingTokens(n int) error { return s.stream.SetMaxThinkingTokens(n) }
+func (s *Session) SetMaxThinkingTokens(n int) error { return s.current().SetMaxThinkingTokens(n) }
 
 // RewindFiles asks the CLI to rewind files to the state at the given user message ID.
 func (s *Session) RewindFiles(userMessageID string) error {
-	return s.stream.RewindFiles(userMessageID)
+	return s.current().RewindFiles(userMessageID)
+}
+
+// Capabilities blocks until the CLI's init message arrives and returns what
+// the session supports.
+func (s *Session) Capabilities() (Capabilities, error) {
+	return s.current().Capabilities()
 }
 
 // SupportedModels queries the CLI for the list of supported models.
 func (s *Session) SupportedModels() (json.RawMessage, error) {
-	return s.stream.SupportedModels()
+	return s.current().SupportedModels()
 }
 
 // SupportedCommands queries the CLI for the list of supported commands.
 func (s *Session) SupportedCommands() (json.RawMessage, error) {
-	return s.stream.SupportedCommands()
+	return s.current().SupportedCommands()
 }
 
 // SupportedAgents queries the CLI for the list of supported agents.
 func (s *Session) SupportedAgents() (json.RawMessage, error) {
-	return s.stream.SupportedAgents()
+	return s.current().SupportedAgents()
 }
 
 // AccountInfo queries the CLI for the current account information.
 func (s *Session) AccountInfo() (json.RawMessage, error) {
-	return s.stream.AccountInfo()
+	return s.current().AccountInfo()
 }
 
 // StopTask asks the CLI to stop a running background task.
 func (s *Session) StopTask(taskID string) error {
-	return s.stream.StopTask(taskID)
+	return s.current().StopTask(taskID)
 }
 
 // ReconnectMcpServer asks the CLI to reconnect a named MCP server.
 func (s *Session) ReconnectMcpServer(serverName string) error {
-	return s.stream.ReconnectMcpServer(serverName)
+	return s.current().ReconnectMcpServer(serverName)
 }
 
 // ToggleMcpServer asks the CLI to enable or disable a named MCP server.
 func (s *Session) ToggleMcpServer(serverName string, enabled bool) error {
-	return s.stream.ToggleMcpServer(serverName, enabled)
+	return s.current().ToggleMcpServer(serverName, enabled)
 }
 
 // SetMcpServers asks the CLI to replace the current MCP server configuration.
 func (s *Session) SetMcpServers(servers map[string]any) error {
-	return s.stream.SetMcpServers(servers)
+	return s.current().SetMcpServers(servers)
+}
+
+// Control sends an arbitrary control_request and returns the raw response.
+// See Stream.Control.
+func (s *Session) Control(subtype string, payload map[string]any) (json.RawMessage, error) {
+	return s.current().Control(subtype, payload)
 }
 
 // Interrupt initiates graceful shutdown. Equivalent to Close.
-func (s *Session) Interrupt() error { return s.stream.Interrupt() }
+func (s *Session) Interrupt() error { return s.current().Interrupt() }
+
+// InterruptWithReason is Interrupt, recording why. See Stream.InterruptWithReason.
+func (s *Session) InterruptWithReason(reason string) error {
+	return s.current().InterruptWithReason(reason)
+}
@@ -0,0 +1,541 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFakeCLI writes an executable shell script standing in for the claude
+// binary and returns its path.
+func writeFakeCLI(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "claude")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatalf("write fake cli: %v", err)
+	}
+	return path
+}
+
+// drainTurn ranges over events until TypeResult or channel close.
+func drainTurn(t *testing.T, events <-chan Event) {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok || e.Type == TypeResult {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for turn to finish")
+		}
+	}
+}
+
+func TestSession_AutoReconnectResumesSession(t *testing.T) {
+	// The fake CLI answers the first user message and then crashes.
+	exe := writeFakeCLI(t, `echo "$@" >> "$ARGS_FILE"
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","session_id":"sess-1"}'
+      exit 1 ;;
+  esac
+done
+`)
+	argsFile := filepath.Join(t.TempDir(), "args")
+
+	oldDelay := reconnectBaseDelay
+	reconnectBaseDelay = time.Millisecond
+	defer func() { reconnectBaseDelay = oldDelay }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	session, err := NewSession(ctx,
+		WithClaudeExecutable(exe),
+		WithEnv(map[string]string{"ARGS_FILE": argsFile}),
+		WithSessionAutoReconnect(),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Send("first"); err != nil {
+		t.Fatalf("first Send: %v", err)
+	}
+	events := session.Events()
+	drainTurn(t, events)
+	for range events {
+		// Wait for the subprocess to exit.
+	}
+	if got := session.SessionID(); got != "sess-1" {
+		t.Fatalf("expected session ID sess-1, got %q", got)
+	}
+
+	if err := session.Send("second"); err != nil {
+		t.Fatalf("second Send: %v", err)
+	}
+	drainTurn(t, session.Events())
+
+	b, err := os.ReadFile(argsFile)
+	if err != nil {
+		t.Fatalf("read args: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 spawns, got %d", len(lines))
+	}
+	if !strings.Contains(lines[1], "--resume sess-1") {
+		t.Fatalf("expected reconnect to resume sess-1, got %q", lines[1])
+	}
+}
+
+func TestSession_AutoReconnectAfterFailedWrite(t *testing.T) {
+	// The first fake CLI answers one turn, then closes stdin and lingers before
+	// crashing, so the next Send's write fails while the subprocess still looks
+	// alive. The respawned one answers normally.
+	exe := writeFakeCLI(t, `if [ ! -f "$SPAWNED" ]; then
+  touch "$SPAWNED"
+  IFS= read -r line
+  while IFS= read -r line; do
+    case "$line" in
+      *'"type":"user"'*)
+        echo '{"type":"result","subtype":"success","session_id":"sess-1"}'
+        exec 0<&-
+        sleep 0.5
+        exit 1 ;;
+    esac
+  done
+fi
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*) echo '{"type":"result","subtype":"success","session_id":"sess-1"}' ;;
+  esac
+done
+`)
+	oldDelay := reconnectBaseDelay
+	reconnectBaseDelay = time.Millisecond
+	defer func() { reconnectBaseDelay = oldDelay }()
+
+	session, err := NewSession(context.Background(),
+		WithClaudeExecutable(exe),
+		WithEnv(map[string]string{"SPAWNED": filepath.Join(t.TempDir(), "spawned")}),
+		WithSessionAutoReconnect(),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Send("first"); err != nil {
+		t.Fatalf("first Send: %v", err)
+	}
+	drainTurn(t, session.Events())
+
+	sent := make(chan error, 1)
+	go func() { sent <- session.Send("second") }()
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatalf("second Send: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send deadlocked on the reconnect path")
+	}
+	drainTurn(t, session.Events())
+}
+
+func TestSession_SendAfterCrashReturnsSessionClosedError(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*) exit 3 ;;
+  esac
+done
+`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	session, err := NewSession(ctx, WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Send("first"); err != nil {
+		t.Fatalf("first Send: %v", err)
+	}
+	for range session.Events() {
+		// Wait for the subprocess to exit.
+	}
+
+	err = session.Send("second")
+	var closedErr *SessionClosedError
+	if !errors.As(err, &closedErr) {
+		t.Fatalf("expected *SessionClosedError, got %T: %v", err, err)
+	}
+	if !closedErr.Crashed {
+		t.Fatal("expected Crashed to be true")
+	}
+}
+
+func TestSession_SendAfterCloseReturnsSessionClosedError(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do :; done
+`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	session, err := NewSession(ctx, WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	_ = session.Close()
+
+	err = session.Send("hello")
+	var closedErr *SessionClosedError
+	if !errors.As(err, &closedErr) {
+		t.Fatalf("expected *SessionClosedError, got %T: %v", err, err)
+	}
+	if closedErr.Crashed {
+		t.Fatal("expected Crashed to be false after Close")
+	}
+}
+
+func TestSlashCommand(t *testing.T) {
+	tests := []struct {
+		name, args, want string
+		wantErr          bool
+	}{
+		{"deploy", "staging", "/deploy staging", false},
+		{"/deploy", "", "/deploy", false},
+		{" review ", "  PR 42 ", "/review PR 42", false},
+		{"", "x", "", true},
+		{"bad name", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := slashCommand(tt.name, tt.args)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("slashCommand(%q, %q) error = %v, wantErr %v", tt.name, tt.args, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Fatalf("slashCommand(%q, %q) = %q, want %q", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestSession_SoftStopDeliversInFlightResult(t *testing.T) {
+	// The fake CLI answers after a short delay and exits once stdin closes.
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      sleep 0.2
+      echo '{"type":"result","subtype":"success","result":"finished","session_id":"s1"}' ;;
+  esac
+done
+`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	session, err := NewSession(ctx, WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Send("work"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := session.SoftStop(); err != nil {
+		t.Fatalf("SoftStop: %v", err)
+	}
+
+	var result *Result
+	for event := range session.Events() {
+		switch {
+		case event.Type == TypeResult:
+			result = event.Result
+		case event.System != nil && event.System.Subtype == "error":
+			t.Fatalf("unexpected error event: %s", event.System.Message)
+		}
+	}
+	if result == nil || result.Result != "finished" {
+		t.Fatalf("expected in-flight result to be delivered, got %+v", result)
+	}
+
+	var closedErr *SessionClosedError
+	if err := session.Send("more"); !errors.As(err, &closedErr) || closedErr.Crashed {
+		t.Fatalf("expected clean *SessionClosedError, got %v", err)
+	}
+}
+
+func TestSession_KeepAlive(t *testing.T) {
+	// The responsive fake CLI acks every mcp_status probe; the hung one reads
+	// stdin but never replies.
+	responsive := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"subtype":"mcp_status"'*)
+      id=$(printf '%s' "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+      echo '{"type":"control_response","request_id":"'"$id"'","response":{"subtype":"success"}}' ;;
+  esac
+done
+`)
+	hung := writeFakeCLI(t, `while IFS= read -r line; do :; done
+`)
+
+	for _, tc := range []struct {
+		name  string
+		exe   string
+		alive bool
+	}{
+		{"responsive", responsive, true},
+		{"hung", hung, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			session, err := NewSession(context.Background(),
+				WithClaudeExecutable(tc.exe),
+				WithKeepAlive(50*time.Millisecond),
+			)
+			if err != nil {
+				t.Fatalf("NewSession: %v", err)
+			}
+			defer session.Close()
+
+			if !session.Alive() {
+				t.Fatal("expected a fresh session to be alive")
+			}
+			time.Sleep(300 * time.Millisecond)
+			if got := session.Alive(); got != tc.alive {
+				t.Fatalf("Alive() = %v, want %v", got, tc.alive)
+			}
+		})
+	}
+}
+
+func TestSession_PerTurnTimeout(t *testing.T) {
+	// Prompts containing "slow" only finish once the CLI is interrupted; the
+	// interrupt ends the turn with an error result but keeps the process alive.
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"subtype":"interrupt"'*)
+      id=$(printf '%s' "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+      echo '{"type":"control_response","request_id":"'"$id"'","response":{"subtype":"success"}}'
+      echo '{"type":"result","subtype":"error_during_execution","is_error":true,"session_id":"s1"}' ;;
+    *'"type":"user"'*)
+      case "$line" in
+        *slow*) ;;
+        *) echo '{"type":"result","subtype":"success","result":"ok","session_id":"s1"}' ;;
+      esac ;;
+  esac
+done
+`)
+	session, err := NewSession(context.Background(),
+		WithClaudeExecutable(exe),
+		WithPerTurnTimeout(100*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Send("slow"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	drainTurn(t, session.Events())
+	var timeoutErr *TurnTimeoutError
+	if !errors.As(session.TurnErr(), &timeoutErr) {
+		t.Fatalf("expected *TurnTimeoutError, got %v", session.TurnErr())
+	}
+
+	if err := session.Send("fast"); err != nil {
+		t.Fatalf("Send after timeout: %v", err)
+	}
+	drainTurn(t, session.Events())
+	if err := session.TurnErr(); err != nil {
+		t.Fatalf("expected no turn error, got %v", err)
+	}
+}
+
+func TestSession_CancelOnError(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"error_during_execution","is_error":true,"session_id":"s1"}' ;;
+  esac
+done
+`)
+	session, err := NewSession(context.Background(), WithClaudeExecutable(exe), WithCancelOnError())
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.Send("hi"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case _, ok := <-session.Events():
+			if !ok {
+				if session.Alive() {
+					t.Fatal("expected the session to be shut down")
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("expected the events channel to close after the error result")
+		}
+	}
+}
+
+func TestSession_SendWithIDCorrelatesEvents(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      sleep 0.05
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"hi"}]},"session_id":"s1"}'
+      echo '{"type":"result","subtype":"success","result":"ok","session_id":"s1"}' ;;
+  esac
+done
+`)
+	session, err := NewSession(context.Background(), WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	if err := session.SendWithID("first", "req-1"); err != nil {
+		t.Fatalf("SendWithID: %v", err)
+	}
+	if err := session.Send("second"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if err := session.SendWithID("third", "req-3"); err != nil {
+		t.Fatalf("SendWithID: %v", err)
+	}
+
+	var got []string
+	timeout := time.After(5 * time.Second)
+	for len(got) < 6 {
+		select {
+		case e := <-session.Events():
+			got = append(got, string(e.Type)+":"+e.CorrelationID)
+		case <-timeout:
+			t.Fatalf("timed out; got %v", got)
+		}
+	}
+	want := "assistant:req-1 result:req-1 assistant: result: assistant:req-3 result:req-3"
+	if strings.Join(got, " ") != want {
+		t.Fatalf("expected %q, got %q", want, strings.Join(got, " "))
+	}
+}
+
+func TestSession_StampsSessionIDOnUserMessages(t *testing.T) {
+	// Echoes the session_id of each user message back as the result text.
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      sid=$(printf '%s' "$line" | sed 's/.*"session_id":"\([^"]*\)".*/\1/')
+      echo '{"type":"result","subtype":"success","result":"'"$sid"'","session_id":"s-reported"}' ;;
+  esac
+done
+`)
+	session, err := NewSession(context.Background(), WithClaudeExecutable(exe), WithSessionIDToResume("s-resumed"))
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	defer session.Close()
+
+	var stamped []string
+	for _, msg := range []string{"first", "second"} {
+		if err := session.Send(msg); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+		for e := range session.Events() {
+			if e.Result != nil {
+				stamped = append(stamped, e.Result.Result)
+				break
+			}
+		}
+	}
+	if want := "s-resumed s-reported"; strings.Join(stamped, " ") != want {
+		t.Fatalf("expected stamped session IDs %q, got %q", want, strings.Join(stamped, " "))
+	}
+}
+
+func TestSession_AutoCompaction(t *testing.T) {
+	// Each spawn logs its initialize request; every turn reports a large
+	// context, and the summarization turn answers with a fixed summary.
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"subtype":"initialize"'*)
+      printf '%s\n' "$line" >> "$INIT_FILE" ;;
+    *'Summarize our conversation'*)
+      echo '{"type":"result","subtype":"success","result":"MODEL-SUMMARY"}' ;;
+    *'"type":"user"'*)
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"hi"}],"usage":{"input_tokens":10,"cache_read_input_tokens":9000,"output_tokens":5}}}'
+      echo '{"type":"result","subtype":"success","result":"ok","session_id":"s1"}' ;;
+  esac
+done
+`)
+	for _, tc := range []struct {
+		name       string
+		summarizer func([]Event) string
+		want       string
+	}{
+		{"summarizer", func(transcript []Event) string {
+			return fmt.Sprintf("SUMMARY-OF-%d-EVENTS", len(transcript))
+		}, "SUMMARY-OF-2-EVENTS"},
+		{"model", nil, "MODEL-SUMMARY"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			initFile := filepath.Join(t.TempDir(), "init")
+			session, err := NewSession(t.Context(),
+				WithClaudeExecutable(exe),
+				WithEnv(map[string]string{"INIT_FILE": initFile}),
+				WithAppendSystemPrompt("Be brief."),
+				WithAutoCompaction(8000, tc.summarizer),
+			)
+			if err != nil {
+				t.Fatalf("NewSession: %v", err)
+			}
+			defer session.Close()
+
+			for _, msg := range []string{"first", "second"} {
+				if err := session.Send(msg); err != nil {
+					t.Fatalf("Send(%q): %v", msg, err)
+				}
+				drainTurn(t, session.Events())
+			}
+
+			b, err := os.ReadFile(initFile)
+			if err != nil {
+				t.Fatalf("read init log: %v", err)
+			}
+			inits := strings.Split(strings.TrimSpace(string(b)), "\n")
+			if len(inits) != 2 {
+				t.Fatalf("expected a second spawn after compaction, got %d", len(inits))
+			}
+			var init struct {
+				Request struct {
+					AppendSystemPrompt string `json:"appendSystemPrompt"`
+				} `json:"request"`
+			}
+			if err := json.Unmarshal([]byte(inits[1]), &init); err != nil {
+				t.Fatal(err)
+			}
+			got := init.Request.AppendSystemPrompt
+			if !strings.HasPrefix(got, "Be brief.") || !strings.HasSuffix(got, tc.want) {
+				t.Fatalf("expected the summary appended to the system prompt, got %q", got)
+			}
+		})
+	}
+}
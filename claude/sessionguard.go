@@ -0,0 +1,58 @@
+package claude
+
+// SessionGuard selects what WithConcurrentSessionGuard does with a Send made
+// while an earlier turn is still in progress.
+type SessionGuard string
+
+const (
+	// SessionGuardError makes the Send return a *SessionBusyError.
+	SessionGuardError SessionGuard = "error"
+	// SessionGuardBlock makes the Send wait until the turn in progress ends.
+	SessionGuardBlock SessionGuard = "block"
+)
+
+// awaitIdle applies opts.SessionGuard before a new turn is sent. Callers must
+// hold s.mu, which is released while SessionGuardBlock waits; turns are only
+// sent under s.mu, so the session is still idle when awaitIdle returns nil.
+func (s *Session) awaitIdle() error {
+	for s.opts.SessionGuard != "" && !s.stream.exited() {
+		idle := s.stream.turnInProgress()
+		if idle == nil {
+			return nil
+		}
+		if s.opts.SessionGuard != SessionGuardBlock {
+			return &SessionBusyError{}
+		}
+		stream := s.stream
+		s.mu.Unlock()
+		select {
+		case <-idle:
+		case <-stream.done:
+		case <-s.ctx.Done():
+			s.mu.Lock()
+			return s.ctx.Err()
+		}
+		s.mu.Lock()
+	}
+	return nil
+}
+
+// turnInProgress returns a channel that is closed once every turn sent so far
+// has produced its result, or nil when none is pending.
+func (s *Stream) turnInProgress() <-chan struct{} {
+	s.turnIDsMu.Lock()
+	defer s.turnIDsMu.Unlock()
+	return s.turnIdle
+}
+
+// updateTurnIdle opens turnIdle when the first turn is queued and closes it
+// when the last one ends. Callers must hold s.turnIDsMu.
+func (s *Stream) updateTurnIdle() {
+	switch {
+	case len(s.turnIDs) > 0 && s.turnIdle == nil:
+		s.turnIdle = make(chan struct{})
+	case len(s.turnIDs) == 0 && s.turnIdle != nil:
+		close(s.turnIdle)
+		s.turnIdle = nil
+	}
+}
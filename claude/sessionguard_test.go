@@ -0,0 +1,84 @@
+package claude
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// gatedSession starts a session whose fake CLI answers each turn only once the
+// returned file has been created.
+func gatedSession(t *testing.T, mode SessionGuard) (*Session, string) {
+	t.Helper()
+	gate := filepath.Join(t.TempDir(), "go")
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      while [ ! -f "$GATE" ]; do sleep 0.02; done
+      echo '{"type":"result","subtype":"success","result":"ok","session_id":"s1","is_error":false}' ;;
+  esac
+done
+`)
+	session, err := NewSession(context.Background(),
+		WithClaudeExecutable(exe),
+		WithEnv(map[string]string{"GATE": gate}),
+		WithConcurrentSessionGuard(mode),
+	)
+	if err != nil {
+		t.Fatalf("NewSession: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+	return session, gate
+}
+
+func TestConcurrentSessionGuard_Error(t *testing.T) {
+	session, gate := gatedSession(t, SessionGuardError)
+	if err := session.Send("first"); err != nil {
+		t.Fatalf("first Send: %v", err)
+	}
+	var busy *SessionBusyError
+	if err := session.Send("second"); !errors.As(err, &busy) {
+		t.Fatalf("expected *SessionBusyError, got %v", err)
+	}
+
+	if err := os.WriteFile(gate, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	drainTurn(t, session.Events())
+	if err := session.Send("third"); err != nil {
+		t.Fatalf("Send after the turn ended: %v", err)
+	}
+	drainTurn(t, session.Events())
+}
+
+func TestConcurrentSessionGuard_Block(t *testing.T) {
+	session, gate := gatedSession(t, SessionGuardBlock)
+	if err := session.Send("first"); err != nil {
+		t.Fatalf("first Send: %v", err)
+	}
+	sent := make(chan error, 1)
+	go func() { sent <- session.Send("second") }()
+
+	select {
+	case err := <-sent:
+		t.Fatalf("second Send returned during the first turn: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(gate, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	drainTurn(t, session.Events())
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatalf("second Send: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second Send still blocked after the first turn ended")
+	}
+	drainTurn(t, session.Events())
+}
@@ -5,16 +5,35 @@ import (
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"time"
 )
 
 // SessionSummary holds metadata about a stored session as returned by
-// `claude sessions list --output-format json`.
+// `claude sessions list --output-format json`. Fields the CLI version does not
+// report are left empty.
 type SessionSummary struct {
-	ID        string `json:"id"`
-	Project   string `json:"project,omitempty"`
+	ID      string `json:"id"`
+	Project string `json:"project,omitempty"`
+	// CreatedAt and UpdatedAt are RFC 3339 timestamps; UpdatedAt is the
+	// last-modified time. See LastModified.
 	CreatedAt string `json:"created_at,omitempty"`
 	UpdatedAt string `json:"updated_at,omitempty"`
-	Summary   string `json:"summary,omitempty"`
+	// Model is the model the session last ran with.
+	Model string `json:"model,omitempty"`
+	// Title is the session's title, set with WithTitle or generated by the CLI.
+	Title   string `json:"title,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+// LastModified parses UpdatedAt, falling back to CreatedAt. It returns the
+// zero time when neither is set or parseable.
+func (s SessionSummary) LastModified() time.Time {
+	for _, v := range []string{s.UpdatedAt, s.CreatedAt} {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
 }
 
 // ListSessions runs `claude sessions list --output-format json` and returns
@@ -26,8 +45,12 @@ func ListSessions(ctx context.Context, opts ...Option) ([]SessionSummary, error)
 		opt(o)
 	}
 
+	executable, err := resolveExecutable(o.ClaudeExecutable, o.CWD)
+	if err != nil {
+		return nil, err
+	}
 	args := []string{"sessions", "list", "--output-format", "json"}
-	cmd := exec.CommandContext(ctx, o.ClaudeExecutable, args...)
+	cmd := exec.CommandContext(ctx, executable, args...)
 	cmd.Env = buildEnv(o)
 	if o.CWD != "" {
 		cmd.Dir = o.CWD
@@ -3,6 +3,7 @@ package claude
 import (
 	"context"
 	"testing"
+	"time"
 )
 
 func TestGetSessionMessages_EmptyID(t *testing.T) {
@@ -14,3 +15,26 @@ func TestGetSessionMessages_EmptyID(t *testing.T) {
 		t.Fatalf("unexpected error message: %s", err.Error())
 	}
 }
+
+func TestListSessions(t *testing.T) {
+	exe := writeFakeCLI(t, `[ "$1 $2 $3 $4" = "sessions list --output-format json" ] || exit 1
+echo '[{"id":"s1","updated_at":"2026-10-01T12:00:00Z","model":"claude-sonnet-4-6","title":"Refactor parser"},{"id":"s2","created_at":"2026-09-30T08:00:00Z"}]'
+`)
+	sessions, err := ListSessions(context.Background(), WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("expected 2 sessions, got %d", len(sessions))
+	}
+	s := sessions[0]
+	if s.ID != "s1" || s.Model != "claude-sonnet-4-6" || s.Title != "Refactor parser" {
+		t.Fatalf("unexpected session: %+v", s)
+	}
+	if want := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC); !s.LastModified().Equal(want) {
+		t.Fatalf("expected LastModified %v, got %v", want, s.LastModified())
+	}
+	if sessions[1].LastModified().IsZero() {
+		t.Fatal("expected LastModified to fall back to CreatedAt")
+	}
+}
@@ -0,0 +1,30 @@
+package claude
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchSignals relays sigs to the run until done is closed (WithInterruptOnSignal):
+// the first signal interrupts the stream, the second kills the subprocess.
+// Registration happens before it returns, so a signal sent afterwards is never
+// missed; it is removed once the goroutine exits.
+func watchSignals(sigs []os.Signal, stream *Stream, p *os.Process, done <-chan struct{}) {
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, sigs...)
+	go func() {
+		defer signal.Stop(ch)
+		select {
+		case <-ch:
+			stream.interrupt()
+		case <-done:
+			return
+		}
+		select {
+		case <-ch:
+			signalProcessGroup(p, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+}
@@ -0,0 +1,40 @@
+//go:build unix
+
+package claude
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestWithInterruptOnSignal(t *testing.T) {
+	// Ignores SIGTERM so only the second signal's SIGKILL can stop it.
+	exe := writeFakeCLI(t, `trap '' TERM
+exec sleep 30
+`)
+	stream, err := Query(t.Context(), "hi", WithClaudeExecutable(exe), WithInterruptOnSignal(syscall.SIGUSR1))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	start := time.Now()
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-stream.interruptCh:
+	case <-time.After(2 * time.Second):
+		t.Fatal("first signal did not interrupt the stream")
+	}
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	for range stream.Events() {
+	}
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Fatalf("second signal did not kill the subprocess (took %v)", elapsed)
+	}
+	if err := stream.Err(); err != nil {
+		t.Fatalf("expected a clean end after the interrupt, got %v", err)
+	}
+}
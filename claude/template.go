@@ -0,0 +1,51 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// PromptTemplate is a reusable prompt with {{.name}} placeholders, rendered
+// with text/template. Rendering is strict: referencing a variable that is not
+// supplied is an error rather than an empty substitution, so typos surface
+// immediately.
+//
+//	tmpl, err := claude.NewPromptTemplate("Summarise {{.file}} in {{.words}} words.")
+//	result, err := claude.RunTemplate(ctx, tmpl, map[string]any{"file": "README.md", "words": 50})
+type PromptTemplate struct {
+	tmpl *template.Template
+}
+
+// NewPromptTemplate parses tmpl. The full text/template syntax is available,
+// e.g. {{range}} over a slice variable.
+func NewPromptTemplate(tmpl string) (*PromptTemplate, error) {
+	t, err := template.New("prompt").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("claude: parse prompt template: %w", err)
+	}
+	return &PromptTemplate{tmpl: t}, nil
+}
+
+// Render substitutes vars into the template. It returns an error naming the
+// variable when one referenced by the template is missing from vars.
+func (p *PromptTemplate) Render(vars map[string]any) (string, error) {
+	if vars == nil {
+		vars = map[string]any{}
+	}
+	var b strings.Builder
+	if err := p.tmpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("claude: render prompt template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// RunTemplate renders tmpl with vars and runs the resulting prompt with Run.
+func RunTemplate(ctx context.Context, tmpl *PromptTemplate, vars map[string]any, opts ...Option) (*Result, error) {
+	prompt, err := tmpl.Render(vars)
+	if err != nil {
+		return nil, err
+	}
+	return Run(ctx, prompt, opts...)
+}
@@ -0,0 +1,60 @@
+package claude
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestPromptTemplate_Render(t *testing.T) {
+	tmpl, err := NewPromptTemplate("Review {{.file}} for {{range $i, $c := .checks}}{{if $i}}, {{end}}{{$c}}{{end}}.")
+	if err != nil {
+		t.Fatalf("NewPromptTemplate: %v", err)
+	}
+	got, err := tmpl.Render(map[string]any{"file": "main.go", "checks": []string{"bugs", "style"}})
+	if err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if want := "Review main.go for bugs, style."; got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
+
+func TestPromptTemplate_MissingVariable(t *testing.T) {
+	tmpl, err := NewPromptTemplate("Hello {{.name}}")
+	if err != nil {
+		t.Fatalf("NewPromptTemplate: %v", err)
+	}
+	_, err = tmpl.Render(map[string]any{"nmae": "typo"})
+	if err == nil || !strings.Contains(err.Error(), "name") {
+		t.Fatalf("expected a missing variable error naming it, got %v", err)
+	}
+	if _, err := NewPromptTemplate("{{.unclosed"); err == nil {
+		t.Fatal("expected a parse error")
+	}
+}
+
+func TestRunTemplate(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      case "$line" in
+        *'Hello Ada'*) echo '{"type":"result","subtype":"success","result":"rendered"}' ;;
+        *) echo '{"type":"result","subtype":"success","result":"raw"}' ;;
+      esac
+      exit 0 ;;
+  esac
+done
+`)
+	tmpl, err := NewPromptTemplate("Hello {{.name}}")
+	if err != nil {
+		t.Fatalf("NewPromptTemplate: %v", err)
+	}
+	r, err := RunTemplate(context.Background(), tmpl, map[string]any{"name": "Ada"}, WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("RunTemplate: %v", err)
+	}
+	if r.Result != "rendered" {
+		t.Fatalf("expected the rendered prompt to be sent, got %q", r.Result)
+	}
+}
@@ -0,0 +1,92 @@
+package claude
+
+import (
+	"io"
+	"sync"
+)
+
+// ThinkingReader returns a reader of the main agent's thinking as it streams,
+// without the answer text, e.g. for a reasoning side panel. Consecutive
+// thinking blocks are separated by a blank line. Read returns io.EOF after the
+// first result, or when the stream ends without one.
+//
+// The text comes from thinking_delta stream events, so
+// WithIncludePartialMessages is required. Thinking is buffered until read, so
+// an idle reader never blocks the stream. Call ThinkingReader before Events()
+// is first consumed; later calls return the same reader.
+func (s *Stream) ThinkingReader() io.Reader {
+	s.thinkingOnce.Do(func() {
+		t := &thinkingBuffer{}
+		t.cond = sync.NewCond(&t.mu)
+		s.thinking.Store(t)
+	})
+	return s.thinking.Load()
+}
+
+// closeThinking ends the ThinkingReader once the stream has ended, creating
+// it first so that later calls get a reader at EOF.
+func (s *Stream) closeThinking() {
+	s.ThinkingReader()
+	s.thinking.Load().close()
+}
+
+// thinkingBuffer collects thinking text for ThinkingReader. Writes never
+// block; Read waits for text or close.
+type thinkingBuffer struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	buf    []byte
+	closed bool
+	blocks int // thinking blocks seen
+}
+
+// observe appends the thinking in e. It runs on the delivery goroutine.
+func (t *thinkingBuffer) observe(e Event) {
+	switch {
+	case e.StreamEvent != nil && e.ParentToolUseID() == "":
+		ev := e.StreamEvent.Event
+		switch {
+		case ev.Type == "content_block_start" && ev.ContentBlock != nil && ev.ContentBlock.Type == "thinking":
+			t.blocks++
+			if t.blocks > 1 {
+				t.write("\n\n")
+			}
+		case ev.Type == "content_block_delta" && ev.Delta != nil && ev.Delta.Type == "thinking_delta":
+			t.write(ev.Delta.Thinking)
+		}
+	case e.Result != nil:
+		t.close()
+	}
+}
+
+func (t *thinkingBuffer) write(s string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed || s == "" {
+		return
+	}
+	t.buf = append(t.buf, s...)
+	t.cond.Broadcast()
+}
+
+func (t *thinkingBuffer) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.closed = true
+	t.cond.Broadcast()
+}
+
+// Read implements io.Reader.
+func (t *thinkingBuffer) Read(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for len(t.buf) == 0 && !t.closed {
+		t.cond.Wait()
+	}
+	if len(t.buf) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, t.buf)
+	t.buf = t.buf[n:]
+	return n, nil
+}
@@ -0,0 +1,100 @@
+package claude
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamThinkingReader(t *testing.T) {
+	lines := []string{
+		`{"type":"stream_event","event":{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"Check the "}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"inputs."}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_start","index":1,"content_block":{"type":"text","text":""}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"The answer"}}}`,
+		`{"type":"stream_event","parent_tool_use_id":"task1","event":{"type":"content_block_start","index":0,"content_block":{"type":"thinking","thinking":""}}}`,
+		`{"type":"stream_event","parent_tool_use_id":"task1","event":{"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"subagent"}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_start","index":2,"content_block":{"type":"thinking","thinking":""}}}`,
+		`{"type":"stream_event","event":{"type":"content_block_delta","index":2,"delta":{"type":"thinking_delta","thinking":"Done."}}}`,
+		`{"type":"result","subtype":"success","result":"The answer","session_id":"s1"}`,
+	}
+	out := filepath.Join(t.TempDir(), "out.jsonl")
+	if err := os.WriteFile(out, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	exe := writeFakeCLI(t, fmt.Sprintf(`while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      cat %q
+      exit 0 ;;
+  esac
+done
+`, out))
+
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe), WithIncludePartialMessages())
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	thinking := stream.ThinkingReader()
+	if stream.ThinkingReader() != thinking {
+		t.Fatal("expected ThinkingReader to return the same reader")
+	}
+	done := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(thinking)
+		done <- string(b)
+	}()
+	for range stream.Events() {
+	}
+	if got, want := <-done, "Check the inputs.\n\nDone."; got != want {
+		t.Fatalf("thinking = %q, want %q", got, want)
+	}
+
+	replay := ReplayFromReader(strings.NewReader(strings.Join(lines, "\n")))
+	thinking = replay.ThinkingReader()
+	go func() {
+		b, _ := io.ReadAll(thinking)
+		done <- string(b)
+	}()
+	for range replay.Events() {
+	}
+	if got, want := <-done, "Check the inputs.\n\nDone."; got != want {
+		t.Fatalf("replayed thinking = %q, want %q", got, want)
+	}
+}
+
+// TestStreamThinkingReader_AfterEnd is a regression test for a reader taken
+// after the stream ended never reaching EOF.
+func TestStreamThinkingReader_AfterEnd(t *testing.T) {
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*) exit 1 ;;
+  esac
+done
+`)
+	stream, err := Query(context.Background(), "hi", WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for range stream.Events() {
+	}
+	read := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(stream.ThinkingReader())
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		if err != nil {
+			t.Fatalf("ReadAll: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("ThinkingReader taken after the stream ended did not reach EOF")
+	}
+}
@@ -0,0 +1,147 @@
+package claude
+
+import (
+	"sync"
+	"time"
+)
+
+// toolTimeoutGrace is how long past WithToolTimeout a call may run before the
+// turn is interrupted, leaving the CLI's own timeout room to fire first. A
+// variable so tests can shorten it.
+var toolTimeoutGrace = 5 * time.Second
+
+// toolWatchdog interrupts the turn when a tool call outlasts its deadline.
+// observe runs on the delivery goroutine, hold and release on the reader
+// goroutine; the timers fire on their own.
+type toolWatchdog struct {
+	stream  *Stream
+	timeout time.Duration
+	mu      sync.Mutex
+	calls   map[string]*toolCall // by tool use ID
+	stopped bool
+}
+
+// toolCall is a tool call being watched. Its timer is nil while it is held.
+type toolCall struct {
+	err   *ToolTimeoutError // nil until the tool_use block is observed
+	timer *time.Timer
+	armed int // incremented by each arm, so a stale timer does not fire
+	held  bool
+}
+
+func newToolWatchdog(s *Stream, timeout time.Duration) *toolWatchdog {
+	return &toolWatchdog{stream: s, timeout: timeout, calls: make(map[string]*toolCall)}
+}
+
+// observe arms a timer for each tool_use block and disarms it at the
+// matching tool_result.
+func (w *toolWatchdog) observe(e Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if e.Assistant != nil {
+		for _, b := range e.Assistant.Message.Content {
+			if b.Type != "tool_use" || b.Name == "Task" || b.Name == "Agent" {
+				continue
+			}
+			c := w.call(b.ID)
+			c.err = &ToolTimeoutError{Tool: b.Name, ToolUseID: b.ID, Timeout: w.timeout}
+			if !c.held {
+				w.arm(c)
+			}
+		}
+	}
+	if e.User != nil {
+		for _, b := range e.User.Message.Content {
+			if c, ok := w.calls[b.ToolUseID]; ok && b.Type == "tool_result" {
+				if c.timer != nil {
+					c.timer.Stop()
+				}
+				delete(w.calls, b.ToolUseID)
+			}
+		}
+	}
+}
+
+// hold pauses the call's deadline while its can_use_tool request is being
+// decided, e.g. by a human, which may arrive before or after its tool_use
+// block is observed.
+func (w *toolWatchdog) hold(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.stopped {
+		return
+	}
+	c := w.call(id)
+	c.held = true
+	if c.timer != nil {
+		c.timer.Stop()
+		c.timer = nil
+	}
+}
+
+// release restarts the call's full timeout once its permission is decided.
+func (w *toolWatchdog) release(id string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c, ok := w.calls[id]
+	if !ok {
+		return
+	}
+	c.held = false
+	if c.err == nil {
+		// The tool_use block has not been observed yet; observe arms it.
+		return
+	}
+	w.arm(c)
+}
+
+// call returns the entry for id, creating it. w.mu must be held.
+func (w *toolWatchdog) call(id string) *toolCall {
+	c, ok := w.calls[id]
+	if !ok {
+		c = &toolCall{}
+		w.calls[id] = c
+	}
+	return c
+}
+
+// arm starts c's timer. w.mu must be held.
+func (w *toolWatchdog) arm(c *toolCall) {
+	if w.stopped {
+		return
+	}
+	c.armed++
+	armed, err := c.armed, c.err
+	c.timer = time.AfterFunc(w.timeout+toolTimeoutGrace, func() { w.fire(c, armed, err) })
+}
+
+// fire records err as the turn's error and interrupts the turn, unless c was
+// disarmed or re-armed since the timer was started.
+func (w *toolWatchdog) fire(c *toolCall, armed int, err *ToolTimeoutError) {
+	w.mu.Lock()
+	pending := w.calls[err.ToolUseID] == c && c.armed == armed && c.timer != nil
+	if pending {
+		delete(w.calls, err.ToolUseID)
+	}
+	w.mu.Unlock()
+	if !pending {
+		return
+	}
+	w.stream.turnMu.Lock()
+	w.stream.turnErr = err
+	w.stream.turnMu.Unlock()
+	_ = w.stream.sendControlRequest("interrupt", nil)
+}
+
+// stop disarms all timers once the stream has ended.
+func (w *toolWatchdog) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	for id, c := range w.calls {
+		if c.timer != nil {
+			c.timer.Stop()
+		}
+		delete(w.calls, id)
+	}
+}
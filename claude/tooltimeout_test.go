@@ -0,0 +1,93 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestBuildEnv_ToolTimeout(t *testing.T) {
+	t.Setenv("MCP_TOOL_TIMEOUT", "999999")
+	opts := defaultOptions()
+	WithToolTimeout(30 * time.Second)(opts)
+	env := buildEnv(opts)
+	for _, want := range []string{"MCP_TOOL_TIMEOUT=30000", "BASH_DEFAULT_TIMEOUT_MS=30000", "BASH_MAX_TIMEOUT_MS=30000"} {
+		if !slices.Contains(env, want) {
+			t.Fatalf("expected %s in environment, got %v", want, env)
+		}
+	}
+	if slices.Contains(env, "MCP_TOOL_TIMEOUT=999999") {
+		t.Fatal("expected the inherited MCP_TOOL_TIMEOUT to be replaced")
+	}
+}
+
+func TestRun_ToolTimeout(t *testing.T) {
+	defer func(d time.Duration) { toolTimeoutGrace = d }(toolTimeoutGrace)
+	toolTimeoutGrace = 0
+
+	// The WebFetch call hangs until the SDK interrupts the turn. The quick
+	// Read call answers in time and must not trip the watchdog.
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"Read","input":{}}]},"session_id":"s1"}'
+      echo '{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"ok"}]},"session_id":"s1"}'
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"t2","name":"WebFetch","input":{}}]},"session_id":"s1"}' ;;
+    *'"subtype":"interrupt"'*)
+      id=$(printf '%s' "$line" | sed 's/.*"request_id":"\([^"]*\)".*/\1/')
+      echo '{"type":"control_response","request_id":"'"$id"'","response":{"subtype":"success"}}'
+      echo '{"type":"result","subtype":"error_during_execution","is_error":true,"session_id":"s1"}'
+      exit 0 ;;
+  esac
+done
+`)
+	start := time.Now()
+	_, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithToolTimeout(100*time.Millisecond))
+	var toolErr *ToolTimeoutError
+	if !errors.As(err, &toolErr) {
+		t.Fatalf("expected *ToolTimeoutError, got %T: %v", err, err)
+	}
+	if toolErr.Tool != "WebFetch" || toolErr.ToolUseID != "t2" {
+		t.Fatalf("unexpected error: %+v", toolErr)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Fatal("expected the hung call to be interrupted promptly")
+	}
+}
+
+// TestRun_ToolTimeoutExcludesPermissionWait checks that a slow permission
+// decision does not count against the tool's deadline.
+func TestRun_ToolTimeoutExcludesPermissionWait(t *testing.T) {
+	defer func(d time.Duration) { toolTimeoutGrace = d }(toolTimeoutGrace)
+	toolTimeoutGrace = 0
+
+	exe := writeFakeCLI(t, `while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"t1","name":"WebFetch","input":{}}]},"session_id":"s1"}'
+      echo '{"type":"control_request","request_id":"perm-1","request":{"subtype":"can_use_tool","tool_name":"WebFetch","tool_use_id":"t1","input":{}}}' ;;
+    *'"request_id":"perm-1"'*)
+      echo '{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"ok"}]},"session_id":"s1"}'
+      echo '{"type":"result","subtype":"success","result":"done","session_id":"s1"}'
+      exit 0 ;;
+    *'"subtype":"interrupt"'*)
+      echo '{"type":"result","subtype":"error_during_execution","is_error":true,"session_id":"s1"}'
+      exit 0 ;;
+  esac
+done
+`)
+	result, err := Run(context.Background(), "hi", WithClaudeExecutable(exe), WithToolTimeout(100*time.Millisecond),
+		WithPermissionHandler(func(string, json.RawMessage, PermissionContext) PermissionResult {
+			time.Sleep(400 * time.Millisecond)
+			return PermissionResult{Behavior: "allow"}
+		}))
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if result.Result != "done" {
+		t.Fatalf("unexpected result %q", result.Result)
+	}
+}
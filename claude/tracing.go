@@ -0,0 +1,190 @@
+package claude
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+// Tracer starts spans for agent runs. It is the dependency-free subset of an
+// OpenTelemetry tracer that the SDK needs, so the claude package does not
+// import the OpenTelemetry packages. The tracing/otel package, a separate
+// module so the SDK itself does not depend on OpenTelemetry, adapts an
+// OpenTelemetry trace.TracerProvider:
+//
+//	claude.Run(ctx, prompt, otel.WithTracerProvider(tp))
+type Tracer interface {
+	// Start begins a span named name as a child of any span in ctx.
+	Start(ctx context.Context, name string) (context.Context, Span)
+}
+
+// Span is a single traced operation started by a Tracer.
+type Span interface {
+	SetAttributes(attrs map[string]any)
+	RecordError(err error)
+	End()
+}
+
+// Span names and attribute keys recorded when a Tracer is configured.
+const (
+	SpanRun            = "claude.run"
+	SpanTurn           = "claude.turn"
+	SpanTool           = "claude.tool"
+	SpanControlRequest = "claude.control_request"
+
+	AttrRequestID      = "claude.request_id"
+	AttrModel          = "claude.model"
+	AttrSessionID      = "claude.session_id"
+	AttrNumTurns       = "claude.num_turns"
+	AttrCostUSD        = "claude.cost_usd"
+	AttrInputTokens    = "claude.input_tokens"
+	AttrOutputTokens   = "claude.output_tokens"
+	AttrToolName       = "claude.tool.name"
+	AttrToolUseID      = "claude.tool.use_id"
+	AttrToolIsError    = "claude.tool.is_error"
+	AttrControlSubtype = "claude.control_request.subtype"
+)
+
+// runTracer maintains the span tree for one Stream: a root SpanRun, a SpanTurn
+// per user message, and a SpanTool per tool call. A nil *runTracer is valid and
+// records nothing.
+type runTracer struct {
+	tracer Tracer
+	ctx    context.Context // carries the root span
+	root   Span
+
+	mu      sync.Mutex
+	turnCtx context.Context
+	turn    Span
+	tools   map[string]Span
+}
+
+// newRunTracer starts the root span, or returns nil when t is nil.
+func newRunTracer(ctx context.Context, t Tracer, requestID, model string) *runTracer {
+	if t == nil {
+		return nil
+	}
+	ctx, root := t.Start(ctx, SpanRun)
+	root.SetAttributes(map[string]any{AttrRequestID: requestID, AttrModel: model})
+	return &runTracer{tracer: t, ctx: ctx, root: root, tools: make(map[string]Span)}
+}
+
+// startTurn begins a SpanTurn, ending any turn still open.
+func (r *runTracer) startTurn() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.turn != nil {
+		r.turn.End()
+	}
+	r.turnCtx, r.turn = r.tracer.Start(r.ctx, SpanTurn)
+}
+
+// observe updates the span tree from an event read from the subprocess.
+func (r *runTracer) observe(e Event) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case e.System != nil && e.System.Subtype == SubtypeInit:
+		r.root.SetAttributes(map[string]any{
+			AttrModel:     e.System.Model,
+			AttrSessionID: e.System.SessionID,
+		})
+
+	case e.Assistant != nil:
+		parent := r.turnCtx
+		if parent == nil {
+			parent = r.ctx
+		}
+		for _, b := range e.Assistant.Message.Content {
+			if b.Type != "tool_use" {
+				continue
+			}
+			_, span := r.tracer.Start(parent, SpanTool)
+			span.SetAttributes(map[string]any{AttrToolName: b.Name, AttrToolUseID: b.ID})
+			r.tools[b.ID] = span
+		}
+
+	case e.User != nil:
+		for _, b := range e.User.Message.Content {
+			if b.Type != "tool_result" {
+				continue
+			}
+			if span, ok := r.tools[b.ToolUseID]; ok {
+				span.SetAttributes(map[string]any{AttrToolIsError: b.IsError})
+				span.End()
+				delete(r.tools, b.ToolUseID)
+			}
+		}
+
+	case e.Result != nil:
+		attrs := map[string]any{
+			AttrSessionID:    e.Result.SessionID,
+			AttrNumTurns:     e.Result.NumTurns,
+			AttrCostUSD:      e.Result.TotalCostUSD,
+			AttrInputTokens:  e.Result.Usage.InputTokens,
+			AttrOutputTokens: e.Result.Usage.OutputTokens,
+		}
+		r.root.SetAttributes(attrs)
+		if r.turn != nil {
+			r.turn.SetAttributes(attrs)
+			if err := resultError(e.Result); err != nil {
+				r.turn.RecordError(err)
+			}
+			r.turn.End()
+			r.turn, r.turnCtx = nil, nil
+		}
+	}
+}
+
+// controlRequest starts a SpanControlRequest for a control_request line and
+// returns the function that ends it.
+func (r *runTracer) controlRequest(line []byte) func() {
+	if r == nil {
+		return func() {}
+	}
+	var envelope struct {
+		Request struct {
+			Subtype string `json:"subtype"`
+		} `json:"request"`
+	}
+	_ = json.Unmarshal(line, &envelope)
+
+	r.mu.Lock()
+	parent := r.turnCtx
+	if parent == nil {
+		parent = r.ctx
+	}
+	r.mu.Unlock()
+
+	_, span := r.tracer.Start(parent, SpanControlRequest)
+	span.SetAttributes(map[string]any{AttrControlSubtype: envelope.Request.Subtype})
+	return span.End
+}
+
+// end closes every open span, recording err on the root span when non-nil.
+func (r *runTracer) end(err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, span := range r.tools {
+		span.End()
+		delete(r.tools, id)
+	}
+	if r.turn != nil {
+		r.turn.End()
+		r.turn, r.turnCtx = nil, nil
+	}
+	if err != nil {
+		r.root.RecordError(err)
+	}
+	r.root.End()
+}
@@ -0,0 +1,141 @@
+// Package otel adapts OpenTelemetry tracing to the claude package's Tracer, so
+// runs, turns, tool calls and control requests are recorded as OpenTelemetry
+// spans.
+//
+//	result, err := claude.Run(ctx, prompt, otel.WithTracerProvider(otelglobal.GetTracerProvider()))
+//
+// Once the CLI reports the session ID, it is set as the claude.session_id
+// attribute of every span and carried as a claude.session_id baggage member in
+// the context of every span started after it, so a baggage-aware span
+// processor or exporter can group the spans of a session.
+//
+// The package is its own module, so only programs that import it depend on
+// OpenTelemetry:
+//
+//	go get github.com/shaharia-lab/claude-agent-sdk-go/claude/tracing/otel
+package otel
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/shaharia-lab/claude-agent-sdk-go/claude"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName is the name of the tracer taken from the provider.
+const InstrumentationName = "github.com/shaharia-lab/claude-agent-sdk-go/claude"
+
+// WithTracerProvider records the run's spans with a tracer from tp.
+func WithTracerProvider(tp trace.TracerProvider) claude.Option {
+	return claude.WithTracer(NewTracer(tp))
+}
+
+// NewTracer returns a claude.Tracer that starts its spans with a tracer from
+// tp. Use it where an Option does not fit, such as a WarmPool shared across
+// providers.
+func NewTracer(tp trace.TracerProvider) claude.Tracer {
+	return &tracer{t: tp.Tracer(InstrumentationName)}
+}
+
+type tracer struct {
+	t trace.Tracer
+}
+
+// runKey is the context key of the *run a span belongs to.
+type runKey struct{}
+
+// run is shared by the spans of one claude.SpanRun tree and learns the session
+// ID from the root span's attributes.
+type run struct {
+	mu        sync.Mutex
+	sessionID string
+}
+
+func (r *run) session() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sessionID
+}
+
+func (r *run) setSession(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessionID = id
+}
+
+// Start implements claude.Tracer.
+func (t *tracer) Start(ctx context.Context, name string) (context.Context, claude.Span) {
+	r, _ := ctx.Value(runKey{}).(*run)
+	if r == nil || name == claude.SpanRun {
+		r = &run{}
+		ctx = context.WithValue(ctx, runKey{}, r)
+	}
+	var attrs []attribute.KeyValue
+	if id := r.session(); id != "" {
+		ctx = withSessionBaggage(ctx, id)
+		attrs = append(attrs, attribute.String(claude.AttrSessionID, id))
+	}
+	ctx, s := t.t.Start(ctx, name, trace.WithAttributes(attrs...))
+	return ctx, &span{span: s, run: r}
+}
+
+// withSessionBaggage adds the session ID to ctx's baggage.
+func withSessionBaggage(ctx context.Context, id string) context.Context {
+	m, err := baggage.NewMemberRaw(claude.AttrSessionID, id)
+	if err != nil {
+		return ctx
+	}
+	b, err := baggage.FromContext(ctx).SetMember(m)
+	if err != nil {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, b)
+}
+
+type span struct {
+	span trace.Span
+	run  *run
+}
+
+// SetAttributes implements claude.Span.
+func (s *span) SetAttributes(attrs map[string]any) {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		kvs = append(kvs, keyValue(k, v))
+		if id, ok := v.(string); ok && k == claude.AttrSessionID && id != "" {
+			s.run.setSession(id)
+		}
+	}
+	s.span.SetAttributes(kvs...)
+}
+
+// RecordError implements claude.Span; it also marks the span as failed.
+func (s *span) RecordError(err error) {
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+// End implements claude.Span.
+func (s *span) End() { s.span.End() }
+
+// keyValue converts an attribute set by the claude package.
+func keyValue(k string, v any) attribute.KeyValue {
+	switch v := v.(type) {
+	case string:
+		return attribute.String(k, v)
+	case bool:
+		return attribute.Bool(k, v)
+	case int:
+		return attribute.Int(k, v)
+	case int64:
+		return attribute.Int64(k, v)
+	case float64:
+		return attribute.Float64(k, v)
+	}
+	return attribute.String(k, fmt.Sprint(v))
+}
@@ -0,0 +1,70 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shaharia-lab/claude-agent-sdk-go/claude"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tr := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	ctx, root := tr.Start(context.Background(), claude.SpanRun)
+	early, turn := tr.Start(ctx, claude.SpanTurn)
+	if baggage.FromContext(early).Member(claude.AttrSessionID).Value() != "" {
+		t.Fatal("session baggage set before the session ID was known")
+	}
+	root.SetAttributes(map[string]any{claude.AttrSessionID: "sess-1", claude.AttrNumTurns: 2, claude.AttrCostUSD: 0.5})
+	toolCtx, tool := tr.Start(ctx, claude.SpanTool)
+	if got := baggage.FromContext(toolCtx).Member(claude.AttrSessionID).Value(); got != "sess-1" {
+		t.Fatalf("session baggage = %q, want sess-1", got)
+	}
+	tool.RecordError(errors.New("boom"))
+	tool.End()
+	turn.End()
+	root.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+	}
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+	if s := spans[claude.SpanTool]; s.Status().Code != codes.Error || s.Parent().SpanID() != spans[claude.SpanRun].SpanContext().SpanID() {
+		t.Fatalf("unexpected tool span: status %v, parent %v", s.Status(), s.Parent())
+	}
+	has := func(s sdktrace.ReadOnlySpan, kv attribute.KeyValue) bool {
+		for _, a := range s.Attributes() {
+			if a == kv {
+				return true
+			}
+		}
+		return false
+	}
+	if !has(spans[claude.SpanTool], attribute.String(claude.AttrSessionID, "sess-1")) {
+		t.Fatal("tool span lacks the session ID attribute")
+	}
+	if !has(spans[claude.SpanRun], attribute.Int(claude.AttrNumTurns, 2)) || !has(spans[claude.SpanRun], attribute.Float64(claude.AttrCostUSD, 0.5)) {
+		t.Fatalf("root span attributes not converted: %v", spans[claude.SpanRun].Attributes())
+	}
+
+	// A new run does not inherit the previous run's session.
+	ctx2, root2 := tr.Start(toolCtx, claude.SpanRun)
+	_, turn2 := tr.Start(ctx2, claude.SpanTurn)
+	turn2.End()
+	root2.End()
+	for _, s := range rec.Ended()[3:] {
+		if s.Name() == claude.SpanTurn && has(s, attribute.String(claude.AttrSessionID, "sess-1")) {
+			t.Fatal("second run's turn carries the first run's session")
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package claude
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+type spanKey struct{}
+
+type fakeSpan struct {
+	name   string
+	parent *fakeSpan
+	attrs  map[string]any
+	errs   []error
+	ended  bool
+}
+
+func (s *fakeSpan) SetAttributes(attrs map[string]any) {
+	for k, v := range attrs {
+		s.attrs[k] = v
+	}
+}
+func (s *fakeSpan) RecordError(err error) { s.errs = append(s.errs, err) }
+func (s *fakeSpan) End()                  { s.ended = true }
+
+type fakeTracer struct {
+	mu    sync.Mutex
+	spans []*fakeSpan
+}
+
+func (t *fakeTracer) Start(ctx context.Context, name string) (context.Context, Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	parent, _ := ctx.Value(spanKey{}).(*fakeSpan)
+	span := &fakeSpan{name: name, parent: parent, attrs: map[string]any{}}
+	t.spans = append(t.spans, span)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+func TestRunTracer_SpanTree(t *testing.T) {
+	ft := &fakeTracer{}
+	tr := newRunTracer(context.Background(), ft, "req-1", "claude-sonnet-4-6")
+
+	tr.startTurn()
+	for _, line := range []string{
+		`{"type":"system","subtype":"init","session_id":"s1","model":"claude-sonnet-4-6"}`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"tu1","name":"Bash","input":{}}]}}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu1","content":"ok"}]}}`,
+		`{"type":"result","subtype":"success","num_turns":1,"total_cost_usd":0.02,"usage":{"input_tokens":10,"output_tokens":5},"session_id":"s1"}`,
+	} {
+		e, err := parseLine([]byte(line))
+		if err != nil {
+			t.Fatalf("parseLine: %v", err)
+		}
+		tr.observe(e)
+	}
+	tr.controlRequest([]byte(`{"type":"control_request","request":{"subtype":"can_use_tool"}}`))()
+	tr.end(nil)
+
+	if len(ft.spans) != 4 {
+		t.Fatalf("expected 4 spans, got %d", len(ft.spans))
+	}
+	root, turn, tool, control := ft.spans[0], ft.spans[1], ft.spans[2], ft.spans[3]
+	if root.name != SpanRun || turn.name != SpanTurn || tool.name != SpanTool || control.name != SpanControlRequest {
+		t.Fatalf("unexpected span names: %s %s %s %s", root.name, turn.name, tool.name, control.name)
+	}
+	if turn.parent != root || tool.parent != turn || control.parent != root {
+		t.Fatal("unexpected span parents")
+	}
+	for _, s := range ft.spans {
+		if !s.ended {
+			t.Fatalf("expected span %s to be ended", s.name)
+		}
+	}
+	if root.attrs[AttrRequestID] != "req-1" || root.attrs[AttrSessionID] != "s1" || root.attrs[AttrCostUSD] != 0.02 || turn.attrs[AttrOutputTokens] != 5 {
+		t.Fatalf("unexpected attributes: root=%v turn=%v", root.attrs, turn.attrs)
+	}
+	if tool.attrs[AttrToolName] != "Bash" || tool.attrs[AttrToolIsError] != false {
+		t.Fatalf("unexpected tool attributes: %v", tool.attrs)
+	}
+	if control.attrs[AttrControlSubtype] != "can_use_tool" {
+		t.Fatalf("unexpected control attributes: %v", control.attrs)
+	}
+}
+
+func TestRunTracer_NilIsNoop(t *testing.T) {
+	var tr *runTracer
+	tr.startTurn()
+	tr.observe(Event{Type: TypeResult, Result: &Result{}})
+	tr.controlRequest(nil)()
+	tr.end(nil)
+	if newRunTracer(context.Background(), nil, "req-1", "m") != nil {
+		t.Fatal("expected nil runTracer without a Tracer")
+	}
+}
@@ -0,0 +1,104 @@
+package claude
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// errReplayReadOnly is returned by control methods of a replayed Stream.
+var errReplayReadOnly = errors.New("claude: replayed stream is read-only")
+
+// TeeToWriter makes s write every event's raw JSON line to w, one per line, as
+// it is yielded from Events(). The result is a JSONL transcript that
+// ReplayFromReader can turn back into a Stream. Synthetic events generated by
+// the SDK itself (warnings, turn markers) have no raw line and are not written.
+//
+// TeeToWriter returns s for chaining and must be called before Events() is
+// first consumed. A write error stops further writes but not the stream; it is
+// reported by Err once the stream ends.
+func TeeToWriter(s *Stream, w io.Writer) *Stream {
+	in := s.Events()
+	out := make(chan Event, cap(s.events))
+	s.view = out
+	go func() {
+		defer close(out)
+		var werr error
+		for e := range in {
+			if werr == nil && len(e.Raw) > 0 {
+				if _, werr = w.Write(append(append([]byte(nil), e.Raw...), '\n')); werr != nil {
+					s.errMu.Lock()
+					s.transcriptErr = fmt.Errorf("claude: transcript write: %w", werr)
+					s.errMu.Unlock()
+				}
+			}
+			select {
+			case out <- e:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// ReplayFromReader returns a Stream that yields the events recorded in a JSONL
+// transcript, such as one written by TeeToWriter. Lines are parsed exactly as
+// if they came from the CLI, so the events match the original run minus any
+// SDK-generated ones. The stream is read-only: SendUserMessage and the control
+// methods return an error. Malformed lines are skipped; a read error is
+// reported by Err. Close and Interrupt stop the replay.
+func ReplayFromReader(r io.Reader) *Stream {
+	done := make(chan struct{})
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	s := &Stream{
+		events:      make(chan Event, 32),
+		write:       func(any) error { return errReplayReadOnly },
+		ctx:         context.Background(),
+		requestID:   newUUID(),
+		pending:     make(map[string]chan controlResponse),
+		done:        done,
+		interruptCh: stop,
+		initCh:      make(chan struct{}),
+		softStopCh:  make(chan struct{}),
+		interrupt:   func() { stopOnce.Do(func() { close(stop) }) },
+		softStop:    func() {},
+	}
+	go func() {
+		defer close(done)
+		defer close(s.events)
+		defer s.closePartial()
+		defer s.closeThinking()
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+		for scanner.Scan() {
+			event, err := parseLine(scanner.Bytes())
+			if err != nil {
+				continue
+			}
+			s.recordSessionID(event)
+			if event.System != nil && event.System.Subtype == SubtypeInit {
+				s.recordInit(event.System)
+			}
+			if p := s.partial.Load(); p != nil {
+				p.observe(event)
+			}
+			if t := s.thinking.Load(); t != nil {
+				t.observe(event)
+			}
+			select {
+			case s.events <- event:
+			case <-stop:
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			s.setErr(fmt.Errorf("claude: transcript read: %w", err))
+		}
+	}()
+	return s
+}
@@ -0,0 +1,118 @@
+package claude
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTeeToWriter_ReplayFromReader(t *testing.T) {
+	exe := writeFakeCLI(t, `echo '{"type":"system","subtype":"init","session_id":"s1","model":"claude-sonnet-4-6"}'
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"hi"}]},"session_id":"s1"}'
+      echo '{"type":"result","subtype":"success","result":"hi","session_id":"s1"}'
+      exit 0 ;;
+  esac
+done
+`)
+	stream, err := Query(t.Context(), "hello", WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	var transcript bytes.Buffer
+	var live []MessageType
+	for e := range TeeToWriter(stream, &transcript).Events() {
+		live = append(live, e.Type)
+	}
+	if n := strings.Count(transcript.String(), "\n"); n != 3 {
+		t.Fatalf("expected 3 transcript lines, got %d:\n%s", n, transcript.String())
+	}
+
+	replay := ReplayFromReader(&transcript)
+	var replayed []MessageType
+	var result *Result
+	for e := range replay.Events() {
+		replayed = append(replayed, e.Type)
+		if e.Result != nil {
+			result = e.Result
+		}
+	}
+	if !slices.Equal(replayed, live) {
+		t.Fatalf("replayed %v, live %v", replayed, live)
+	}
+	if result == nil || result.Result != "hi" {
+		t.Fatalf("unexpected replayed result: %+v", result)
+	}
+	if replay.SessionID() != "s1" {
+		t.Fatalf("expected session ID s1, got %q", replay.SessionID())
+	}
+	if err := replay.SendUserMessage("again"); err == nil {
+		t.Fatal("expected replayed stream to be read-only")
+	}
+	if err := replay.Err(); err != nil {
+		t.Fatalf("unexpected replay error: %v", err)
+	}
+}
+
+func TestReplayFromReader_Close(t *testing.T) {
+	line := `{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"hi"}]},"session_id":"s1"}` + "\n"
+	replay := ReplayFromReader(strings.NewReader(strings.Repeat(line, 1000)))
+	<-replay.Events()
+	replay.Close()
+	select {
+	case <-replay.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("replay goroutine kept running after Close")
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+// TestTeeToWriter_ProcessErrorWins checks that a transcript write error does
+// not hide why the CLI failed.
+func TestTeeToWriter_ProcessErrorWins(t *testing.T) {
+	exe := writeFakeCLI(t, `echo '{"type":"system","subtype":"init","session_id":"s1"}'
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo 'crashed' >&2
+      exit 3 ;;
+  esac
+done
+`)
+	stream, err := Query(t.Context(), "hello", WithClaudeExecutable(exe))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for range TeeToWriter(stream, failingWriter{}).Events() {
+	}
+	var procErr *ProcessError
+	if err := stream.Err(); !errors.As(err, &procErr) {
+		t.Fatalf("expected *ProcessError, got %T: %v", err, err)
+	}
+
+	stream, err = Query(t.Context(), "hello", WithClaudeExecutable(writeFakeCLI(t, `echo '{"type":"system","subtype":"init","session_id":"s1"}'
+while IFS= read -r line; do
+  case "$line" in
+    *'"type":"user"'*)
+      echo '{"type":"result","subtype":"success","result":"hi","session_id":"s1"}'
+      exit 0 ;;
+  esac
+done
+`)))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	for range TeeToWriter(stream, failingWriter{}).Events() {
+	}
+	if err := stream.Err(); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Fatalf("expected the transcript write error, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package claude
+
+// TurnMarker identifies one agent turn: a single model response together with
+// the tool results fed back to it. It is carried by TypeTurnStart and
+// TypeTurnEnd events when WithTurnMarkers is set.
+type TurnMarker struct {
+	// Index is the 1-based turn number within the current run (or Session
+	// turn). After the last TypeTurnEnd it equals the result's NumTurns.
+	Index int
+}
+
+// turnTracker derives turn boundaries from the CLI's message stream. A turn
+// starts with the first top-level assistant output and ends when the model
+// produces output again after receiving tool results, or when the result
+// arrives. Subagent messages (ParentToolUseID set) do not affect boundaries.
+type turnTracker struct {
+	index   int
+	open    bool
+	sawUser bool
+}
+
+// markers returns the synthetic events to emit before e.
+func (t *turnTracker) markers(e Event) []Event {
+	var out []Event
+	switch {
+	case e.Assistant != nil && e.Assistant.ParentToolUseID == nil,
+		e.StreamEvent != nil && e.StreamEvent.ParentToolUseID == nil:
+		if t.open && t.sawUser {
+			out = append(out, t.end())
+		}
+		if !t.open {
+			t.index++
+			t.open, t.sawUser = true, false
+			out = append(out, Event{Type: TypeTurnStart, Turn: &TurnMarker{Index: t.index}})
+		}
+	case e.User != nil && e.User.ParentToolUseID == nil:
+		if t.open {
+			t.sawUser = true
+		}
+	case e.Result != nil:
+		if t.open {
+			out = append(out, t.end())
+		}
+		t.index = 0
+	}
+	return out
+}
+
+func (t *turnTracker) end() Event {
+	t.open = false
+	return Event{Type: TypeTurnEnd, Turn: &TurnMarker{Index: t.index}}
+}
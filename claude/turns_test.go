@@ -0,0 +1,40 @@
+package claude
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestTurnTracker_Markers(t *testing.T) {
+	var tr turnTracker
+	var got []string
+	for _, line := range []string{
+		`{"type":"system","subtype":"init","session_id":"s1"}`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Let me look."}]}}`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"tool_use","id":"tu1","name":"Bash","input":{}}]}}`,
+		`{"type":"assistant","parent_tool_use_id":"tu1","message":{"role":"assistant","content":[{"type":"text","text":"subagent"}]}}`,
+		`{"type":"user","message":{"role":"user","content":[{"type":"tool_result","tool_use_id":"tu1","content":"ok"}]}}`,
+		`{"type":"assistant","message":{"role":"assistant","content":[{"type":"text","text":"Done."}]}}`,
+		`{"type":"result","subtype":"success","num_turns":2}`,
+	} {
+		e, err := parseLine([]byte(line))
+		if err != nil {
+			t.Fatalf("parseLine: %v", err)
+		}
+		for _, m := range tr.markers(e) {
+			got = append(got, fmt.Sprintf("%s:%d", m.Type, m.Turn.Index))
+		}
+		got = append(got, string(e.Type))
+	}
+
+	want := []string{
+		"system",
+		"turn_start:1", "assistant", "assistant", "assistant", "user",
+		"turn_end:1", "turn_start:2", "assistant",
+		"turn_end:2", "result",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected event order:\n got  %v\n want %v", got, want)
+	}
+}
@@ -4,3 +4,7 @@ package claude
 // It is reported to the claude subprocess via the CLAUDE_AGENT_SDK_VERSION
 // environment variable for Anthropic telemetry.
 const SDKVersion = "0.3.0"
+
+// defaultEntrypoint is the CLAUDE_CODE_ENTRYPOINT value used unless overridden
+// with WithEntrypoint.
+const defaultEntrypoint = "sdk-go"
@@ -2,10 +2,12 @@ module github.com/shaharia-lab/claude-agent-sdk-go
 
 go 1.24
 
-require github.com/modelcontextprotocol/go-sdk v1.3.1
+require (
+	github.com/google/jsonschema-go v0.4.2
+	github.com/modelcontextprotocol/go-sdk v1.3.1
+)
 
 require (
-	github.com/google/jsonschema-go v0.4.2 // indirect
 	github.com/segmentio/asm v1.1.3 // indirect
 	github.com/segmentio/encoding v0.5.3 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect